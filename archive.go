@@ -0,0 +1,145 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Formats of a streamed archive
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+// ArchiveContentType returns the content type of an archive format
+func ArchiveContentType(format string) string {
+	if format == ArchiveTarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// ArchiveKeys returns the file keys passed either as repeated or comma separated values
+func ArchiveKeys(values []string) []string {
+	keys := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// ArchiveName returns the download file name of an archive of the files at a request path
+func ArchiveName(upath, format string) string {
+	name := path.Base(upath)
+	if name == "/" || name == "." {
+		name = "files"
+	}
+	return name + "." + format
+}
+
+// ArchiveWriter streams files into a zip or tar.gz archive without buffering whole files.
+// Entries with clashing names are renamed by appending a counter before the extension.
+type ArchiveWriter struct {
+	zw    *zip.Writer
+	tw    *tar.Writer
+	gw    *gzip.Writer
+	names map[string]struct{}
+}
+
+// NewArchiveWriter creates an archive writer of the given format that writes to w
+func NewArchiveWriter(w io.Writer, format string) (*ArchiveWriter, error) {
+	aw := &ArchiveWriter{
+		names: make(map[string]struct{}, 0),
+	}
+
+	switch format {
+	case ArchiveZip:
+		aw.zw = zip.NewWriter(w)
+	case ArchiveTarGz:
+		aw.gw = gzip.NewWriter(w)
+		aw.tw = tar.NewWriter(aw.gw)
+	default:
+		return nil, errors.Errorf("unknown archive format %q", format)
+	}
+
+	return aw, nil
+}
+
+// Add adds an entry with the content of r to the archive. Size must be the exact number of bytes in r
+func (aw *ArchiveWriter) Add(name string, size int64, modTime time.Time, r io.Reader) error {
+	name = aw.uniqueName(name)
+
+	if aw.zw != nil {
+		ew, err := aw.zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: modTime,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(ew, r)
+		return err
+	}
+
+	err := aw.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(aw.tw, r, size)
+	return err
+}
+
+// Close finishes the archive. It does not close the underlying writer
+func (aw *ArchiveWriter) Close() error {
+	if aw.zw != nil {
+		return aw.zw.Close()
+	}
+
+	err := aw.tw.Close()
+	if err != nil {
+		return err
+	}
+
+	return aw.gw.Close()
+}
+
+// uniqueName returns a safe entry name for name that has not been used in the archive
+func (aw *ArchiveWriter) uniqueName(name string) string {
+	// entries are flat so that no entry escapes the extraction directory
+	name = path.Base(strings.Replace(name, "\\", "/", -1))
+	if name == "." || name == ".." || name == "/" {
+		name = "file"
+	}
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	unique := name
+	for i := 1; ; i++ {
+		if _, ok := aw.names[unique]; !ok {
+			break
+		}
+		unique = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	aw.names[unique] = struct{}{}
+
+	return unique
+}
@@ -0,0 +1,183 @@
+package fs
+
+import (
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Modes of a batch upload
+const (
+	BatchAllOrNothing = "all"         // Either every file in the batch is stored or none is
+	BatchBestEffort   = "best-effort" // Every file in the batch is stored independently of the others
+)
+
+// UploadResult is the outcome of storing one file of a batch upload
+type UploadResult struct {
+	Key   string `json:"key"`
+	Path  string `json:"path"`
+	Name  string `json:"name"`
+	Size  int64  `json:"size"`
+	Error string `json:"error,omitempty"`
+}
+
+// BatchResponse is the response body of a batch upload
+type BatchResponse struct {
+	Mode  string          `json:"mode"`
+	Files []*UploadResult `json:"files"`
+}
+
+// StatusError is a failure to store uploads together with the status and message reported to client
+type StatusError struct {
+	Status int
+	Msg    string
+}
+
+func (e *StatusError) Error() string {
+	return e.Msg
+}
+
+// BatchMode returns the batch mode named by a query value. An empty value is all or nothing
+func BatchMode(value string) (string, *StatusError) {
+	if value == "" {
+		return BatchAllOrNothing, nil
+	}
+	if value != BatchAllOrNothing && value != BatchBestEffort {
+		return "", &StatusError{Status: http.StatusBadRequest, Msg: "UNKNOWN_BATCH_MODE"}
+	}
+	return value, nil
+}
+
+// FormFiles returns every file part of a multipart form ordered by field name
+func FormFiles(form *multipart.Form) []*multipart.FileHeader {
+	if form == nil {
+		return nil
+	}
+
+	fields := make([]string, 0, len(form.File))
+	for field := range form.File {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	headers := make([]*multipart.FileHeader, 0, len(fields))
+	for _, field := range fields {
+		headers = append(headers, form.File[field]...)
+	}
+
+	return headers
+}
+
+// StoreBatch stores the files of a batch according to mode and returns the status of the reply.
+// Files whose result has an error are skipped, and files with the same path as an earlier file fail.
+// Store stores the files at the given indexes, either all of them or none, and at most limit calls run concurrently
+func StoreBatch(mode string, limit int, results []*UploadResult, store func(indexes []int) *StatusError) int {
+	// two files with the same path would overwrite each other
+	paths := make(map[string]struct{}, len(results))
+	for _, result := range results {
+		if result.Error != "" {
+			continue
+		}
+		if _, ok := paths[result.Path]; ok {
+			result.Error = "DUPLICATE_FILE_PATH"
+			continue
+		}
+		paths[result.Path] = struct{}{}
+	}
+
+	indexes := make([]int, 0, len(results))
+	for i, result := range results {
+		if result.Error == "" {
+			indexes = append(indexes, i)
+		}
+	}
+
+	switch mode {
+	case BatchAllOrNothing:
+		if len(indexes) < len(results) {
+			abort(results, "ABORTED")
+			return http.StatusBadRequest
+		}
+		serr := store(indexes)
+		if serr != nil {
+			abort(results, serr.Msg)
+			return serr.Status
+		}
+	case BatchBestEffort:
+		ForEach(len(indexes), limit, func(i int) {
+			serr := store(indexes[i : i+1])
+			if serr != nil {
+				results[indexes[i]].Error = serr.Msg
+			}
+		})
+		if failed(results) {
+			return http.StatusMultiStatus
+		}
+	}
+
+	return http.StatusCreated
+}
+
+// WriteBatch replies with the result of each file of a batch. Created becomes OK for requests that do not create resources
+func WriteBatch(w http.ResponseWriter, r *http.Request, status int, mode string, results []*UploadResult) {
+	if status == http.StatusCreated && r.Method != http.MethodPost {
+		status = http.StatusOK
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&BatchResponse{
+		Mode:  mode,
+		Files: results,
+	})
+}
+
+// failed checks whether any file in the batch failed
+func failed(results []*UploadResult) bool {
+	for _, result := range results {
+		if result.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// abort sets msg as the error of every file in the batch that has not failed
+func abort(results []*UploadResult, msg string) {
+	for _, result := range results {
+		if result.Error == "" {
+			result.Error = msg
+		}
+	}
+}
+
+// ForEach calls fn for each index in [0, n) with at most limit calls running concurrently
+func ForEach(n, limit int, fn func(i int)) {
+	if n == 1 || limit <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	var (
+		wg  = &sync.WaitGroup{}
+		sem = make(chan struct{}, limit)
+	)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"fmt"
+	fs "github.com/gidyon/file-handlers"
+	file "github.com/gidyon/file-handlers/filehandler"
+	"github.com/go-redis/redis"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+// Storage backends of the file handlers
+const (
+	backendFiles = "files"
+	backendDB    = "dbstorage"
+)
+
+// trashDirName is the directory next to stored files that deleted files are moved to until they are restored or purged
+const trashDirName = ".trash"
+
+// metaColumns are the metadata columns shared by the file_infos and file_data tables
+const metaColumns = "id, owner_id, owner_tag, mime, name, path, size, created_at, updated_at, deleted_at"
+
+// admin manages the files of a storage backend
+type admin struct {
+	db          *gorm.DB
+	backend     string
+	dir         string // directory of stored files of the files backend
+	redisClient *redis.Client
+	out         io.Writer
+}
+
+// filter selects files by owner and tag
+type filter struct {
+	ownerID  string
+	ownerTag string
+	deleted  bool // select deleted files instead of live ones
+}
+
+// table returns the metadata table of a backend
+func table(backend string) string {
+	if backend == backendDB {
+		return "file_data"
+	}
+	return "file_infos"
+}
+
+// query returns the metadata rows of a backend selected by the filter
+func (a *admin) query(backend string, f *filter) *gorm.DB {
+	q := a.db.Table(table(backend)).Select(metaColumns)
+	if f.deleted {
+		q = q.Where("deleted_at IS NOT NULL")
+	} else {
+		q = q.Where("deleted_at IS NULL")
+	}
+	if f.ownerID != "" {
+		q = q.Where("owner_id = ?", f.ownerID)
+	}
+	if f.ownerTag != "" {
+		q = q.Where("owner_tag = ?", f.ownerTag)
+	}
+	return q.Order("path")
+}
+
+// rows returns the metadata of the files of a backend selected by the filter
+func (a *admin) rows(backend string, f *filter) ([]*fs.FileInfo, error) {
+	infos := make([]*fs.FileInfo, 0)
+	err := a.query(backend, f).Scan(&infos).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query files")
+	}
+	return infos, nil
+}
+
+// row returns the metadata of the file with key, including deleted files. It returns nil when there is no row
+func (a *admin) row(backend, key string) (*fs.FileInfo, error) {
+	infos := make([]*fs.FileInfo, 0, 1)
+	err := a.db.Table(table(backend)).Select(metaColumns).Where("id = ?", key).Scan(&infos).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query file")
+	}
+	if len(infos) == 0 {
+		return nil, nil
+	}
+	return infos[0], nil
+}
+
+func (a *admin) filePath(key string) string {
+	return filepath.Join(a.dir, key)
+}
+
+func (a *admin) trashPath(key string) string {
+	return filepath.Join(a.dir, trashDirName, key)
+}
+
+// list prints the files selected by the filter
+func (a *admin) list(f *filter) error {
+	infos, err := a.rows(a.backend, f)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(a.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tOWNER\tTAG\tMIME\tSIZE\tUPDATED\tPATH")
+	for _, info := range infos {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			info.ID, info.OwnerID, info.OwnerTag, info.Mime, info.Size, info.UpdatedAt.UTC().Format(time.RFC3339), info.Path)
+	}
+	return tw.Flush()
+}
+
+// show prints the key the handlers compute for a URL path and the metadata and state of the file stored under it
+func (a *admin) show(upath string) error {
+	key := fs.FileKey(upath)
+
+	info, err := a.row(a.backend, key)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(a.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "key:\t%s\n", key)
+
+	if info != nil {
+		state := "stored"
+		if info.DeletedAt != nil {
+			state = "deleted " + info.DeletedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "path:\t%s\n", info.Path)
+		fmt.Fprintf(tw, "name:\t%s\n", info.Name)
+		fmt.Fprintf(tw, "owner:\t%s\n", info.OwnerID)
+		fmt.Fprintf(tw, "tag:\t%s\n", info.OwnerTag)
+		fmt.Fprintf(tw, "mime:\t%s\n", info.Mime)
+		fmt.Fprintf(tw, "size:\t%d\n", info.Size)
+		fmt.Fprintf(tw, "created:\t%s\n", info.CreatedAt.UTC().Format(time.RFC3339))
+		fmt.Fprintf(tw, "updated:\t%s\n", info.UpdatedAt.UTC().Format(time.RFC3339))
+		fmt.Fprintf(tw, "metadata:\t%s\n", state)
+	} else {
+		fmt.Fprintf(tw, "metadata:\tnone\n")
+	}
+
+	if a.backend == backendFiles {
+		fmt.Fprintf(tw, "disk:\t%s\n", a.diskState(key))
+	}
+
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	if info == nil && (a.backend != backendFiles || a.diskState(key) == "missing") {
+		return errors.Errorf("no file at %s", upath)
+	}
+	return nil
+}
+
+// diskState describes where the file with key is on disk
+func (a *admin) diskState(key string) string {
+	if finfo, err := os.Stat(a.filePath(key)); err == nil {
+		return fmt.Sprintf("stored, %d bytes", finfo.Size())
+	}
+	if finfo, err := os.Stat(a.trashPath(key)); err == nil {
+		return fmt.Sprintf("in trash, %d bytes", finfo.Size())
+	}
+	return "missing"
+}
+
+// delete marks the file at a URL path as deleted so that it can be restored. Purged files are removed for good
+func (a *admin) delete(upath string, purge bool) error {
+	key := fs.FileKey(upath)
+
+	var model interface{} = &fs.FileInfo{}
+	if a.backend == backendDB {
+		model = &fs.FileData{}
+	}
+
+	db := a.db
+	if purge {
+		db = db.Unscoped()
+	}
+
+	res := db.Delete(model, "id = ?", key)
+	if res.Error != nil {
+		return errors.Wrapf(res.Error, "failed to delete %s", upath)
+	}
+	found := res.RowsAffected > 0
+
+	// cached copies would still be served
+	if a.backend == backendDB && a.redisClient != nil {
+		err := a.redisClient.Del(key).Err()
+		if err != nil {
+			return errors.Wrapf(err, "failed to drop cached %s", upath)
+		}
+	}
+
+	if a.backend == backendFiles {
+		moved, err := a.removeFromDisk(key, purge)
+		if err != nil {
+			if !purge && found {
+				// the file is still served, so its metadata must stay
+				a.db.Unscoped().Model(&fs.FileInfo{}).Where("id = ?", key).Update("deleted_at", nil)
+			}
+			return errors.Wrapf(err, "failed to delete %s", upath)
+		}
+		found = found || moved
+	}
+
+	if !found {
+		return errors.Errorf("no file at %s", upath)
+	}
+
+	fmt.Fprintf(a.out, "deleted %s %s\n", key, upath)
+	return nil
+}
+
+// removeFromDisk moves the file with key to the trash, or removes it from the directory and trash when purged.
+// It reports whether there was a file
+func (a *admin) removeFromDisk(key string, purge bool) (bool, error) {
+	if purge {
+		found := false
+		for _, name := range []string{a.filePath(key), a.trashPath(key)} {
+			err := os.Remove(name)
+			if err == nil {
+				found = true
+			} else if !os.IsNotExist(err) {
+				return found, err
+			}
+		}
+		return found, nil
+	}
+
+	if _, err := os.Stat(a.filePath(key)); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	err := os.MkdirAll(filepath.Join(a.dir, trashDirName), 0755)
+	if err != nil {
+		return false, err
+	}
+	return true, os.Rename(a.filePath(key), a.trashPath(key))
+}
+
+// restore restores the deleted file at a URL path
+func (a *admin) restore(upath string) error {
+	key := fs.FileKey(upath)
+
+	if a.backend == backendFiles {
+		if _, err := os.Stat(a.trashPath(key)); err != nil {
+			return errors.Errorf("no deleted file at %s", upath)
+		}
+		// a file saved at the path after the delete wins
+		if _, err := os.Stat(a.filePath(key)); err == nil {
+			return errors.Errorf("a file is stored at %s again, purge the deleted file instead", upath)
+		}
+	}
+
+	res := a.db.Table(table(a.backend)).Where("id = ? AND deleted_at IS NOT NULL", key).UpdateColumn("deleted_at", nil)
+	if res.Error != nil {
+		return errors.Wrapf(res.Error, "failed to restore %s", upath)
+	}
+
+	if a.backend == backendFiles {
+		err := os.Rename(a.trashPath(key), a.filePath(key))
+		if err != nil {
+			a.db.Table(table(a.backend)).Where("id = ?", key).UpdateColumn("deleted_at", time.Now())
+			return errors.Wrapf(err, "failed to restore %s", upath)
+		}
+	} else if res.RowsAffected == 0 {
+		return errors.Errorf("no deleted file at %s", upath)
+	}
+
+	fmt.Fprintf(a.out, "restored %s %s\n", key, upath)
+	return nil
+}
+
+// export copies files stored in the database to the directory of the files backend, with their metadata, through the
+// staging protocol of the files handler
+func (a *admin) export(f *filter, overwrite bool) error {
+	infos, err := a.rows(backendDB, f)
+	if err != nil {
+		return err
+	}
+
+	copied, skipped := 0, 0
+	for _, info := range infos {
+		if _, err := os.Stat(a.filePath(info.ID)); err == nil && !overwrite {
+			skipped++
+			continue
+		}
+
+		data := &fs.FileData{}
+		err = a.db.Select("data").Where("id = ?", info.ID).First(data).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", info.Path)
+		}
+
+		err = file.StoreFile(a.db, a.dir, &info.FileMeta, data.Data)
+		if err != nil {
+			return errors.Wrapf(err, "failed to store %s", info.Path)
+		}
+
+		// the handler dates stored files by when they are stored, keep when the file was first created
+		err = a.db.Table(table(backendFiles)).Where("id = ?", info.ID).UpdateColumn("created_at", info.CreatedAt).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to save metadata of %s", info.Path)
+		}
+		copied++
+	}
+
+	fmt.Fprintf(a.out, "exported %d files, skipped %d existing files\n", copied, skipped)
+	return nil
+}
+
+// importFiles copies files of the directory of the files backend into the database, with their metadata
+func (a *admin) importFiles(f *filter, overwrite bool) error {
+	infos, err := a.rows(backendFiles, f)
+	if err != nil {
+		return err
+	}
+
+	copied, skipped, missing := 0, 0, 0
+	for _, info := range infos {
+		existing, err := a.row(backendDB, info.ID)
+		if err != nil {
+			return err
+		}
+		if existing != nil && !overwrite {
+			skipped++
+			continue
+		}
+
+		bs, err := ioutil.ReadFile(a.filePath(info.ID))
+		if os.IsNotExist(err) {
+			fmt.Fprintf(a.out, "missing on disk %s %s\n", info.ID, info.Path)
+			missing++
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", info.Path)
+		}
+
+		err = a.db.Unscoped().Save(&fs.FileData{FileMeta: info.FileMeta, Data: bs, Model: info.Model}).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to save %s", info.Path)
+		}
+		copied++
+	}
+
+	fmt.Fprintf(a.out, "imported %d files, skipped %d existing files, %d missing on disk\n", copied, skipped, missing)
+	return nil
+}
+
+// resniff detects the content type of stored files again, the same way the handlers do on upload, and updates changed types
+func (a *admin) resniff(f *filter, dryRun bool) error {
+	infos, err := a.rows(a.backend, f)
+	if err != nil {
+		return err
+	}
+
+	changed := 0
+	for _, info := range infos {
+		var bs []byte
+		if a.backend == backendDB {
+			data := &fs.FileData{}
+			err = a.db.Select("data").Where("id = ?", info.ID).First(data).Error
+			bs = data.Data
+		} else {
+			bs, err = ioutil.ReadFile(a.filePath(info.ID))
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", info.Path)
+		}
+
+		ctype := http.DetectContentType(bs)
+		if ctype == info.Mime {
+			continue
+		}
+
+		fmt.Fprintf(a.out, "%s %s: %s -> %s\n", info.ID, info.Path, info.Mime, ctype)
+		changed++
+
+		if dryRun {
+			continue
+		}
+		err = a.db.Table(table(a.backend)).Where("id = ?", info.ID).UpdateColumn("mime", ctype).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to update %s", info.Path)
+		}
+	}
+
+	fmt.Fprintf(a.out, "%d of %d files changed type\n", changed, len(infos))
+	return nil
+}
+
+// ownerUsage is the storage used by an owner
+type ownerUsage struct {
+	OwnerID string
+	Files   int64
+	Bytes   int64
+}
+
+// usage prints the number of files and bytes stored per owner, largest first
+func (a *admin) usage() error {
+	usages := make([]*ownerUsage, 0)
+	err := a.db.Table(table(a.backend)).
+		Select("owner_id, count(*) AS files, coalesce(sum(size), 0) AS bytes").
+		Where("deleted_at IS NULL").
+		Group("owner_id").
+		Order("bytes DESC").
+		Scan(&usages).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to compute usage")
+	}
+
+	var totalFiles, totalBytes int64
+	tw := tabwriter.NewWriter(a.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "OWNER\tFILES\tBYTES")
+	for _, u := range usages {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", u.OwnerID, u.Files, u.Bytes)
+		totalFiles += u.Files
+		totalBytes += u.Bytes
+	}
+	fmt.Fprintf(tw, "total\t%d\t%d\n", totalFiles, totalBytes)
+	return tw.Flush()
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	fs "github.com/gidyon/file-handlers"
+	file "github.com/gidyon/file-handlers/filehandler"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+const testOwner = "fileadmin-test"
+
+var _ = Describe("Managing stored files", func() {
+	var (
+		dir string
+		out *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "fileadmin")
+		Expect(err).ShouldNot(HaveOccurred())
+		out = &bytes.Buffer{}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+		DB.Unscoped().Delete(&fs.FileInfo{}, "owner_id = ?", testOwner)
+		DB.Unscoped().Delete(&fs.FileData{}, "owner_id = ?", testOwner)
+	})
+
+	newAdmin := func(backend string) *admin {
+		return &admin{
+			db:      DB,
+			backend: backend,
+			dir:     dir,
+			out:     out,
+		}
+	}
+
+	meta := func(upath string) *fs.FileMeta {
+		return &fs.FileMeta{
+			ID:       fs.FileKey(upath),
+			OwnerID:  testOwner,
+			OwnerTag: "docs",
+			Mime:     "text/plain; charset=utf-8",
+			Name:     path.Base(upath),
+			Path:     upath,
+		}
+	}
+
+	// storeFile stores a file the way the files handler does
+	storeFile := func(upath, content string) string {
+		m := meta(upath)
+		Expect(file.StoreFile(DB, dir, m, []byte(content))).ShouldNot(HaveOccurred())
+		return m.ID
+	}
+
+	// storeData stores a file the way the dbstorage handler does
+	storeData := func(upath, content string, created time.Time) string {
+		m := meta(upath)
+		m.Size = int64(len(content))
+		Expect(DB.Create(&fs.FileData{
+			FileMeta: *m,
+			Data:     []byte(content),
+			Model:    fs.Model{CreatedAt: created, UpdatedAt: created},
+		}).Error).ShouldNot(HaveOccurred())
+		return m.ID
+	}
+
+	// deletedAt returns when the file with key was marked as deleted, the time is nil for live files
+	deletedAt := func(model interface{}, key string) *time.Time {
+		infos := make([]*fs.FileInfo, 0, 1)
+		Expect(DB.Unscoped().Model(model).Select("deleted_at").Where("id = ?", key).Scan(&infos).Error).ShouldNot(HaveOccurred())
+		Expect(infos).Should(HaveLen(1))
+		return infos[0].DeletedAt
+	}
+
+	Context("Inspecting files", func() {
+		It("should list live or deleted files of an owner", func() {
+			storeFile("/docs/a.txt", "a")
+			storeFile("/docs/b.txt", "b")
+			a := newAdmin(backendFiles)
+			Expect(a.run("delete", []string{"/docs/b.txt"})).ShouldNot(HaveOccurred())
+
+			out.Reset()
+			Expect(a.run("list", []string{"-owner", testOwner})).ShouldNot(HaveOccurred())
+			Expect(out.String()).Should(ContainSubstring("/docs/a.txt"))
+			Expect(out.String()).ShouldNot(ContainSubstring("/docs/b.txt"))
+
+			out.Reset()
+			Expect(a.run("list", []string{"-owner", testOwner, "-deleted"})).ShouldNot(HaveOccurred())
+			Expect(out.String()).ShouldNot(ContainSubstring("/docs/a.txt"))
+			Expect(out.String()).Should(ContainSubstring("/docs/b.txt"))
+		})
+
+		It("should show the key, metadata and disk state of a file", func() {
+			key := storeFile("/docs/report.txt", "report")
+
+			Expect(newAdmin(backendFiles).run("show", []string{"/docs/report.txt"})).ShouldNot(HaveOccurred())
+			Expect(out.String()).Should(ContainSubstring(key))
+			Expect(out.String()).Should(MatchRegexp(`owner:\s+` + testOwner))
+			Expect(out.String()).Should(MatchRegexp(`disk:\s+stored, 6 bytes`))
+		})
+
+		It("should fail to show a file that is not stored", func() {
+			a := newAdmin(backendFiles)
+			Expect(a.run("show", []string{"/docs/missing.txt"})).Should(HaveOccurred())
+			Expect(out.String()).Should(MatchRegexp(`disk:\s+missing`))
+
+			Expect(a.run("show", nil)).Should(HaveOccurred())
+		})
+
+		It("should print the storage used per owner", func() {
+			storeData("/docs/a.txt", "abc", time.Now())
+			storeData("/docs/b.txt", "de", time.Now())
+
+			Expect(newAdmin(backendDB).run("usage", nil)).ShouldNot(HaveOccurred())
+			Expect(out.String()).Should(MatchRegexp(testOwner + `\s+2\s+5\n`))
+		})
+
+		It("should fail on unknown commands", func() {
+			Expect(newAdmin(backendFiles).run("shred", nil)).Should(HaveOccurred())
+		})
+	})
+
+	Context("Deleting and restoring files", func() {
+		It("should move deleted files to the trash and restore them", func() {
+			key := storeFile("/docs/a.txt", "a")
+			a := newAdmin(backendFiles)
+
+			Expect(a.run("delete", []string{"/docs/a.txt"})).ShouldNot(HaveOccurred())
+			Expect(filepath.Join(dir, key)).ShouldNot(BeAnExistingFile())
+			Expect(filepath.Join(dir, trashDirName, key)).Should(BeAnExistingFile())
+			Expect(deletedAt(&fs.FileInfo{}, key)).ShouldNot(BeNil())
+
+			Expect(a.run("restore", []string{"/docs/a.txt"})).ShouldNot(HaveOccurred())
+			Expect(filepath.Join(dir, key)).Should(BeAnExistingFile())
+			Expect(filepath.Join(dir, trashDirName, key)).ShouldNot(BeAnExistingFile())
+			Expect(deletedAt(&fs.FileInfo{}, key)).Should(BeNil())
+		})
+
+		It("should not restore over a file stored again at the path", func() {
+			key := storeFile("/docs/a.txt", "old")
+			a := newAdmin(backendFiles)
+			Expect(a.run("delete", []string{"/docs/a.txt"})).ShouldNot(HaveOccurred())
+
+			storeFile("/docs/a.txt", "new")
+			Expect(a.run("restore", []string{"/docs/a.txt"})).Should(HaveOccurred())
+
+			bs, err := ioutil.ReadFile(filepath.Join(dir, key))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(string(bs)).Should(Equal("new"))
+		})
+
+		It("should remove purged files for good", func() {
+			key := storeFile("/docs/a.txt", "a")
+			a := newAdmin(backendFiles)
+
+			Expect(a.run("delete", []string{"-purge", "/docs/a.txt"})).ShouldNot(HaveOccurred())
+			Expect(filepath.Join(dir, key)).ShouldNot(BeAnExistingFile())
+			Expect(filepath.Join(dir, trashDirName, key)).ShouldNot(BeAnExistingFile())
+
+			count := 0
+			Expect(DB.Unscoped().Model(&fs.FileInfo{}).Where("id = ?", key).Count(&count).Error).ShouldNot(HaveOccurred())
+			Expect(count).Should(BeZero())
+
+			Expect(a.run("restore", []string{"/docs/a.txt"})).Should(HaveOccurred())
+		})
+
+		It("should delete and restore files in database storage", func() {
+			key := storeData("/docs/a.txt", "a", time.Now())
+			a := newAdmin(backendDB)
+
+			Expect(a.run("delete", []string{"/docs/a.txt"})).ShouldNot(HaveOccurred())
+			Expect(deletedAt(&fs.FileData{}, key)).ShouldNot(BeNil())
+
+			Expect(a.run("restore", []string{"/docs/a.txt"})).ShouldNot(HaveOccurred())
+			Expect(deletedAt(&fs.FileData{}, key)).Should(BeNil())
+		})
+
+		It("should fail for paths without a file", func() {
+			a := newAdmin(backendFiles)
+			Expect(a.run("delete", []string{"/docs/missing.txt"})).Should(HaveOccurred())
+			Expect(a.run("restore", []string{"/docs/missing.txt"})).Should(HaveOccurred())
+			Expect(a.run("delete", nil)).Should(HaveOccurred())
+		})
+	})
+
+	Context("Moving files between backends", func() {
+		It("should export files with their metadata and skip existing files", func() {
+			created := time.Now().Add(-time.Hour).Truncate(time.Second)
+			key := storeData("/docs/a.txt", "a", created)
+			a := newAdmin(backendDB)
+
+			Expect(a.run("export", []string{"-owner", testOwner})).ShouldNot(HaveOccurred())
+			Expect(out.String()).Should(ContainSubstring("exported 1 files, skipped 0 existing files"))
+
+			bs, err := ioutil.ReadFile(filepath.Join(dir, key))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(string(bs)).Should(Equal("a"))
+
+			fileInfo := &fs.FileInfo{}
+			Expect(DB.First(fileInfo, "id = ?", key).Error).ShouldNot(HaveOccurred())
+			Expect(fileInfo.Path).Should(Equal("/docs/a.txt"))
+			Expect(fileInfo.CreatedAt.Unix()).Should(Equal(created.Unix()))
+
+			// nothing is left in the staging directory of the files handler
+			finfos, err := ioutil.ReadDir(filepath.Join(dir, ".staging"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(finfos).Should(BeEmpty())
+
+			out.Reset()
+			Expect(a.run("export", []string{"-owner", testOwner})).ShouldNot(HaveOccurred())
+			Expect(out.String()).Should(ContainSubstring("exported 0 files, skipped 1 existing files"))
+
+			out.Reset()
+			Expect(a.run("export", []string{"-owner", testOwner, "-overwrite"})).ShouldNot(HaveOccurred())
+			Expect(out.String()).Should(ContainSubstring("exported 1 files, skipped 0 existing files"))
+		})
+
+		It("should import files and count those missing on disk", func() {
+			key := storeFile("/docs/a.txt", "a")
+			missing := storeFile("/docs/b.txt", "b")
+			Expect(os.Remove(filepath.Join(dir, missing))).ShouldNot(HaveOccurred())
+
+			Expect(newAdmin(backendFiles).run("import", []string{"-owner", testOwner})).ShouldNot(HaveOccurred())
+			Expect(out.String()).Should(ContainSubstring("imported 1 files, skipped 0 existing files, 1 missing on disk"))
+
+			data := &fs.FileData{}
+			Expect(DB.First(data, "id = ?", key).Error).ShouldNot(HaveOccurred())
+			Expect(string(data.Data)).Should(Equal("a"))
+		})
+	})
+
+	Context("Detecting content types", func() {
+		It("should update changed types unless it is a dry run", func() {
+			key := storeData("/docs/page.html", "<html><body>page</body></html>", time.Now())
+			a := newAdmin(backendDB)
+
+			Expect(a.run("resniff", []string{"-owner", testOwner, "-dry-run"})).ShouldNot(HaveOccurred())
+			Expect(out.String()).Should(ContainSubstring("1 of 1 files changed type"))
+
+			data := &fs.FileData{}
+			Expect(DB.First(data, "id = ?", key).Error).ShouldNot(HaveOccurred())
+			Expect(data.Mime).Should(Equal("text/plain; charset=utf-8"))
+
+			Expect(a.run("resniff", []string{"-owner", testOwner})).ShouldNot(HaveOccurred())
+			Expect(DB.First(data, "id = ?", key).Error).ShouldNot(HaveOccurred())
+			Expect(data.Mime).Should(Equal("text/html; charset=utf-8"))
+		})
+	})
+})
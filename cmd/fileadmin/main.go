@@ -0,0 +1,198 @@
+// Command fileadmin inspects and manages files stored by the file handlers, against the same database and directories.
+//
+// Usage:
+//
+//	fileadmin -dsn <dsn> [-dialect mysql] [-backend files|dbstorage] [-dir <upload dir>] [-redis <addr>] <command> [flags] [args]
+//
+// Commands:
+//
+//	list [-owner id] [-tag tag] [-deleted]        list stored files
+//	show <path>                                   show the key and metadata of the file at a path
+//	delete [-purge] <path>...                     delete files, they can be restored unless purged
+//	restore <path>...                             restore files deleted by fileadmin or the dbstorage handler
+//	export [-owner id] [-tag tag] [-overwrite]    copy files from database storage to the upload directory
+//	import [-owner id] [-tag tag] [-overwrite]    copy files from the upload directory to database storage
+//	resniff [-owner id] [-tag tag] [-dry-run]     detect content types of stored files again
+//	usage                                         print storage used per owner
+//
+// Paths are URL paths relative to where the handler is mounted, they give the same keys as in the handlers.
+//
+// The dbstorage handler only marks deleted files, so restore brings back its deletes as well as those of fileadmin.
+// The files handler removes deleted files for good and cannot be restored. With the files backend, delete moves files
+// to a .trash directory next to the stored files that the handlers know nothing of: they report trashed files as missing,
+// and a file uploaded again at the same path replaces the deleted one, which can then only be purged.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	"github.com/pkg/errors"
+	"os"
+)
+
+func main() {
+	err := run()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fileadmin:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var (
+		dialect   = flag.String("dialect", "mysql", "database dialect")
+		dsn       = flag.String("dsn", os.Getenv("FILEADMIN_DSN"), "database connection string, defaults to $FILEADMIN_DSN")
+		backend   = flag.String("backend", backendFiles, "storage backend: "+backendFiles+" or "+backendDB)
+		dir       = flag.String("dir", os.Getenv("FILEADMIN_DIR"), "upload directory of the files backend, defaults to $FILEADMIN_DIR")
+		redisAddr = flag.String("redis", os.Getenv("FILEADMIN_REDIS"), "redis address of the dbstorage backend cache, defaults to $FILEADMIN_REDIS")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] list|show|delete|restore|export|import|resniff|usage [flags] [args]\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output(), "restore only brings back files deleted by fileadmin or the dbstorage handler, "+
+			"files deleted by the files handler are gone and handlers do not see the "+trashDirName+" directory")
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		return errors.New("missing command")
+	}
+
+	if *dsn == "" {
+		return errors.New("missing database connection string")
+	}
+
+	command, args := flag.Arg(0), flag.Args()[1:]
+
+	switch *backend {
+	case backendFiles, backendDB:
+	default:
+		return errors.Errorf("unknown backend %q", *backend)
+	}
+
+	// export and import always move files between both backends
+	needsDir := *backend == backendFiles || command == "export" || command == "import"
+	if needsDir && *dir == "" {
+		return errors.New("missing upload directory")
+	}
+
+	db, err := gorm.Open(*dialect, *dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	a := &admin{
+		db:      db,
+		backend: *backend,
+		dir:     *dir,
+		out:     os.Stdout,
+	}
+
+	if *redisAddr != "" {
+		a.redisClient = redis.NewClient(&redis.Options{Addr: *redisAddr})
+		defer a.redisClient.Close()
+	}
+
+	return a.run(command, args)
+}
+
+// run parses the flags of a command and runs it
+func (a *admin) run(command string, args []string) error {
+	fset := flag.NewFlagSet(command, flag.ContinueOnError)
+	f := &filter{}
+
+	switch command {
+	case "list":
+		addFilterFlags(fset, f)
+		fset.BoolVar(&f.deleted, "deleted", false, "list deleted files instead")
+		err := fset.Parse(args)
+		if err != nil {
+			return err
+		}
+		return a.list(f)
+
+	case "show":
+		err := fset.Parse(args)
+		if err != nil {
+			return err
+		}
+		if fset.NArg() != 1 {
+			return errors.New("show takes one path")
+		}
+		return a.show(fset.Arg(0))
+
+	case "delete", "restore":
+		purge := false
+		if command == "delete" {
+			fset.BoolVar(&purge, "purge", false, "remove files for good")
+		} else {
+			fset.Usage = func() {
+				fmt.Fprintln(fset.Output(), "usage: restore <path>...\nrestores files deleted by fileadmin or the dbstorage handler, files deleted by the files handler cannot be restored")
+			}
+		}
+		err := fset.Parse(args)
+		if err != nil {
+			return err
+		}
+		if fset.NArg() == 0 {
+			return errors.Errorf("%s takes one or more paths", command)
+		}
+		failed := 0
+		for _, upath := range fset.Args() {
+			if command == "delete" {
+				err = a.delete(upath, purge)
+			} else {
+				err = a.restore(upath)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return errors.Errorf("failed to %s %d of %d files", command, failed, fset.NArg())
+		}
+		return nil
+
+	case "export", "import":
+		addFilterFlags(fset, f)
+		overwrite := fset.Bool("overwrite", false, "replace files that already exist at the destination")
+		err := fset.Parse(args)
+		if err != nil {
+			return err
+		}
+		if command == "export" {
+			return a.export(f, *overwrite)
+		}
+		return a.importFiles(f, *overwrite)
+
+	case "resniff":
+		addFilterFlags(fset, f)
+		dryRun := fset.Bool("dry-run", false, "print changed types without updating them")
+		err := fset.Parse(args)
+		if err != nil {
+			return err
+		}
+		return a.resniff(f, *dryRun)
+
+	case "usage":
+		err := fset.Parse(args)
+		if err != nil {
+			return err
+		}
+		return a.usage()
+	}
+
+	return errors.Errorf("unknown command %q", command)
+}
+
+func addFilterFlags(fset *flag.FlagSet, f *filter) {
+	fset.StringVar(&f.ownerID, "owner", "", "only files of the owner")
+	fset.StringVar(&f.ownerTag, "tag", "", "only files with the owner tag")
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix is the prefix of environment variables that override the configuration file
+const envPrefix = "FILESERVER_"
+
+// Backends of mounts
+const (
+	backendStatic = "static"
+	backendFiles  = "files"
+	backendDB     = "dbstorage"
+)
+
+// config is the configuration of the file server
+type config struct {
+	Addr            string        `yaml:"addr" toml:"addr"`
+	HTTP2           *bool         `yaml:"http2" toml:"http2"` // defaults to true, without TLS HTTP/2 is served in clear text
+	ShutdownTimeout string        `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	ReadTimeout     string        `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout    string        `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout     string        `yaml:"idle_timeout" toml:"idle_timeout"`
+	TLS             tlsConfig     `yaml:"tls" toml:"tls"`
+	DB              dbConfig      `yaml:"db" toml:"db"`
+	Redis           redisConfig   `yaml:"redis" toml:"redis"`
+	API             apiConfig     `yaml:"api" toml:"api"`
+	Limits          limitsConfig  `yaml:"limits" toml:"limits"`
+	Mounts          []mountConfig `yaml:"mounts" toml:"mounts"`
+}
+
+type tlsConfig struct {
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file"`
+}
+
+type dbConfig struct {
+	Dialect        string `yaml:"dialect" toml:"dialect"` // defaults to mysql
+	DSN            string `yaml:"dsn" toml:"dsn"`
+	SkipMigrations bool   `yaml:"skip_migrations" toml:"skip_migrations"`
+}
+
+type redisConfig struct {
+	Addr     string `yaml:"addr" toml:"addr"`
+	Password string `yaml:"password" toml:"password"`
+	DB       int    `yaml:"db" toml:"db"`
+}
+
+type apiConfig struct {
+	Prefix string `yaml:"prefix" toml:"prefix"`
+	Token  string `yaml:"token" toml:"token"` // bearer token of management requests, only reads are allowed without it
+}
+
+type limitsConfig struct {
+	MaxUploadSize       int      `yaml:"max_upload_size" toml:"max_upload_size"`
+	MaxArchiveSize      int64    `yaml:"max_archive_size" toml:"max_archive_size"`
+	MaxArchiveEntries   int      `yaml:"max_archive_entries" toml:"max_archive_entries"`
+	MaxBatchConcurrency int      `yaml:"max_batch_concurrency" toml:"max_batch_concurrency"`
+	MaxRedisFileSize    int      `yaml:"max_redis_file_size" toml:"max_redis_file_size"`
+	AllowedMimeTypes    []string `yaml:"allowed_mime_types" toml:"allowed_mime_types"`
+}
+
+// mountConfig is a backend served at a URL path prefix
+type mountConfig struct {
+	Prefix  string `yaml:"prefix" toml:"prefix"`
+	Backend string `yaml:"backend" toml:"backend"` // static, files or dbstorage
+	Root    string `yaml:"root" toml:"root"`       // root directory of static and files backends
+
+	// static backend
+	Index            string   `yaml:"index" toml:"index"`
+	AllowedDirs      []string `yaml:"allowed_dirs" toml:"allowed_dirs"`
+	FallBackIndex    bool     `yaml:"fallback_index" toml:"fallback_index"`
+	DirectoryListing bool     `yaml:"directory_listing" toml:"directory_listing"`
+	DenyPatterns     []string `yaml:"deny_patterns" toml:"deny_patterns"`
+	Preload          []string `yaml:"preload" toml:"preload"`
+	Watch            bool     `yaml:"watch" toml:"watch"`
+	RuntimeEnv       string   `yaml:"runtime_env_prefix" toml:"runtime_env_prefix"`
+
+	// files backend
+	UploadDir string `yaml:"upload_dir" toml:"upload_dir"`
+}
+
+// loadConfig reads the configuration file, in YAML or TOML by its extension, and applies environment overrides.
+// Without a file the configuration comes from the environment only
+func loadConfig(file string) (*config, error) {
+	cfg := &config{}
+
+	if file != "" {
+		bs, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read config file")
+		}
+
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".yaml", ".yml":
+			err = yaml.UnmarshalStrict(bs, cfg)
+		case ".toml":
+			var md toml.MetaData
+			md, err = toml.Decode(string(bs), cfg)
+			if err == nil && len(md.Undecoded()) > 0 {
+				err = errors.Errorf("unknown keys %v", md.Undecoded())
+			}
+		default:
+			return nil, errors.Errorf("unknown config file format %q, use .yaml, .yml or .toml", filepath.Ext(file))
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse config file")
+		}
+	}
+
+	err := cfg.applyEnv(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.setDefaults()
+
+	return cfg, cfg.validate()
+}
+
+// applyEnv overrides settings with FILESERVER_ environment variables. Every setting outside mounts has a variable,
+// named after its key without the section for limits, and ALLOWED_MIME_TYPES is a comma separated list
+func (cfg *config) applyEnv(lookup func(string) (string, bool)) error {
+	setString := func(dst *string) func(string) error {
+		return func(v string) error {
+			*dst = v
+			return nil
+		}
+	}
+	setInt := func(dst *int) func(string) error {
+		return func(v string) error {
+			n, err := strconv.Atoi(v)
+			*dst = n
+			return err
+		}
+	}
+	setInt64 := func(dst *int64) func(string) error {
+		return func(v string) error {
+			n, err := strconv.ParseInt(v, 10, 64)
+			*dst = n
+			return err
+		}
+	}
+	setBool := func(dst *bool) func(string) error {
+		return func(v string) error {
+			b, err := strconv.ParseBool(v)
+			*dst = b
+			return err
+		}
+	}
+
+	overrides := []struct {
+		name string
+		set  func(string) error
+	}{
+		{"ADDR", setString(&cfg.Addr)},
+		{"HTTP2", func(v string) error {
+			b, err := strconv.ParseBool(v)
+			cfg.HTTP2 = &b
+			return err
+		}},
+		{"SHUTDOWN_TIMEOUT", setString(&cfg.ShutdownTimeout)},
+		{"READ_TIMEOUT", setString(&cfg.ReadTimeout)},
+		{"WRITE_TIMEOUT", setString(&cfg.WriteTimeout)},
+		{"IDLE_TIMEOUT", setString(&cfg.IdleTimeout)},
+		{"TLS_CERT_FILE", setString(&cfg.TLS.CertFile)},
+		{"TLS_KEY_FILE", setString(&cfg.TLS.KeyFile)},
+		{"DB_DIALECT", setString(&cfg.DB.Dialect)},
+		{"DB_DSN", setString(&cfg.DB.DSN)},
+		{"DB_SKIP_MIGRATIONS", setBool(&cfg.DB.SkipMigrations)},
+		{"REDIS_ADDR", setString(&cfg.Redis.Addr)},
+		{"REDIS_PASSWORD", setString(&cfg.Redis.Password)},
+		{"REDIS_DB", setInt(&cfg.Redis.DB)},
+		{"API_PREFIX", setString(&cfg.API.Prefix)},
+		{"API_TOKEN", setString(&cfg.API.Token)},
+		{"MAX_UPLOAD_SIZE", setInt(&cfg.Limits.MaxUploadSize)},
+		{"MAX_ARCHIVE_SIZE", setInt64(&cfg.Limits.MaxArchiveSize)},
+		{"MAX_ARCHIVE_ENTRIES", setInt(&cfg.Limits.MaxArchiveEntries)},
+		{"MAX_BATCH_CONCURRENCY", setInt(&cfg.Limits.MaxBatchConcurrency)},
+		{"MAX_REDIS_FILE_SIZE", setInt(&cfg.Limits.MaxRedisFileSize)},
+		{"ALLOWED_MIME_TYPES", func(v string) error {
+			cfg.Limits.AllowedMimeTypes = nil
+			for _, mimeType := range strings.Split(v, ",") {
+				if mimeType = strings.TrimSpace(mimeType); mimeType != "" {
+					cfg.Limits.AllowedMimeTypes = append(cfg.Limits.AllowedMimeTypes, mimeType)
+				}
+			}
+			return nil
+		}},
+	}
+
+	for _, override := range overrides {
+		v, ok := lookup(envPrefix + override.name)
+		if !ok {
+			continue
+		}
+		err := override.set(v)
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s%s", envPrefix, override.name)
+		}
+	}
+
+	return nil
+}
+
+func (cfg *config) setDefaults() {
+	if cfg.Addr == "" {
+		cfg.Addr = ":8080"
+	}
+	if cfg.HTTP2 == nil {
+		http2 := true
+		cfg.HTTP2 = &http2
+	}
+	if cfg.ShutdownTimeout == "" {
+		cfg.ShutdownTimeout = "30s"
+	}
+	if cfg.DB.Dialect == "" {
+		cfg.DB.Dialect = "mysql"
+	}
+}
+
+// validate checks the configuration without connecting to any service
+func (cfg *config) validate() error {
+	for name, value := range map[string]string{
+		"shutdown_timeout": cfg.ShutdownTimeout,
+		"read_timeout":     cfg.ReadTimeout,
+		"write_timeout":    cfg.WriteTimeout,
+		"idle_timeout":     cfg.IdleTimeout,
+	} {
+		if _, err := parseDuration(value); err != nil {
+			return errors.Wrapf(err, "invalid %s", name)
+		}
+	}
+
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		return errors.New("tls needs both cert_file and key_file")
+	}
+
+	if len(cfg.Mounts) == 0 {
+		return errors.New("no mounts configured")
+	}
+
+	prefixes := make(map[string]struct{}, len(cfg.Mounts))
+	for i, m := range cfg.Mounts {
+		prefix := path.Clean("/" + m.Prefix)
+		if _, ok := prefixes[prefix]; ok {
+			return errors.Errorf("mount %d: prefix %s is mounted more than once", i, prefix)
+		}
+		prefixes[prefix] = struct{}{}
+
+		switch m.Backend {
+		case backendStatic, backendFiles:
+			finfo, err := os.Stat(m.Root)
+			if err != nil {
+				return errors.Wrapf(err, "mount %s: invalid root", prefix)
+			}
+			if !finfo.IsDir() {
+				return errors.Errorf("mount %s: root %s is not a directory", prefix, m.Root)
+			}
+		case backendDB:
+			if cfg.DB.DSN == "" {
+				return errors.Errorf("mount %s: the dbstorage backend needs a database dsn", prefix)
+			}
+		default:
+			return errors.Errorf("mount %s: unknown backend %q", prefix, m.Backend)
+		}
+	}
+
+	return nil
+}
+
+// parseDuration parses a duration that may be empty
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(value)
+}
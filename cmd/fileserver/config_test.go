@@ -0,0 +1,336 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var _ = Describe("Loading configuration", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "fileserver")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(os.Mkdir(filepath.Join(dir, "public"), 0755)).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	// writeConfig writes a configuration file in dir and returns its path
+	writeConfig := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(file, []byte(content), 0644)).ShouldNot(HaveOccurred())
+		return file
+	}
+
+	Context("Parsing files", func() {
+		cases := []struct {
+			desc    string
+			name    string
+			content string
+			err     string
+		}{
+			{
+				desc: "a YAML file",
+				name: "fileserver.yaml",
+				content: `
+addr: ":9090"
+limits:
+  max_upload_size: 1024
+mounts:
+  - prefix: /public
+    backend: static
+    root: ROOT
+`,
+			},
+			{
+				desc: "a TOML file",
+				name: "fileserver.toml",
+				content: `
+addr = ":9090"
+
+[limits]
+max_upload_size = 1024
+
+[[mounts]]
+prefix = "/public"
+backend = "static"
+root = "ROOT"
+`,
+			},
+			{
+				desc: "a YAML file with an unknown key",
+				name: "fileserver.yml",
+				content: `
+addr: ":9090"
+adress: ":9091"
+`,
+				err: "failed to parse config file",
+			},
+			{
+				desc: "a TOML file with an unknown key",
+				name: "fileserver.toml",
+				content: `
+addr = ":9090"
+
+[limits]
+max_uplaod_size = 1024
+`,
+				err: "unknown keys",
+			},
+			{
+				desc: "a YAML file with a value of the wrong type",
+				name: "fileserver.yaml",
+				content: `
+limits:
+  max_upload_size: large
+`,
+				err: "failed to parse config file",
+			},
+			{
+				desc:    "a file of an unknown format",
+				name:    "fileserver.json",
+				content: `{"addr": ":9090"}`,
+				err:     "unknown config file format",
+			},
+		}
+
+		for _, c := range cases {
+			c := c
+			It("should load "+c.desc, func() {
+				content := c.content
+				if c.err == "" {
+					content = replaceRoot(content, filepath.Join(dir, "public"))
+				}
+
+				cfg, err := loadConfig(writeConfig(c.name, content))
+				if c.err != "" {
+					Expect(err).Should(HaveOccurred())
+					Expect(err.Error()).Should(ContainSubstring(c.err))
+					return
+				}
+
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cfg.Addr).Should(Equal(":9090"))
+				Expect(cfg.Limits.MaxUploadSize).Should(Equal(1024))
+				Expect(cfg.Mounts).Should(HaveLen(1))
+				Expect(cfg.Mounts[0].Backend).Should(Equal(backendStatic))
+			})
+		}
+
+		It("should fail when the file does not exist", func() {
+			_, err := loadConfig(filepath.Join(dir, "missing.yaml"))
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should apply environment overrides and defaults after the file", func() {
+			file := writeConfig("fileserver.yaml", `
+addr: ":9090"
+mounts:
+  - prefix: /public
+    backend: static
+    root: `+filepath.Join(dir, "public")+`
+`)
+
+			Expect(os.Setenv(envPrefix+"ADDR", ":7070")).ShouldNot(HaveOccurred())
+			defer os.Unsetenv(envPrefix + "ADDR")
+
+			cfg, err := loadConfig(file)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(cfg.Addr).Should(Equal(":7070"))
+			Expect(*cfg.HTTP2).Should(BeTrue())
+			Expect(cfg.ShutdownTimeout).Should(Equal("30s"))
+			Expect(cfg.DB.Dialect).Should(Equal("mysql"))
+		})
+	})
+
+	Context("Overriding with environment variables", func() {
+		// lookup looks up variables in env
+		lookup := func(env map[string]string) func(string) (string, bool) {
+			return func(name string) (string, bool) {
+				v, ok := env[name]
+				return v, ok
+			}
+		}
+
+		It("should override settings that are set", func() {
+			cfg := &config{
+				Addr:  ":9090",
+				Redis: redisConfig{Addr: "localhost:6379"},
+			}
+
+			err := cfg.applyEnv(lookup(map[string]string{
+				"FILESERVER_HTTP2":                 "false",
+				"FILESERVER_READ_TIMEOUT":          "5s",
+				"FILESERVER_DB_DSN":                "user@/files",
+				"FILESERVER_DB_SKIP_MIGRATIONS":    "true",
+				"FILESERVER_REDIS_DB":              "2",
+				"FILESERVER_API_TOKEN":             "secret",
+				"FILESERVER_MAX_UPLOAD_SIZE":       "1024",
+				"FILESERVER_MAX_ARCHIVE_SIZE":      "8589934592",
+				"FILESERVER_MAX_ARCHIVE_ENTRIES":   "10",
+				"FILESERVER_MAX_BATCH_CONCURRENCY": "2",
+				"FILESERVER_MAX_REDIS_FILE_SIZE":   "2048",
+				"FILESERVER_ALLOWED_MIME_TYPES":    "image/*, application/pdf,",
+			}))
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(cfg.Addr).Should(Equal(":9090"))
+			Expect(cfg.Redis.Addr).Should(Equal("localhost:6379"))
+			Expect(*cfg.HTTP2).Should(BeFalse())
+			Expect(cfg.ReadTimeout).Should(Equal("5s"))
+			Expect(cfg.DB.DSN).Should(Equal("user@/files"))
+			Expect(cfg.DB.SkipMigrations).Should(BeTrue())
+			Expect(cfg.Redis.DB).Should(Equal(2))
+			Expect(cfg.API.Token).Should(Equal("secret"))
+			Expect(cfg.Limits).Should(Equal(limitsConfig{
+				MaxUploadSize:       1024,
+				MaxArchiveSize:      8589934592,
+				MaxArchiveEntries:   10,
+				MaxBatchConcurrency: 2,
+				MaxRedisFileSize:    2048,
+				AllowedMimeTypes:    []string{"image/*", "application/pdf"},
+			}))
+		})
+
+		invalid := []struct {
+			name  string
+			value string
+		}{
+			{"HTTP2", "sometimes"},
+			{"DB_SKIP_MIGRATIONS", "perhaps"},
+			{"REDIS_DB", "first"},
+			{"MAX_UPLOAD_SIZE", "8mb"},
+			{"MAX_ARCHIVE_SIZE", "-"},
+			{"MAX_ARCHIVE_ENTRIES", "1.5"},
+			{"MAX_BATCH_CONCURRENCY", ""},
+			{"MAX_REDIS_FILE_SIZE", "99999999999999999999"},
+		}
+
+		for _, c := range invalid {
+			c := c
+			It("should fail on an invalid "+envPrefix+c.name, func() {
+				err := (&config{}).applyEnv(lookup(map[string]string{envPrefix + c.name: c.value}))
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("invalid " + envPrefix + c.name))
+			})
+		}
+	})
+
+	Context("Validating", func() {
+		// valid returns a configuration that passes validation
+		valid := func() *config {
+			cfg := &config{
+				Mounts: []mountConfig{
+					{Prefix: "/public", Backend: backendStatic, Root: filepath.Join(dir, "public")},
+				},
+			}
+			cfg.setDefaults()
+			return cfg
+		}
+
+		It("should pass a valid configuration", func() {
+			Expect(valid().validate()).ShouldNot(HaveOccurred())
+		})
+
+		cases := []struct {
+			desc   string
+			modify func(cfg *config)
+			err    string
+		}{
+			{
+				desc:   "an invalid timeout",
+				modify: func(cfg *config) { cfg.IdleTimeout = "2 minutes" },
+				err:    "invalid idle_timeout",
+			},
+			{
+				desc:   "a certificate without a key",
+				modify: func(cfg *config) { cfg.TLS.CertFile = "cert.pem" },
+				err:    "tls needs both cert_file and key_file",
+			},
+			{
+				desc:   "no mounts",
+				modify: func(cfg *config) { cfg.Mounts = nil },
+				err:    "no mounts configured",
+			},
+			{
+				desc: "a prefix mounted twice",
+				modify: func(cfg *config) {
+					cfg.Mounts = append(cfg.Mounts, mountConfig{Prefix: "public/", Backend: backendFiles, Root: cfg.Mounts[0].Root})
+				},
+				err: "prefix /public is mounted more than once",
+			},
+			{
+				desc:   "a missing root",
+				modify: func(cfg *config) { cfg.Mounts[0].Root = filepath.Join(dir, "missing") },
+				err:    "mount /public: invalid root",
+			},
+			{
+				desc: "a root that is a file",
+				modify: func(cfg *config) {
+					cfg.Mounts[0].Root = writeConfig("file.txt", "")
+				},
+				err: "is not a directory",
+			},
+			{
+				desc:   "a dbstorage mount without a database",
+				modify: func(cfg *config) { cfg.Mounts[0] = mountConfig{Prefix: "/db", Backend: backendDB} },
+				err:    "mount /db: the dbstorage backend needs a database dsn",
+			},
+			{
+				desc:   "an unknown backend",
+				modify: func(cfg *config) { cfg.Mounts[0].Backend = "ftp" },
+				err:    `unknown backend "ftp"`,
+			},
+		}
+
+		for _, c := range cases {
+			c := c
+			It("should fail on "+c.desc, func() {
+				cfg := valid()
+				c.modify(cfg)
+
+				err := cfg.validate()
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring(c.err))
+			})
+		}
+	})
+
+	Context("Checking", func() {
+		It("should build the mounts of a valid configuration", func() {
+			cfg := &config{
+				Mounts: []mountConfig{
+					{Prefix: "/public", Backend: backendStatic, Root: filepath.Join(dir, "public")},
+				},
+			}
+			cfg.setDefaults()
+
+			Expect(check(cfg)).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail on a mount whose handler cannot be created", func() {
+			cfg := &config{
+				Mounts: []mountConfig{
+					{Prefix: "/files", Backend: backendFiles, Root: filepath.Join(dir, "public"), UploadDir: "missing"},
+				},
+			}
+			cfg.setDefaults()
+			Expect(cfg.validate()).ShouldNot(HaveOccurred())
+
+			err := check(cfg)
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("failed to mount /files"))
+		})
+	})
+})
+
+// replaceRoot replaces the ROOT placeholder of a configuration with root
+func replaceRoot(content, root string) string {
+	return strings.Replace(content, "ROOT", root, -1)
+}
@@ -0,0 +1,296 @@
+// Command fileserver serves static files and stored files of the file handlers from a configuration file.
+//
+// Usage:
+//
+//	fileserver [-config fileserver.yaml] [--check-config]
+//
+// Settings of the YAML or TOML configuration file can be overridden with FILESERVER_ environment variables named
+// after their keys, such as FILESERVER_ADDR, FILESERVER_DB_DSN, FILESERVER_REDIS_ADDR or FILESERVER_MAX_UPLOAD_SIZE.
+// Limits drop their section and FILESERVER_ALLOWED_MIME_TYPES is a comma separated list. Mounts are only read from
+// the file. The server shuts down gracefully on SIGTERM and SIGINT.
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/gidyon/file-handlers/dbstorage"
+	file "github.com/gidyon/file-handlers/filehandler"
+	"github.com/gidyon/file-handlers/server"
+	"github.com/gidyon/file-handlers/static"
+	"github.com/go-redis/redis"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	err := run()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fileserver:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var (
+		configFile  = flag.String("config", os.Getenv(envPrefix+"CONFIG"), "YAML or TOML configuration file, defaults to $"+envPrefix+"CONFIG")
+		checkConfig = flag.Bool("check-config", false, "validate the configuration, connections to services and mounts without applying migrations, then exit")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+
+	if *checkConfig {
+		err = check(cfg)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "configuration ok: %d mounts on %s\n", len(cfg.Mounts), cfg.Addr)
+		return nil
+	}
+
+	return serve(cfg)
+}
+
+// check connects to the configured services, loads TLS certificates and builds the mounts without serving.
+// Migrations are not applied
+func check(cfg *config) error {
+	if cfg.TLS.CertFile != "" {
+		_, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to load TLS certificate")
+		}
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	if db != nil {
+		defer db.Close()
+	}
+
+	redisClient, err := openRedis(cfg)
+	if err != nil {
+		return err
+	}
+	if redisClient != nil {
+		defer redisClient.Close()
+	}
+
+	// a dry run leaves the schema as it is
+	dry := *cfg
+	dry.DB.SkipMigrations = true
+
+	srv, err := newServer(&dry, db, redisClient)
+	if err != nil {
+		return err
+	}
+
+	return srv.Close()
+}
+
+// openDB connects to the database, it returns nil when no database is configured
+func openDB(cfg *config) (*gorm.DB, error) {
+	if cfg.DB.DSN == "" {
+		return nil, nil
+	}
+	db, err := gorm.Open(cfg.DB.Dialect, cfg.DB.DSN)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to database")
+	}
+	return db, nil
+}
+
+// openRedis connects to redis, it returns nil when no redis address is configured
+func openRedis(cfg *config) (*redis.Client, error) {
+	if cfg.Redis.Addr == "" {
+		return nil, nil
+	}
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	err := redisClient.Ping().Err()
+	if err != nil {
+		redisClient.Close()
+		return nil, errors.Wrap(err, "failed to connect to redis")
+	}
+	return redisClient, nil
+}
+
+// applyLimits sets the limits of the file handlers, it must be called before the handlers are created
+func applyLimits(cfg *config) {
+	limits := cfg.Limits
+
+	file.SetMaxUploadSize(limits.MaxUploadSize)
+	file.SetMaxArchiveSize(limits.MaxArchiveSize)
+	file.SetMaxArchiveEntries(limits.MaxArchiveEntries)
+	file.SetMaxBatchConcurrency(limits.MaxBatchConcurrency)
+	file.SetAllowedMimeTypes(limits.AllowedMimeTypes...)
+
+	dbstorage.SetMaxFileUploadSize(limits.MaxUploadSize)
+	dbstorage.SetMaxArchiveSize(limits.MaxArchiveSize)
+	dbstorage.SetMaxArchiveEntries(limits.MaxArchiveEntries)
+	dbstorage.SetMaxBatchConcurrency(limits.MaxBatchConcurrency)
+	dbstorage.SetMaxRedisFileSize(limits.MaxRedisFileSize)
+	dbstorage.SetAllowedMimeTypes(limits.AllowedMimeTypes...)
+
+	if cfg.DB.SkipMigrations {
+		file.DisableMigrations()
+		dbstorage.DisableMigrations()
+	}
+}
+
+// newServer creates the router with the configured mounts
+func newServer(cfg *config, db *gorm.DB, redisClient *redis.Client) (*server.Server, error) {
+	opt := &server.Options{APIPrefix: cfg.API.Prefix}
+	if cfg.API.Token != "" {
+		want := []byte("Bearer " + cfg.API.Token)
+		opt.APIAuth = func(r *http.Request) bool {
+			return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) == 1
+		}
+	}
+
+	srv, err := server.New(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	applyLimits(cfg)
+
+	for _, m := range cfg.Mounts {
+		switch m.Backend {
+		case backendStatic:
+			err = srv.MountStatic(&static.ServerOptions{
+				RootDir:             m.Root,
+				Index:               m.Index,
+				AllowedDirs:         m.AllowedDirs,
+				URLPathPrefix:       m.Prefix,
+				FallBackIndex:       m.FallBackIndex,
+				DirectoryListing:    m.DirectoryListing,
+				DenyPatterns:        m.DenyPatterns,
+				Preload:             m.Preload,
+				Watch:               m.Watch,
+				RuntimeConfigPrefix: m.RuntimeEnv,
+			})
+		case backendFiles:
+			err = srv.MountFiles(m.Prefix, &file.ServerOptions{
+				RootDir:     m.Root,
+				AllowedDirs: m.AllowedDirs,
+				DB:          db,
+				DefaultDir:  m.UploadDir,
+			})
+		case backendDB:
+			err = srv.MountDB(m.Prefix, db, redisClient)
+		}
+		if err != nil {
+			srv.Close()
+			return nil, errors.Wrapf(err, "failed to mount %s", m.Prefix)
+		}
+	}
+
+	return srv, nil
+}
+
+// serve serves the mounts until the process is signaled to stop
+func serve(cfg *config) error {
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	if db != nil {
+		defer db.Close()
+	}
+
+	redisClient, err := openRedis(cfg)
+	if err != nil {
+		return err
+	}
+	if redisClient != nil {
+		defer redisClient.Close()
+	}
+
+	srv, err := newServer(cfg, db, redisClient)
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+
+	// durations are validated when the config is loaded
+	shutdownTimeout, _ := parseDuration(cfg.ShutdownTimeout)
+	readTimeout, _ := parseDuration(cfg.ReadTimeout)
+	writeTimeout, _ := parseDuration(cfg.WriteTimeout)
+	idleTimeout, _ := parseDuration(cfg.IdleTimeout)
+
+	tlsEnabled := cfg.TLS.CertFile != ""
+
+	var handler http.Handler = srv
+	if *cfg.HTTP2 && !tlsEnabled {
+		// HTTP/2 without TLS is only served to clients with prior knowledge or an upgrade
+		handler = h2c.NewHandler(srv, &http2.Server{})
+	}
+
+	httpServer := &http.Server{
+		Addr:         cfg.Addr,
+		Handler:      handler,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+		IdleTimeout:  idleTimeout,
+	}
+	if !*cfg.HTTP2 {
+		// a non nil map disables HTTP/2 over TLS
+		httpServer.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		logrus.Infof("serving %d mounts on %s", len(cfg.Mounts), cfg.Addr)
+		if tlsEnabled {
+			errs <- httpServer.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		} else {
+			errs <- httpServer.ListenAndServe()
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	select {
+	case err = <-errs:
+		return err
+	case sig := <-signals:
+		logrus.Infof("received %s, shutting down", sig)
+	}
+
+	// in flight requests get until the timeout to complete
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err = httpServer.Shutdown(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to shut down gracefully")
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+// Command migrate applies, reverts and reports schema migrations of the file handlers.
+//
+// Usage:
+//
+//	migrate -dsn <dsn> [-dialect mysql] [-source filehandler|dbstorage] up|down [steps]|status
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/gidyon/file-handlers/dbstorage"
+	file "github.com/gidyon/file-handlers/filehandler"
+	"github.com/gidyon/file-handlers/migrate"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	"github.com/pkg/errors"
+	"os"
+)
+
+func main() {
+	err := run()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var (
+		dialect = flag.String("dialect", "mysql", "database dialect")
+		dsn     = flag.String("dsn", os.Getenv("MIGRATE_DSN"), "database connection string, defaults to $MIGRATE_DSN")
+		source  = flag.String("source", file.MigrationSource, "migrations to run: "+file.MigrationSource+" or "+dbstorage.MigrationSource)
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] up|down [steps]|status\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *dsn == "" {
+		return errors.New("missing database connection string")
+	}
+
+	var migrations []*migrate.Migration
+	switch *source {
+	case file.MigrationSource:
+		migrations = file.Migrations()
+	case dbstorage.MigrationSource:
+		migrations = dbstorage.Migrations()
+	default:
+		return errors.Errorf("unknown migration source %q", *source)
+	}
+
+	db, err := gorm.Open(*dialect, *dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, *source, migrations)
+	if err != nil {
+		return err
+	}
+
+	return migrator.Run(flag.Args(), os.Stdout)
+}
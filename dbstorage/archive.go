@@ -0,0 +1,86 @@
+package dbstorage
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	fs "github.com/gidyon/file-handlers"
+	"github.com/jinzhu/gorm"
+	"net/http"
+)
+
+// getArchive streams the files selected by owner id, owner tag or keys as a single archive
+func (fsDBH *fileDBHandler) getArchive(w http.ResponseWriter, r *http.Request, upath string) {
+	var (
+		query    = r.URL.Query()
+		format   = query.Get(urlQueryKeyArchive)
+		ownerID  = query.Get(urlQueryKeyOwnerID)
+		ownerTag = query.Get(urlQueryKeyOwnerTag)
+		keys     = fs.ArchiveKeys(query[urlQueryKeyFileKey])
+	)
+
+	if format != fs.ArchiveZip && format != fs.ArchiveTarGz {
+		http.Error(w, "UNKNOWN_ARCHIVE_FORMAT", http.StatusBadRequest)
+		return
+	}
+
+	if ownerID == "" && ownerTag == "" && len(keys) == 0 {
+		http.Error(w, "NO_FILES_SELECTED", http.StatusBadRequest)
+		return
+	}
+
+	db := fsDBH.db.Table(fsDBH.db.NewScope(&fs.FileData{}).TableName())
+	if ownerID != "" {
+		db = db.Where("owner_id=?", ownerID)
+	}
+	if ownerTag != "" {
+		db = db.Where("owner_tag=?", ownerTag)
+	}
+	if len(keys) > 0 {
+		db = db.Where("id IN (?)", keys)
+	}
+
+	// select metadata only so that file data is loaded one file at a time
+	fileInfos := make([]*fs.FileInfo, 0)
+	err := db.Select("id, name, created_at").Where("deleted_at IS NULL").Order("created_at").Find(&fileInfos).Error
+	if err != nil {
+		http.Error(w, "DB_FIND_FILES_FAILED", http.StatusInternalServerError)
+		return
+	}
+
+	if len(fileInfos) == 0 {
+		http.Error(w, "FILE_NOT_FOUND", http.StatusNotFound)
+		return
+	}
+
+	aw, err := fs.NewArchiveWriter(w, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", fs.ArchiveContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fs.ArchiveName(upath, format)))
+
+	// headers are sent with the first entry, failures from here on can only abort the stream
+	for _, fileInfo := range fileInfos {
+		file := &fs.FileData{}
+		err = fsDBH.db.First(file, "id=?", fileInfo.ID).Error
+		if gorm.IsRecordNotFoundError(err) {
+			logrus.Warnln("file missing from archive: " + fileInfo.ID)
+			continue
+		}
+		if err == nil {
+			err = aw.Add(file.Name, int64(len(file.Data)), file.UpdatedAt, bytes.NewReader(file.Data))
+		}
+		if err != nil {
+			logrus.Errorln(err)
+			return
+		}
+	}
+
+	err = aw.Close()
+	if err != nil {
+		logrus.Errorln(err)
+	}
+}
@@ -0,0 +1,149 @@
+package dbstorage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	fs "github.com/gidyon/file-handlers"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+)
+
+var _ = Describe("Archive download", func() {
+	var (
+		res     *httptest.ResponseRecorder
+		results []*fs.UploadResult
+	)
+
+	const OwnerID = "archive-owner"
+
+	upload := func(upath string, filenames ...string) {
+		paths := make([]string, 0, len(filenames))
+		for _, filename := range filenames {
+			paths = append(paths, filepath.Join(DataDir, filename))
+		}
+
+		body, ctype, err := createFormFiles(paths...)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		req := httptest.NewRequest(http.MethodPost, Server.URL()+upath+"?"+urlQueryKeyOwnerID+"="+OwnerID+"&"+urlQueryKeyBatch+"="+fs.BatchAllOrNothing, body)
+		req.Header.Set("content-type", ctype)
+
+		rec := httptest.NewRecorder()
+		Handler.ServeHTTP(rec, req)
+		Expect(rec.Code).Should(Equal(http.StatusCreated))
+
+		batch := &fs.BatchResponse{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), batch)).ShouldNot(HaveOccurred())
+		results = append(results, batch.Files...)
+	}
+
+	download := func(query string) {
+		req := httptest.NewRequest(http.MethodGet, Server.URL()+"/gallery"+query, nil)
+		Handler.ServeHTTP(res, req)
+	}
+
+	names := func(entries map[string][]byte) []string {
+		names := make([]string, 0, len(entries))
+		for name := range entries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	content := func(name string) []byte {
+		bs, err := ioutil.ReadFile(filepath.Join(DataDir, name))
+		Expect(err).ShouldNot(HaveOccurred())
+		return bs
+	}
+
+	BeforeEach(func() {
+		res = httptest.NewRecorder()
+		results = nil
+	})
+
+	AfterEach(func() {
+		for _, result := range results {
+			DB.Unscoped().Delete(&fs.FileData{}, "id=?", result.Key)
+		}
+	})
+
+	Context("Selecting files by owner", func() {
+		BeforeEach(func() {
+			upload("/gallery/1", "leo.jpg", "sala.webp")
+			upload("/gallery/2", "leo.jpg")
+		})
+
+		It("should stream every file of the owner as zip with unique names", func() {
+			download("?" + urlQueryKeyArchive + "=zip&" + urlQueryKeyOwnerID + "=" + OwnerID)
+
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Header().Get("content-type")).Should(Equal("application/zip"))
+
+			zr, err := zip.NewReader(bytes.NewReader(res.Body.Bytes()), int64(res.Body.Len()))
+			Expect(err).ShouldNot(HaveOccurred())
+
+			entries := make(map[string][]byte, len(zr.File))
+			for _, f := range zr.File {
+				rc, err := f.Open()
+				Expect(err).ShouldNot(HaveOccurred())
+				entries[f.Name], err = ioutil.ReadAll(rc)
+				Expect(err).ShouldNot(HaveOccurred())
+				rc.Close()
+			}
+
+			Expect(names(entries)).Should(Equal([]string{"leo (1).jpg", "leo.jpg", "sala.webp"}))
+			Expect(entries["leo (1).jpg"]).Should(Equal(content("leo.jpg")))
+			Expect(entries["sala.webp"]).Should(Equal(content("sala.webp")))
+		})
+
+		It("should stream selected files as tar.gz", func() {
+			download("?" + urlQueryKeyArchive + "=tar.gz&" + urlQueryKeyFileKey + "=" + results[1].Key)
+
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Header().Get("content-type")).Should(Equal("application/gzip"))
+
+			gr, err := gzip.NewReader(bytes.NewReader(res.Body.Bytes()))
+			Expect(err).ShouldNot(HaveOccurred())
+			tr := tar.NewReader(gr)
+
+			entries := make(map[string][]byte, 0)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).ShouldNot(HaveOccurred())
+				entries[hdr.Name], err = ioutil.ReadAll(tr)
+				Expect(err).ShouldNot(HaveOccurred())
+			}
+
+			Expect(names(entries)).Should(Equal([]string{"sala.webp"}))
+			Expect(entries["sala.webp"]).Should(Equal(content("sala.webp")))
+		})
+	})
+
+	Context("Downloading with a bad selection", func() {
+		It("should fail when no files are selected", func() {
+			download("?" + urlQueryKeyArchive + "=zip")
+			Expect(res.Code).Should(Equal(http.StatusBadRequest))
+		})
+
+		It("should fail for an unknown archive format", func() {
+			download("?" + urlQueryKeyArchive + "=rar&" + urlQueryKeyOwnerID + "=" + OwnerID)
+			Expect(res.Code).Should(Equal(http.StatusBadRequest))
+		})
+
+		It("should fail when no file matches the selection", func() {
+			download("?" + urlQueryKeyArchive + "=zip&" + urlQueryKeyOwnerID + "=nobody")
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+		})
+	})
+})
@@ -0,0 +1,100 @@
+package dbstorage
+
+import (
+	fs "github.com/gidyon/file-handlers"
+	"net/http"
+	"path"
+	"path/filepath"
+)
+
+// isBatch checks whether the request is a batch upload. A request is a batch upload when it has the batch query,
+// an empty batch mode being all or nothing. Other requests store their first file part only
+func isBatch(r *http.Request) bool {
+	_, ok := r.URL.Query()[urlQueryKeyBatch]
+	return ok
+}
+
+// saveFiles stores every file part of a batch upload under the request path and replies with the result of each file
+func (fsDBH *fileDBHandler) saveFiles(w http.ResponseWriter, r *http.Request, upath string, caching bool) {
+	mode, serr := fs.BatchMode(r.URL.Query().Get(urlQueryKeyBatch))
+	if serr != nil {
+		http.Error(w, serr.Msg, serr.Status)
+		return
+	}
+
+	headers := fs.FormFiles(r.MultipartForm)
+	if len(headers) == 0 {
+		http.Error(w, http.ErrMissingFile.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var (
+		uploads = make([]*fs.Upload, len(headers))
+		results = make([]*fs.UploadResult, len(headers))
+	)
+
+	// read the content of every file part
+	fs.ForEach(len(headers), fsDBH.maxBatchConcurrency, func(i int) {
+		results[i] = &fs.UploadResult{
+			Name: headers[i].Filename,
+			Size: headers[i].Size,
+		}
+
+		up, err := readUpload(r, headers[i])
+		if err != nil {
+			results[i].Error = err.Error()
+			return
+		}
+
+		if !fsDBH.isMimeAllowed(up.Mime) {
+			results[i].Error = "MIME_TYPE_NOT_ALLOWED"
+			return
+		}
+
+		name := filepath.Base(up.Name)
+		if name == "." || name == ".." || name == string(filepath.Separator) {
+			results[i].Error = "INVALID_FILE_NAME"
+			return
+		}
+
+		up.Name = name
+		up.Path = path.Join(upath, name)
+		up.Key = fsDBH.fileKey(up.Path)
+		uploads[i] = up
+
+		results[i].Name = up.Name
+		results[i].Path = up.Path
+		results[i].Key = up.Key
+	})
+
+	fsDBH.storeBatch(w, r, mode, caching, uploads, results)
+}
+
+// storeBatch stores the uploads of a batch according to mode and replies with the result of each file.
+// A nil upload is a file that already failed with the error in its result
+func (fsDBH *fileDBHandler) storeBatch(w http.ResponseWriter, r *http.Request, mode string, caching bool, uploads []*fs.Upload, results []*fs.UploadResult) {
+	status := fs.StoreBatch(mode, fsDBH.maxBatchConcurrency, results, func(indexes []int) *fs.StatusError {
+		return fsDBH.storeUploads(selectUploads(uploads, indexes))
+	})
+
+	// cache the stored files, a failure to cache does not fail the upload
+	if caching {
+		fs.ForEach(len(uploads), fsDBH.maxBatchConcurrency, func(i int) {
+			if uploads[i] == nil || results[i].Error != "" {
+				return
+			}
+			fsDBH.cacheUpload(uploads[i])
+		})
+	}
+
+	fs.WriteBatch(w, r, status, mode, results)
+}
+
+// selectUploads returns the uploads at indexes
+func selectUploads(uploads []*fs.Upload, indexes []int) []*fs.Upload {
+	selected := make([]*fs.Upload, 0, len(indexes))
+	for _, i := range indexes {
+		selected = append(selected, uploads[i])
+	}
+	return selected
+}
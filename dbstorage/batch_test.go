@@ -0,0 +1,128 @@
+package dbstorage
+
+import (
+	"encoding/json"
+	fs "github.com/gidyon/file-handlers"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+)
+
+var _ = Describe("Batch upload", func() {
+	var (
+		res     *httptest.ResponseRecorder
+		results *fs.BatchResponse
+	)
+
+	const BatchURL = "/gallery/1"
+
+	send := func(method, query string, filenames ...string) {
+		paths := make([]string, 0, len(filenames))
+		for _, filename := range filenames {
+			paths = append(paths, filepath.Join(DataDir, filename))
+		}
+
+		body, ctype, err := createFormFiles(paths...)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		req := httptest.NewRequest(method, Server.URL()+BatchURL+query, body)
+		req.Header.Set("content-type", ctype)
+
+		Handler.ServeHTTP(res, req)
+
+		results = &fs.BatchResponse{}
+		if res.Header().Get("content-type") == "application/json" {
+			Expect(json.Unmarshal(res.Body.Bytes(), results)).ShouldNot(HaveOccurred())
+		}
+	}
+
+	upload := func(query string, filenames ...string) {
+		send(http.MethodPost, query, filenames...)
+	}
+
+	exists := func(result *fs.UploadResult) bool {
+		return DB.First(&fs.FileData{}, "id=?", result.Key).Error == nil
+	}
+
+	BeforeEach(func() {
+		res = httptest.NewRecorder()
+	})
+
+	AfterEach(func() {
+		for _, result := range results.Files {
+			if result.Key != "" {
+				DB.Unscoped().Delete(&fs.FileData{}, "id=?", result.Key)
+			}
+		}
+	})
+
+	Context("Uploading many files at once", func() {
+		It("should store every file under the request path", func() {
+			upload("?"+urlQueryKeyBatch, "leo.jpg", "sala.webp", "favicon.ico")
+
+			Expect(res.Code).Should(Equal(http.StatusCreated))
+			Expect(results.Mode).Should(Equal(fs.BatchAllOrNothing))
+			Expect(results.Files).Should(HaveLen(3))
+			for _, result := range results.Files {
+				Expect(result.Error).Should(BeEmpty())
+				Expect(result.Path).Should(Equal(BatchURL + "/" + result.Name))
+				Expect(exists(result)).Should(BeTrue())
+			}
+		})
+
+		It("should succeed with StatusOK when the files are replaced", func() {
+			send(http.MethodPut, "?"+urlQueryKeyBatch, "leo.jpg", "sala.webp")
+
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			for _, result := range results.Files {
+				Expect(result.Error).Should(BeEmpty())
+				Expect(exists(result)).Should(BeTrue())
+			}
+		})
+
+		It("should store only the first file part without the batch query", func() {
+			upload("", "leo.jpg", "sala.webp")
+
+			key := Handler.(*fileDBHandler).fileKey(BatchURL)
+			defer DB.Unscoped().Delete(&fs.FileData{}, "id=?", key)
+
+			Expect(res.Code).Should(Equal(http.StatusCreated))
+
+			fileData := &fs.FileData{}
+			Expect(DB.First(fileData, "id=?", key).Error).ShouldNot(HaveOccurred())
+			Expect(fileData.Name).Should(Equal("leo.jpg"))
+		})
+
+		It("should fail with StatusBadRequest when the batch mode is unknown", func() {
+			upload("?"+urlQueryKeyBatch+"=some", "leo.jpg", "sala.webp")
+
+			Expect(res.Code).Should(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Context("All or nothing", func() {
+		It("should store none of the files when one of them fails", func() {
+			upload("?"+urlQueryKeyBatch, "leo.jpg", "sala.webp", "leo.jpg")
+
+			Expect(res.Code).Should(Equal(http.StatusBadRequest))
+			Expect(results.Files[2].Error).Should(Equal("DUPLICATE_FILE_PATH"))
+			for _, result := range results.Files {
+				Expect(result.Error).ShouldNot(BeEmpty())
+				Expect(exists(result)).Should(BeFalse())
+			}
+		})
+	})
+
+	Context("Best effort", func() {
+		It("should store the files that do not fail", func() {
+			upload("?"+urlQueryKeyBatch+"="+fs.BatchBestEffort, "leo.jpg", "sala.webp", "leo.jpg")
+
+			Expect(res.Code).Should(Equal(http.StatusMultiStatus))
+			Expect(results.Files[0].Error).Should(BeEmpty())
+			Expect(exists(results.Files[0])).Should(BeTrue())
+			Expect(results.Files[1].Error).Should(BeEmpty())
+			Expect(exists(results.Files[1])).Should(BeTrue())
+			Expect(results.Files[2].Error).Should(Equal("DUPLICATE_FILE_PATH"))
+		})
+	})
+})
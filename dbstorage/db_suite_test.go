@@ -8,6 +8,7 @@ import (
 	"github.com/jinzhu/gorm"
 	"github.com/onsi/gomega/ghttp"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"os"
@@ -122,6 +123,35 @@ func createFormFile(filename string) (*bytes.Buffer, string, error) {
 	return body, writer.FormDataContentType(), nil
 }
 
+func createFormFiles(filenames ...string) (*bytes.Buffer, string, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	for _, filename := range filenames {
+		bs, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, "", err
+		}
+
+		part, err := writer.CreateFormFile(urlQueryKeyFormFile, filepath.Base(filename))
+		if err != nil {
+			return nil, "", err
+		}
+
+		_, err = part.Write(bs)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	err := writer.Close()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, writer.FormDataContentType(), nil
+}
+
 // Declarations for Ginkgo DSL
 type Done ginkgo.Done
 type Benchmarker ginkgo.Benchmarker
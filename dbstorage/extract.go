@@ -0,0 +1,59 @@
+package dbstorage
+
+import (
+	fs "github.com/gidyon/file-handlers"
+	"net/http"
+)
+
+// saveArchive extracts an uploaded zip or tar.gz archive and stores each of its files under the request path.
+// The archive is rejected as a whole when an entry could escape the request path or the limits are exceeded
+func (fsDBH *fileDBHandler) saveArchive(w http.ResponseWriter, r *http.Request, upath string, caching bool) {
+	mode, serr := fs.BatchMode(r.URL.Query().Get(urlQueryKeyBatch))
+	if serr != nil {
+		http.Error(w, serr.Msg, serr.Status)
+		return
+	}
+
+	headers := r.MultipartForm.File[urlQueryKeyFormFile]
+	if len(headers) == 0 {
+		http.Error(w, http.ErrMissingFile.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(headers) > 1 {
+		http.Error(w, "ONE_ARCHIVE_PER_REQUEST", http.StatusBadRequest)
+		return
+	}
+
+	archive, err := readUpload(r, headers[0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ups, serr := fs.ExtractUploads(archive, upath, r.URL.Query().Get(urlQueryKeyExtract), fs.ArchiveLimits{
+		MaxEntries: fsDBH.maxArchiveEntries,
+		MaxSize:    fsDBH.maxArchiveSize,
+	})
+	if serr != nil {
+		http.Error(w, serr.Msg, serr.Status)
+		return
+	}
+
+	var (
+		uploads = make([]*fs.Upload, len(ups))
+		results = make([]*fs.UploadResult, len(ups))
+	)
+
+	for i, up := range ups {
+		results[i] = up.Result()
+
+		if !fsDBH.isMimeAllowed(up.Mime) {
+			results[i].Error = "MIME_TYPE_NOT_ALLOWED"
+			continue
+		}
+
+		uploads[i] = up
+	}
+
+	fsDBH.storeBatch(w, r, mode, caching, uploads, results)
+}
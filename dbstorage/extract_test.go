@@ -0,0 +1,111 @@
+package dbstorage
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	fs "github.com/gidyon/file-handlers"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+)
+
+var _ = Describe("Archive upload", func() {
+	var (
+		res     *httptest.ResponseRecorder
+		fsDBH   *fileDBHandler
+		results *fs.BatchResponse
+		leo     []byte
+	)
+
+	const ExtractURL = "/albums/1"
+
+	text := []byte("plain text file")
+
+	// zipArchive creates a zip archive of the named contents in the given order
+	zipArchive := func(names []string, contents ...[]byte) []byte {
+		body := &bytes.Buffer{}
+		zw := zip.NewWriter(body)
+		for i, name := range names {
+			ew, err := zw.Create(name)
+			Expect(err).ShouldNot(HaveOccurred())
+			_, err = ew.Write(contents[i])
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		Expect(zw.Close()).ShouldNot(HaveOccurred())
+		return body.Bytes()
+	}
+
+	upload := func(archive []byte) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile(urlQueryKeyFormFile, "archive")
+		Expect(err).ShouldNot(HaveOccurred())
+		_, err = part.Write(archive)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(writer.Close()).ShouldNot(HaveOccurred())
+
+		req := httptest.NewRequest(http.MethodPost, Server.URL()+ExtractURL+"?"+urlQueryKeyExtract+"="+fs.ArchiveZip, body)
+		req.Header.Set("content-type", writer.FormDataContentType())
+
+		Handler.ServeHTTP(res, req)
+
+		results = &fs.BatchResponse{}
+		if res.Header().Get("content-type") == "application/json" {
+			Expect(json.Unmarshal(res.Body.Bytes(), results)).ShouldNot(HaveOccurred())
+		}
+	}
+
+	stored := func(upath string) []byte {
+		fileData := &fs.FileData{}
+		if DB.First(fileData, "id=?", fsDBH.fileKey(upath)).Error != nil {
+			return nil
+		}
+		return fileData.Data
+	}
+
+	BeforeEach(func() {
+		var err error
+		leo, err = ioutil.ReadFile(filepath.Join(DataDir, "leo.jpg"))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		res = httptest.NewRecorder()
+		fsDBH = Handler.(*fileDBHandler)
+	})
+
+	AfterEach(func() {
+		fsDBH.allowedMimeTypes = nil
+
+		for _, result := range results.Files {
+			DB.Unscoped().Delete(&fs.FileData{}, "id=?", result.Key)
+		}
+	})
+
+	It("should store each entry under the request path", func() {
+		upload(zipArchive([]string{"photos/leo.jpg", "notes.txt"}, leo, text))
+
+		Expect(res.Code).Should(Equal(http.StatusCreated))
+		Expect(results.Files).Should(HaveLen(2))
+		Expect(results.Files[0].Path).Should(Equal(ExtractURL + "/photos/leo.jpg"))
+		Expect(stored(ExtractURL + "/photos/leo.jpg")).Should(Equal(leo))
+		Expect(stored(ExtractURL + "/notes.txt")).Should(Equal(text))
+	})
+
+	It("should reject entries that escape the request path", func() {
+		upload(zipArchive([]string{"notes.txt", "../escaped.txt"}, text, text))
+
+		Expect(res.Code).Should(Equal(http.StatusBadRequest))
+		Expect(stored(ExtractURL + "/notes.txt")).Should(BeNil())
+	})
+
+	It("should store nothing when an entry type is not allowed", func() {
+		fsDBH.allowedMimeTypes = []string{"image/*"}
+		upload(zipArchive([]string{"leo.jpg", "notes.txt"}, leo, text))
+
+		Expect(res.Code).Should(Equal(http.StatusBadRequest))
+		Expect(results.Files[1].Error).Should(Equal("MIME_TYPE_NOT_ALLOWED"))
+		Expect(stored(ExtractURL + "/leo.jpg")).Should(BeNil())
+	})
+})
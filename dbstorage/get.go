@@ -7,7 +7,13 @@ import (
 	"net/http"
 )
 
-func (fsDBH *fileDBHandler) getFile(w http.ResponseWriter, r *http.Request, key string) {
+func (fsDBH *fileDBHandler) getFile(w http.ResponseWriter, r *http.Request, key, path string) {
+	// stream many files as one archive
+	if r.URL.Query().Get(urlQueryKeyArchive) != "" {
+		fsDBH.getArchive(w, r, path)
+		return
+	}
+
 	var (
 		data    string
 		err     error
@@ -3,13 +3,10 @@
 package dbstorage
 
 import (
-	"crypto/sha256"
-	"fmt"
 	fs "github.com/gidyon/file-handlers"
 	"github.com/go-redis/redis"
 	"github.com/jinzhu/gorm"
 	"github.com/pkg/errors"
-	"hash"
 	"net/http"
 	"path"
 	"strconv"
@@ -21,11 +18,21 @@ var (
 	urlQueryKeyOwnerTag = "otag"
 	urlQueryKeyFormFile = "file"
 	urlQueryCacheKey    = "ch"
-
-	maxUploadSize    int64 = 8 * 1024 * 1024 // ~ 8mb
-	maxRedisFileSize int64 = 50 * 1024       // ~ 50kb
-	redisCaching           = true
-	useDB                  = true
+	urlQueryKeyBatch    = "batch"
+	urlQueryKeyArchive  = "archive"
+	urlQueryKeyFileKey  = "key"
+	urlQueryKeyExtract  = "extract"
+
+	maxUploadSize       int64 = 8 * 1024 * 1024  // ~ 8mb
+	maxRedisFileSize    int64 = 50 * 1024        // ~ 50kb
+	maxArchiveSize      int64 = 64 * 1024 * 1024 // ~ 64mb
+	maxArchiveEntries         = 1000
+	maxBatchConcurrency       = 4
+	redisCaching              = true
+	useDB                     = true
+	runMigrations             = true
+
+	allowedMimeTypes []string
 )
 
 // SetURLQueryKeyOwnerID sets the URL query key name for passing owner id
@@ -48,16 +55,63 @@ func SetURLQueryCacheKey(key string) {
 	urlQueryCacheKey = key
 }
 
+// SetURLQueryKeyBatch sets the URL query key name for passing the batch upload mode
+func SetURLQueryKeyBatch(key string) {
+	urlQueryKeyBatch = key
+}
+
+// SetURLQueryKeyArchive sets the URL query key name for passing the format of an archive download
+func SetURLQueryKeyArchive(key string) {
+	urlQueryKeyArchive = key
+}
+
+// SetURLQueryKeyFileKey sets the URL query key name for passing keys of files to include in an archive download
+func SetURLQueryKeyFileKey(key string) {
+	urlQueryKeyFileKey = key
+}
+
+// SetURLQueryKeyExtract sets the URL query key name for passing the format of an uploaded archive to extract
+func SetURLQueryKeyExtract(key string) {
+	urlQueryKeyExtract = key
+}
+
+// SetMaxBatchConcurrency sets the maximum number of files of a batch upload that are processed concurrently
+func SetMaxBatchConcurrency(n int) {
+	if n > 0 {
+		maxBatchConcurrency = n
+	}
+}
+
 // SetMaxFileUploadSize sets the maximum upload size for files/files
 func SetMaxFileUploadSize(size int) {
-	if size < 0 {
+	if size > 0 {
 		maxUploadSize = int64(size)
 	}
 }
 
+// SetMaxArchiveEntries sets the maximum number of files that an uploaded archive may contain
+func SetMaxArchiveEntries(n int) {
+	if n > 0 {
+		maxArchiveEntries = n
+	}
+}
+
+// SetMaxArchiveSize sets the maximum total size of the files of an uploaded archive after decompression
+func SetMaxArchiveSize(size int64) {
+	if size > 0 {
+		maxArchiveSize = size
+	}
+}
+
+// SetAllowedMimeTypes sets the content types of files that can be uploaded. Types may end with a /* wildcard such as image/*.
+// All types are allowed when no type is set
+func SetAllowedMimeTypes(mimeTypes ...string) {
+	allowedMimeTypes = mimeTypes
+}
+
 // SetMaxRedisFileSize sets the maximum size of file that can be stored in redis. Files larger than the size specified will not be cached.
 func SetMaxRedisFileSize(size int) {
-	if size < 0 {
+	if size > 0 {
 		maxRedisFileSize = int64(size)
 	}
 }
@@ -67,12 +121,20 @@ func DisableRedisCaching() {
 	redisCaching = false
 }
 
+// DisableMigrations prevents NewFileHandler from applying schema migrations. Migrations can then be applied with Migrate or the migrate command
+func DisableMigrations() {
+	runMigrations = false
+}
+
 type fileDBHandler struct {
-	redisCaching  bool
-	maxUploadSize int64
-	redisClient   *redis.Client
-	db            *gorm.DB
-	hashFn        hash.Hash
+	redisCaching        bool
+	maxUploadSize       int64
+	maxBatchConcurrency int
+	maxArchiveEntries   int
+	maxArchiveSize      int64
+	allowedMimeTypes    []string
+	redisClient         *redis.Client
+	db                  *gorm.DB
 }
 
 // NewFileHandler creates a new file server that uses SQL database for storage of files and an optional redis database for caching. The database connection is mandatory for the handler to start. To disable redis caching, you can pass nil to redisClient argument or call API DisableRedisCaching function.
@@ -81,22 +143,27 @@ func NewFileHandler(db *gorm.DB, redisClient *redis.Client) (http.Handler, error
 		return nil, errors.New("database connection is required")
 	}
 
-	// perform automigration
-	db.AutoMigrate(&fs.FileData{}, &fs.FileInfo{})
+	if runMigrations {
+		// apply pending schema migrations
+		err := Migrate(db)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	if redisClient == nil {
 		redisCaching = false
 	}
 
-	// Hash function
-	hashFn := sha256.New()
-
 	return &fileDBHandler{
-		redisCaching:  redisCaching,
-		maxUploadSize: maxUploadSize,
-		hashFn:        hashFn,
-		redisClient:   redisClient,
-		db:            db,
+		redisCaching:        redisCaching,
+		maxUploadSize:       maxUploadSize,
+		maxBatchConcurrency: maxBatchConcurrency,
+		maxArchiveEntries:   maxArchiveEntries,
+		maxArchiveSize:      maxArchiveSize,
+		allowedMimeTypes:    allowedMimeTypes,
+		redisClient:         redisClient,
+		db:                  db,
 	}, nil
 }
 
@@ -108,11 +175,11 @@ func (fsDBH *fileDBHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// get hash of file path
-	key := fmt.Sprintf("%x", string(fsDBH.hashFn.Sum([]byte(upath))))
+	key := fsDBH.fileKey(upath)
 
 	switch r.Method {
 	case http.MethodGet:
-		fsDBH.getFile(w, r, key)
+		fsDBH.getFile(w, r, key, upath)
 	case http.MethodPost:
 		fsDBH.saveFile(w, r, key, upath)
 	case http.MethodPut:
@@ -122,6 +189,16 @@ func (fsDBH *fileDBHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// isMimeAllowed checks if a content type is allowed by the upload policy
+func (fsDBH *fileDBHandler) isMimeAllowed(ctype string) bool {
+	return fs.MimeAllowed(ctype, fsDBH.allowedMimeTypes)
+}
+
+// fileKey returns the key under which the file at upath is stored
+func (fsDBH *fileDBHandler) fileKey(upath string) string {
+	return fs.FileKey(upath)
+}
+
 // writeResponse write response headers and bytes
 func writeResponse(w http.ResponseWriter, r *http.Request, data []byte) {
 	// set headers
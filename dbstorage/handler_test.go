@@ -0,0 +1,31 @@
+package dbstorage
+
+var _ = Describe("Setting limits", func() {
+	var uploadSize, redisFileSize int64
+
+	BeforeEach(func() {
+		uploadSize, redisFileSize = maxUploadSize, maxRedisFileSize
+	})
+
+	AfterEach(func() {
+		maxUploadSize, maxRedisFileSize = uploadSize, redisFileSize
+	})
+
+	It("should apply positive sizes", func() {
+		SetMaxFileUploadSize(1024)
+		Expect(maxUploadSize).Should(BeEquivalentTo(1024))
+
+		SetMaxRedisFileSize(2048)
+		Expect(maxRedisFileSize).Should(BeEquivalentTo(2048))
+	})
+
+	It("should ignore sizes that are not positive", func() {
+		SetMaxFileUploadSize(0)
+		SetMaxFileUploadSize(-1)
+		Expect(maxUploadSize).Should(Equal(uploadSize))
+
+		SetMaxRedisFileSize(0)
+		SetMaxRedisFileSize(-1)
+		Expect(maxRedisFileSize).Should(Equal(redisFileSize))
+	})
+})
@@ -0,0 +1,58 @@
+package dbstorage
+
+import (
+	"github.com/gidyon/file-handlers/migrate"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// MigrationSource is the name under which the database file handler migrations are recorded
+const MigrationSource = "dbstorage"
+
+// fileDataV1 is the schema of file_data table at version 1
+type fileDataV1 struct {
+	ID        string `gorm:"primary_key"`
+	OwnerID   string `gorm:"type:varchar(50)"`
+	OwnerTag  string `gorm:"type:varchar(20)"`
+	Mime      string `gorm:"type:varchar(40)"`
+	Name      string `gorm:"type:varchar(100)"`
+	Path      string `gorm:"type:text"`
+	Size      int64  `gorm:"type:int"`
+	Data      []byte `gorm:"type:blob(8192000);not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time `sql:"index"`
+}
+
+func (*fileDataV1) TableName() string {
+	return "file_data"
+}
+
+// Migrations returns the schema migrations for the tables used by the database file handler
+func Migrations() []*migrate.Migration {
+	return []*migrate.Migration{
+		{
+			Version: 1,
+			Name:    "create file_data table",
+			Up: func(tx *gorm.DB) error {
+				return tx.CreateTable(&fileDataV1{}).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.DropTableIfExists(&fileDataV1{}).Error
+			},
+			// the table may already exist from auto migrations of earlier releases, reverting must not drop it then
+			Adopt: func(tx *gorm.DB) bool {
+				return tx.HasTable(&fileDataV1{})
+			},
+		},
+	}
+}
+
+// Migrate applies pending schema migrations of the database file handler to db
+func Migrate(db *gorm.DB) error {
+	migrator, err := migrate.New(db, MigrationSource, Migrations())
+	if err != nil {
+		return err
+	}
+	return migrator.Up()
+}
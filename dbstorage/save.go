@@ -2,108 +2,70 @@ package dbstorage
 
 import (
 	fs "github.com/gidyon/file-handlers"
-	"github.com/google/uuid"
-	"github.com/pkg/errors"
-	"io/ioutil"
-	"mime"
+	"mime/multipart"
 	"net/http"
 	"time"
 )
 
 func (fsDBH *fileDBHandler) saveFile(w http.ResponseWriter, r *http.Request, key, path string) {
-	var (
-		bs      = make([]byte, 0)
-		err     error
-		caching = fsDBH.redisCaching && r.URL.Query().Get(urlQueryCacheKey) != ""
-	)
+	caching := fsDBH.redisCaching && r.URL.Query().Get(urlQueryCacheKey) != ""
 
 	// validate size
 	r.Body = http.MaxBytesReader(w, r.Body, fsDBH.maxUploadSize)
-	err = r.ParseMultipartForm(fsDBH.maxUploadSize)
+	err := r.ParseMultipartForm(fsDBH.maxUploadSize)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// get file content
-	file, header, err := r.FormFile(urlQueryKeyFormFile)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	// store every file of an uploaded archive
+	if r.URL.Query().Get(urlQueryKeyExtract) != "" {
+		fsDBH.saveArchive(w, r, path, caching)
 		return
 	}
-	defer file.Close()
 
-	// read file data
-	bs, err = ioutil.ReadAll(file)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// store every file part when the request is a batch upload
+	if isBatch(r) {
+		fsDBH.saveFiles(w, r, path, caching)
 		return
 	}
 
-	// content-type
-	ctype := http.DetectContentType(bs)
+	// get file content
+	headers := r.MultipartForm.File[urlQueryKeyFormFile]
+	if len(headers) == 0 {
+		http.Error(w, http.ErrMissingFile.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// file name
-	fileName, err := func() (string, error) {
-		if header.Filename != "" {
-			return header.Filename, nil
-		}
-		fileEndings, err := mime.ExtensionsByType(ctype)
-		if err != nil {
-			return "", errors.New("CANT_READ_FILE_EXT_TYPE")
-		}
-		return uuid.New().String() + fileEndings[0], nil
-	}()
+	// read file data
+	up, err := readUpload(r, headers[0])
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	up.Key = key
+	up.Path = path
 
-	// get owner id
-	ownerID := func() string {
-		id := r.URL.Query().Get(urlQueryKeyOwnerID)
-		if id != "" {
-			return id
-		}
-		return "global"
-	}()
-
-	// Create file metadata together with its data
-	fileData := fs.FileData{
-		FileMeta: fs.FileMeta{
-			ID:       key,
-			OwnerID:  ownerID,
-			OwnerTag: r.URL.Query().Get(urlQueryKeyOwnerTag),
-			Mime:     ctype,
-			Size:     header.Size,
-			Name:     fileName,
-			Path:     path,
-		},
-		Data: bs,
-		Model: fs.Model{
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		},
+	if !fsDBH.isMimeAllowed(up.Mime) {
+		http.Error(w, "MIME_TYPE_NOT_ALLOWED", http.StatusUnsupportedMediaType)
+		return
 	}
 
 	// Save file in db
-	err = fsDBH.db.Unscoped().Save(fileData).Error
-	if err != nil {
-		http.Error(w, "SAVING_FILE_FAILED", http.StatusInternalServerError)
+	serr := fsDBH.storeUploads([]*fs.Upload{up})
+	if serr != nil {
+		http.Error(w, serr.Msg, serr.Status)
 		return
 	}
 
 	msg := "SUCCESS"
 	if caching {
-		// set file data in cache only if its lower than size required
-		if fileData.Size <= maxRedisFileSize {
-			// Save file data in redis if the size does not extend limit
-			statusCMD := fsDBH.redisClient.Set(key, fileData.Data, 0)
-			if err := statusCMD.Err(); err != nil {
-				http.Error(w, "CACHE_SAVE_FILE_FAILED", http.StatusNotFound)
-				return
-			}
-		} else {
+		cached, err := fsDBH.cacheUpload(up)
+		if err != nil {
+			http.Error(w, "CACHE_SAVE_FILE_FAILED", http.StatusNotFound)
+			return
+		}
+		if !cached {
 			msg = "FILE_TOO_BIG_TO_SAVE_IN_CACHE"
 		}
 	}
@@ -111,3 +73,68 @@ func (fsDBH *fileDBHandler) saveFile(w http.ResponseWriter, r *http.Request, key
 	w.WriteHeader(http.StatusCreated)
 	w.Write([]byte(msg))
 }
+
+// readUpload reads the content of a file part that belongs to the owner in the request query, or to the global owner
+func readUpload(r *http.Request, header *multipart.FileHeader) (*fs.Upload, error) {
+	ownerID := r.URL.Query().Get(urlQueryKeyOwnerID)
+	if ownerID == "" {
+		ownerID = "global"
+	}
+	return fs.ReadUpload(header, ownerID, r.URL.Query().Get(urlQueryKeyOwnerTag))
+}
+
+// storeUploads saves the uploads in a single transaction. Either all uploads are saved or none is.
+func (fsDBH *fileDBHandler) storeUploads(uploads []*fs.Upload) *fs.StatusError {
+	tx := fsDBH.db.Begin()
+	if tx.Error != nil {
+		return &fs.StatusError{Status: http.StatusInternalServerError, Msg: "TRANSACTION_BEGIN_FAILED"}
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	for _, up := range uploads {
+		// Create file metadata together with its data
+		fileData := fs.FileData{
+			FileMeta: fs.FileMeta{
+				ID:       up.Key,
+				OwnerID:  up.OwnerID,
+				OwnerTag: up.OwnerTag,
+				Mime:     up.Mime,
+				Size:     up.Size,
+				Name:     up.Name,
+				Path:     up.Path,
+			},
+			Data: up.Data,
+			Model: fs.Model{
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+			},
+		}
+
+		err := tx.Unscoped().Save(fileData).Error
+		if err != nil {
+			return &fs.StatusError{Status: http.StatusInternalServerError, Msg: "SAVING_FILE_FAILED"}
+		}
+	}
+
+	err := tx.Commit().Error
+	if err != nil {
+		return &fs.StatusError{Status: http.StatusInternalServerError, Msg: "SAVING_FILE_FAILED"}
+	}
+
+	return nil
+}
+
+// cacheUpload sets the upload data in cache if its size is lower than size required. It reports whether the data was cached
+func (fsDBH *fileDBHandler) cacheUpload(up *fs.Upload) (bool, error) {
+	if up.Size > maxRedisFileSize {
+		return false, nil
+	}
+
+	// Save file data in redis if the size does not extend limit
+	err := fsDBH.redisClient.Set(up.Key, up.Data, 0).Err()
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,209 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"path"
+	"strings"
+	"time"
+)
+
+// Errors returned when extracting an archive
+var (
+	ErrArchiveFormat         = errors.New("unknown archive format")
+	ErrArchiveUnsafePath     = errors.New("archive entry path escapes the archive root")
+	ErrArchiveEntryType      = errors.New("archive entry is not a regular file or directory")
+	ErrArchiveTooManyEntries = errors.New("archive has too many entries")
+	ErrArchiveTooLarge       = errors.New("archive content is too large")
+)
+
+// ArchiveLimits bounds the content extracted from an archive
+type ArchiveLimits struct {
+	MaxEntries int   // Maximum number of files in the archive
+	MaxSize    int64 // Maximum total size of the files after decompression
+}
+
+// ArchiveEntry is a regular file extracted from an archive
+type ArchiveEntry struct {
+	Name    string // Cleaned slash separated path relative to the archive root
+	ModTime time.Time
+	Data    []byte
+}
+
+// ExtractArchive reads the regular files of a zip or tar.gz archive within limits.
+// Directories are skipped. Links and entries whose path could escape the extraction root fail the whole archive.
+func ExtractArchive(data []byte, format string, limits ArchiveLimits) ([]*ArchiveEntry, error) {
+	ex := &extractor{
+		limits:  limits,
+		entries: make([]*ArchiveEntry, 0),
+	}
+
+	switch format {
+	case ArchiveZip:
+		return ex.entries, ex.zip(data)
+	case ArchiveTarGz, "tgz":
+		return ex.entries, ex.tarGz(data)
+	}
+
+	return nil, ErrArchiveFormat
+}
+
+type extractor struct {
+	limits  ArchiveLimits
+	size    int64
+	entries []*ArchiveEntry
+}
+
+func (ex *extractor) zip(data []byte) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return errors.Wrap(err, "failed to read zip archive")
+	}
+
+	// the central directory is read up front, so a bomb of many entries fails before any is inflated
+	if ex.limits.MaxEntries > 0 && len(zr.File) > ex.limits.MaxEntries {
+		return ErrArchiveTooManyEntries
+	}
+
+	for _, f := range zr.File {
+		mode := f.Mode()
+		if mode.IsDir() {
+			continue
+		}
+		if !mode.IsRegular() {
+			return errors.Wrap(ErrArchiveEntryType, f.Name)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return errors.Wrap(err, f.Name)
+		}
+
+		err = ex.add(f.Name, f.Modified, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ex *extractor) tarGz(data []byte) error {
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to read gzip stream")
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read tar archive")
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeXGlobalHeader:
+			continue
+		case tar.TypeReg, tar.TypeRegA:
+		default:
+			return errors.Wrap(ErrArchiveEntryType, hdr.Name)
+		}
+
+		err = ex.add(hdr.Name, hdr.ModTime, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// add reads an entry from r without trusting the size declared in the archive
+func (ex *extractor) add(name string, modTime time.Time, r io.Reader) error {
+	name, err := cleanEntryName(name)
+	if err != nil {
+		return err
+	}
+
+	if ex.limits.MaxEntries > 0 && len(ex.entries) >= ex.limits.MaxEntries {
+		return ErrArchiveTooManyEntries
+	}
+
+	if ex.limits.MaxSize > 0 {
+		// read one byte past the remaining budget to detect content that exceeds it
+		r = io.LimitReader(r, ex.limits.MaxSize-ex.size+1)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.Wrap(err, name)
+	}
+
+	ex.size += int64(len(data))
+	if ex.limits.MaxSize > 0 && ex.size > ex.limits.MaxSize {
+		return ErrArchiveTooLarge
+	}
+
+	ex.entries = append(ex.entries, &ArchiveEntry{
+		Name:    name,
+		ModTime: modTime,
+		Data:    data,
+	})
+
+	return nil
+}
+
+// cleanEntryName returns the cleaned path of an archive entry. It fails for absolute paths and paths that leave the archive root
+func cleanEntryName(name string) (string, error) {
+	name = strings.Replace(name, "\\", "/", -1)
+	if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return "", errors.Wrap(ErrArchiveUnsafePath, name)
+	}
+
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return "", errors.Wrap(ErrArchiveUnsafePath, name)
+		}
+	}
+
+	name = path.Clean(name)
+	if name == "." || name == "" {
+		return "", errors.Wrap(ErrArchiveUnsafePath, name)
+	}
+
+	return name, nil
+}
+
+// MimeAllowed checks whether a content type matches a list of allowed types. Types may end with a /* wildcard.
+// An empty list allows every type
+func MimeAllowed(ctype string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return false
+	}
+
+	for _, a := range allowed {
+		a = strings.ToLower(strings.TrimSpace(a))
+		switch {
+		case a == "*/*" || a == mediaType:
+			return true
+		case strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(a, "*")):
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,164 @@
+package file
+
+import (
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	fs "github.com/gidyon/file-handlers"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// archiveEntry is a file to be added to an archive
+type archiveEntry struct {
+	key  string
+	name string
+}
+
+// getArchive streams the files of a directory selected by owner id, owner tag or keys as a single archive
+func (fsh *fsHandler) getArchive(w http.ResponseWriter, r *http.Request, upath string) {
+	var (
+		query    = r.URL.Query()
+		format   = query.Get(urlQueryKeyArchive)
+		ownerID  = query.Get(urlQueryKeyOwnerID)
+		ownerTag = query.Get(urlQueryKeyOwnerTag)
+		keys     = fs.ArchiveKeys(query[urlQueryKeyFileKey])
+	)
+
+	if format != fs.ArchiveZip && format != fs.ArchiveTarGz {
+		http.Error(w, "UNKNOWN_ARCHIVE_FORMAT", http.StatusBadRequest)
+		return
+	}
+
+	if ownerID == "" && ownerTag == "" && len(keys) == 0 {
+		http.Error(w, "NO_FILES_SELECTED", http.StatusBadRequest)
+		return
+	}
+
+	for _, key := range keys {
+		if !isValidKey(key) {
+			http.Error(w, "INVALID_FILE_KEY", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// if user has specified to get files from a given directory, use it
+	dir := query.Get(urlQueryKeyDirectory)
+
+	if dir != "" {
+		dir = filepath.Clean(dir)
+		if !fsh.isDirAllowed(dir) {
+			http.Error(w, "NOT_ALLOWED_ACESS_TO_DIRECTORY", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// use default uploads when user has not specified what directory to retrieve files
+	if dir == "" {
+		dir = fsh.defaultDir
+	}
+
+	entries := make([]*archiveEntry, 0, len(keys))
+
+	if fsh.useDB {
+		db := fsh.db
+		if ownerID != "" {
+			db = db.Where("owner_id=?", ownerID)
+		}
+		if ownerTag != "" {
+			db = db.Where("owner_tag=?", ownerTag)
+		}
+		if len(keys) > 0 {
+			db = db.Where("id IN (?)", keys)
+		}
+		// rows of files stored before the directory was recorded have none, they are scoped by what is on disk below
+		db = db.Where("dir IN (?)", []string{rowDir(dir), ""})
+
+		fileInfos := make([]*fs.FileInfo, 0)
+		err := db.Order("created_at").Find(&fileInfos).Error
+		if err != nil {
+			http.Error(w, "DB_FIND_FILES_FAILED", http.StatusInternalServerError)
+			return
+		}
+
+		for _, fileInfo := range fileInfos {
+			entries = append(entries, &archiveEntry{key: fileInfo.ID, name: fileInfo.Name})
+		}
+	} else {
+		// owner id and tag are only known to the database
+		if ownerID != "" || ownerTag != "" {
+			http.Error(w, "SELECTION_REQUIRES_DATABASE", http.StatusBadRequest)
+			return
+		}
+
+		for _, key := range keys {
+			entries = append(entries, &archiveEntry{key: key, name: key})
+		}
+	}
+
+	// only files stored in dir are archived. They are checked before any header is sent, so that
+	// a file that cannot be read fails the request instead of leaving the archive incomplete
+	stored := entries[:0]
+	for _, entry := range entries {
+		_, err := os.Stat(filepath.Join(dir, entry.key))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			http.Error(w, "STAT_FILE_FAILED", http.StatusInternalServerError)
+			return
+		}
+		stored = append(stored, entry)
+	}
+	entries = stored
+
+	if len(entries) == 0 {
+		fsh.notFoundHandler.ServeHTTP(w, r)
+		return
+	}
+
+	aw, err := fs.NewArchiveWriter(w, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", fs.ArchiveContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fs.ArchiveName(upath, format)))
+
+	// headers are sent with the first entry, failures from here on can only abort the stream
+	for _, entry := range entries {
+		err = addArchiveFile(aw, filepath.Join(dir, entry.key), entry.name)
+		if err != nil {
+			logrus.Errorln(err)
+			return
+		}
+	}
+
+	err = aw.Close()
+	if err != nil {
+		logrus.Errorln(err)
+	}
+}
+
+// addArchiveFile streams the file at filePath into the archive
+func addArchiveFile(aw *fs.ArchiveWriter, filePath, name string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	finfo, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	return aw.Add(name, finfo.Size(), finfo.ModTime(), f)
+}
+
+// isValidKey checks that a key passed by client names a file and not a path
+func isValidKey(key string) bool {
+	return !strings.ContainsAny(key, `/\`) && !strings.HasPrefix(key, ".")
+}
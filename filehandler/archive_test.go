@@ -0,0 +1,214 @@
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	fs "github.com/gidyon/file-handlers"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+var _ = Describe("Archive download", func() {
+	var (
+		res     *httptest.ResponseRecorder
+		fsh     *fsHandler
+		results []*fs.UploadResult
+	)
+
+	const OwnerID = "archive-owner"
+
+	upload := func(upath string, filenames ...string) {
+		paths := make([]string, 0, len(filenames))
+		for _, filename := range filenames {
+			paths = append(paths, filepath.Join(DataDir, filename))
+		}
+
+		body, ctype, err := createFormFiles(paths...)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		req := httptest.NewRequest(http.MethodPost, Server.URL()+upath+"?"+urlQueryKeyOwnerID+"="+OwnerID+"&"+urlQueryKeyBatch+"="+fs.BatchAllOrNothing, body)
+		req.Header.Set("content-type", ctype)
+
+		rec := httptest.NewRecorder()
+		Handler.ServeHTTP(rec, req)
+		Expect(rec.Code).Should(Equal(http.StatusCreated))
+
+		batch := &fs.BatchResponse{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), batch)).ShouldNot(HaveOccurred())
+		results = append(results, batch.Files...)
+	}
+
+	download := func(query string) {
+		req := httptest.NewRequest(http.MethodGet, Server.URL()+"/gallery"+query, nil)
+		Handler.ServeHTTP(res, req)
+	}
+
+	zipEntries := func() map[string][]byte {
+		zr, err := zip.NewReader(bytes.NewReader(res.Body.Bytes()), int64(res.Body.Len()))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		entries := make(map[string][]byte, len(zr.File))
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			Expect(err).ShouldNot(HaveOccurred())
+			bs, err := ioutil.ReadAll(rc)
+			Expect(err).ShouldNot(HaveOccurred())
+			rc.Close()
+			entries[f.Name] = bs
+		}
+		return entries
+	}
+
+	tarEntries := func() map[string][]byte {
+		gr, err := gzip.NewReader(bytes.NewReader(res.Body.Bytes()))
+		Expect(err).ShouldNot(HaveOccurred())
+		tr := tar.NewReader(gr)
+
+		entries := make(map[string][]byte, 0)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).ShouldNot(HaveOccurred())
+			bs, err := ioutil.ReadAll(tr)
+			Expect(err).ShouldNot(HaveOccurred())
+			entries[hdr.Name] = bs
+		}
+		return entries
+	}
+
+	names := func(entries map[string][]byte) []string {
+		names := make([]string, 0, len(entries))
+		for name := range entries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	content := func(name string) []byte {
+		bs, err := ioutil.ReadFile(filepath.Join(DataDir, name))
+		Expect(err).ShouldNot(HaveOccurred())
+		return bs
+	}
+
+	BeforeEach(func() {
+		res = httptest.NewRecorder()
+		fsh = Handler.(*fsHandler)
+		results = nil
+	})
+
+	AfterEach(func() {
+		for _, result := range results {
+			os.Remove(filepath.Join(fsh.defaultDir, result.Key))
+			DB.Unscoped().Delete(&fs.FileInfo{}, "id=?", result.Key)
+		}
+	})
+
+	Context("Selecting files by owner", func() {
+		BeforeEach(func() {
+			upload("/gallery/1", "leo.jpg", "sala.webp")
+			upload("/gallery/2", "leo.jpg")
+		})
+
+		It("should stream every file of the owner as zip with unique names", func() {
+			download("?" + urlQueryKeyArchive + "=zip&" + urlQueryKeyOwnerID + "=" + OwnerID)
+
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Header().Get("content-type")).Should(Equal("application/zip"))
+			Expect(res.Header().Get("content-disposition")).Should(ContainSubstring(`"gallery.zip"`))
+
+			entries := zipEntries()
+			Expect(names(entries)).Should(Equal([]string{"leo (1).jpg", "leo.jpg", "sala.webp"}))
+			Expect(entries["leo.jpg"]).Should(Equal(content("leo.jpg")))
+			Expect(entries["leo (1).jpg"]).Should(Equal(content("leo.jpg")))
+			Expect(entries["sala.webp"]).Should(Equal(content("sala.webp")))
+		})
+
+		It("should stream selected files as tar.gz", func() {
+			download("?" + urlQueryKeyArchive + "=tar.gz&" + urlQueryKeyFileKey + "=" + results[1].Key)
+
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Header().Get("content-type")).Should(Equal("application/gzip"))
+
+			entries := tarEntries()
+			Expect(names(entries)).Should(Equal([]string{"sala.webp"}))
+			Expect(entries["sala.webp"]).Should(Equal(content("sala.webp")))
+		})
+
+		It("should only archive selected files that are stored in the directory", func() {
+			Expect(os.Remove(filepath.Join(fsh.defaultDir, results[0].Key))).ShouldNot(HaveOccurred())
+
+			download("?" + urlQueryKeyArchive + "=zip&" + urlQueryKeyFileKey + "=" + results[0].Key + "," + results[1].Key)
+
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(names(zipEntries())).Should(Equal([]string{"sala.webp"}))
+		})
+
+		It("should not archive files of the owner stored in another directory", func() {
+			dir, err := ioutil.TempDir("", "archive")
+			Expect(err).ShouldNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			meta := &fs.FileMeta{
+				ID:      fs.FileKey("/gallery/3"),
+				OwnerID: OwnerID,
+				Mime:    "text/plain; charset=utf-8",
+				Name:    "other.txt",
+				Path:    "/gallery/3",
+			}
+			Expect(StoreFile(DB, dir, meta, []byte("other"))).ShouldNot(HaveOccurred())
+			defer DB.Unscoped().Delete(&fs.FileInfo{}, "id=?", meta.ID)
+
+			// a file left under the same key in the default directory is not the stored one
+			stale := filepath.Join(fsh.defaultDir, meta.ID)
+			Expect(ioutil.WriteFile(stale, []byte("stale"), 0644)).ShouldNot(HaveOccurred())
+			defer os.Remove(stale)
+
+			fileInfo := &fs.FileInfo{}
+			Expect(DB.First(fileInfo, "id=?", meta.ID).Error).ShouldNot(HaveOccurred())
+			Expect(fileInfo.Dir).Should(Equal(dir))
+
+			download("?" + urlQueryKeyArchive + "=zip&" + urlQueryKeyOwnerID + "=" + OwnerID)
+
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(names(zipEntries())).Should(Equal([]string{"leo (1).jpg", "leo.jpg", "sala.webp"}))
+		})
+	})
+
+	Context("Downloading with a bad selection", func() {
+		It("should fail when no files are selected", func() {
+			download("?" + urlQueryKeyArchive + "=zip")
+			Expect(res.Code).Should(Equal(http.StatusBadRequest))
+		})
+
+		It("should fail for an unknown archive format", func() {
+			download("?" + urlQueryKeyArchive + "=rar&" + urlQueryKeyOwnerID + "=" + OwnerID)
+			Expect(res.Code).Should(Equal(http.StatusBadRequest))
+		})
+
+		It("should fail for archive formats that cannot be streamed", func() {
+			download("?" + urlQueryKeyArchive + "=tgz&" + urlQueryKeyOwnerID + "=" + OwnerID)
+			Expect(res.Code).Should(Equal(http.StatusBadRequest))
+		})
+
+		It("should fail for a key that is a path", func() {
+			download("?" + urlQueryKeyArchive + "=zip&" + urlQueryKeyFileKey + "=../secret")
+			Expect(res.Code).Should(Equal(http.StatusBadRequest))
+		})
+
+		It("should fail when no file matches the selection", func() {
+			download("?" + urlQueryKeyArchive + "=zip&" + urlQueryKeyOwnerID + "=nobody")
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+		})
+	})
+})
@@ -0,0 +1,116 @@
+package file
+
+import (
+	fs "github.com/gidyon/file-handlers"
+	"net/http"
+	"path"
+	"path/filepath"
+)
+
+// isBatch checks whether the request is a batch upload. A request is a batch upload when it has the batch query,
+// an empty batch mode being all or nothing. Other requests store their first file part only
+func isBatch(r *http.Request) bool {
+	_, ok := r.URL.Query()[urlQueryKeyBatch]
+	return ok
+}
+
+// saveFiles stores every file part of a batch upload under the request path and replies with the result of each file
+func (fsh *fsHandler) saveFiles(w http.ResponseWriter, r *http.Request, upath string) {
+	mode, dir, ok := fsh.batchOptions(w, r)
+	if !ok {
+		return
+	}
+
+	headers := fs.FormFiles(r.MultipartForm)
+	if len(headers) == 0 {
+		http.Error(w, http.ErrMissingFile.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var (
+		uploads = make([]*upload, len(headers))
+		results = make([]*fs.UploadResult, len(headers))
+	)
+
+	// read the content of every file part
+	fs.ForEach(len(headers), fsh.maxBatchConcurrency, func(i int) {
+		results[i] = &fs.UploadResult{
+			Name: headers[i].Filename,
+			Size: headers[i].Size,
+		}
+
+		up, err := readUpload(r, headers[i])
+		if err != nil {
+			results[i].Error = err.Error()
+			return
+		}
+
+		if !fsh.isMimeAllowed(up.Mime) {
+			results[i].Error = "MIME_TYPE_NOT_ALLOWED"
+			return
+		}
+
+		name := filepath.Base(up.Name)
+		if name == "." || name == ".." || name == string(filepath.Separator) {
+			results[i].Error = "INVALID_FILE_NAME"
+			return
+		}
+
+		up.Name = name
+		up.Path = path.Join(upath, name)
+		up.Key = fsh.fileKey(up.Path)
+		uploads[i] = up
+
+		results[i].Name = up.Name
+		results[i].Path = up.Path
+		results[i].Key = up.Key
+	})
+
+	fsh.storeBatch(w, r, mode, dir, uploads, results)
+}
+
+// storeBatch stores the uploads of a batch in dir according to mode and replies with the result of each file.
+// A nil upload is a file that already failed with the error in its result
+func (fsh *fsHandler) storeBatch(w http.ResponseWriter, r *http.Request, mode, dir string, uploads []*upload, results []*fs.UploadResult) {
+	status := fs.StoreBatch(mode, fsh.maxBatchConcurrency, results, func(indexes []int) *fs.StatusError {
+		return fsh.storeUploads(dir, selectUploads(uploads, indexes))
+	})
+
+	fs.WriteBatch(w, r, status, mode, results)
+}
+
+// batchOptions returns the batch mode and the directory to store the files of a batch upload in. It replies with an error when either is invalid
+func (fsh *fsHandler) batchOptions(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	mode, serr := fs.BatchMode(r.URL.Query().Get(urlQueryKeyBatch))
+	if serr != nil {
+		http.Error(w, serr.Msg, serr.Status)
+		return "", "", false
+	}
+
+	// if user can specify which directory to save files, use it
+	dir := r.URL.Query().Get(urlQueryKeyDirectory)
+
+	if dir != "" {
+		dir = filepath.Clean(dir)
+		if !fsh.isDirAllowed(dir) {
+			http.Error(w, "NOT_ALLOWED_ACESS_TO_DIRECTORY", http.StatusBadRequest)
+			return "", "", false
+		}
+	}
+
+	// use default uploads when user has not specified which directory to save the files
+	if dir == "" {
+		dir = fsh.defaultDir
+	}
+
+	return mode, dir, true
+}
+
+// selectUploads returns the uploads at indexes
+func selectUploads(uploads []*upload, indexes []int) []*upload {
+	selected := make([]*upload, 0, len(indexes))
+	for _, i := range indexes {
+		selected = append(selected, uploads[i])
+	}
+	return selected
+}
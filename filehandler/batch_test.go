@@ -0,0 +1,161 @@
+package file
+
+import (
+	"encoding/json"
+	fs "github.com/gidyon/file-handlers"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("Batch upload", func() {
+	var (
+		res     *httptest.ResponseRecorder
+		fsh     *fsHandler
+		results *fs.BatchResponse
+	)
+
+	const BatchURL = "/gallery/1"
+
+	upload := func(query string, filenames ...string) {
+		paths := make([]string, 0, len(filenames))
+		for _, filename := range filenames {
+			paths = append(paths, filepath.Join(DataDir, filename))
+		}
+
+		body, ctype, err := createFormFiles(paths...)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		req := httptest.NewRequest(http.MethodPost, Server.URL()+BatchURL+query, body)
+		req.Header.Set("content-type", ctype)
+
+		Handler.ServeHTTP(res, req)
+
+		results = &fs.BatchResponse{}
+		if res.Header().Get("content-type") == "application/json" {
+			Expect(json.Unmarshal(res.Body.Bytes(), results)).ShouldNot(HaveOccurred())
+		}
+	}
+
+	exists := func(result *fs.UploadResult) bool {
+		_, err := os.Stat(filepath.Join(fsh.defaultDir, result.Key))
+		return err == nil
+	}
+
+	BeforeEach(func() {
+		res = httptest.NewRecorder()
+		fsh = Handler.(*fsHandler)
+	})
+
+	AfterEach(func() {
+		for _, result := range results.Files {
+			if result.Key != "" {
+				os.Remove(filepath.Join(fsh.defaultDir, result.Key))
+				DB.Unscoped().Delete(&fs.FileInfo{}, "id=?", result.Key)
+			}
+		}
+	})
+
+	Context("Uploading many files at once", func() {
+		It("should store every file under the request path", func() {
+			upload("?"+urlQueryKeyBatch, "leo.jpg", "sala.webp", "output.pdf")
+
+			Expect(res.Code).Should(Equal(http.StatusCreated))
+			Expect(results.Mode).Should(Equal(fs.BatchAllOrNothing))
+			Expect(results.Files).Should(HaveLen(3))
+			for _, result := range results.Files {
+				Expect(result.Error).Should(BeEmpty())
+				Expect(result.Path).Should(Equal(BatchURL + "/" + result.Name))
+				Expect(result.Key).Should(Equal(fsh.fileKey(result.Path)))
+				Expect(result.Size).Should(BeNumerically(">", 0))
+				Expect(exists(result)).Should(BeTrue())
+			}
+		})
+
+		It("should treat a single file as a batch when a batch mode is set", func() {
+			upload("?"+urlQueryKeyBatch+"="+fs.BatchBestEffort, "leo.jpg")
+
+			Expect(res.Code).Should(Equal(http.StatusCreated))
+			Expect(results.Files).Should(HaveLen(1))
+			Expect(exists(results.Files[0])).Should(BeTrue())
+		})
+
+		It("should store only the first file part without the batch query", func() {
+			upload("", "leo.jpg", "sala.webp")
+
+			key := fsh.fileKey(BatchURL)
+			defer DB.Unscoped().Delete(&fs.FileInfo{}, "id=?", key)
+			defer os.Remove(filepath.Join(fsh.defaultDir, key))
+
+			Expect(res.Code).Should(Equal(http.StatusCreated))
+			Expect(res.Body.String()).Should(Equal("SUCCESS"))
+
+			bs, err := ioutil.ReadFile(filepath.Join(fsh.defaultDir, key))
+			Expect(err).ShouldNot(HaveOccurred())
+			leo, err := ioutil.ReadFile(filepath.Join(DataDir, "leo.jpg"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(bs).Should(Equal(leo))
+		})
+
+		It("should fail with StatusBadRequest when the batch mode is unknown", func() {
+			upload("?"+urlQueryKeyBatch+"=some", "leo.jpg", "sala.webp")
+
+			Expect(res.Code).Should(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Context("All or nothing", func() {
+		It("should store none of the files when one of them fails", func() {
+			upload("?"+urlQueryKeyBatch, "leo.jpg", "sala.webp", "leo.jpg")
+
+			Expect(res.Code).Should(Equal(http.StatusBadRequest))
+			Expect(results.Files).Should(HaveLen(3))
+			Expect(results.Files[2].Error).Should(Equal("DUPLICATE_FILE_PATH"))
+			for _, result := range results.Files {
+				Expect(result.Error).ShouldNot(BeEmpty())
+				Expect(exists(result)).Should(BeFalse())
+			}
+		})
+
+		It("should roll back stored files when storing fails", func() {
+			failAt := stepInstalled
+			calls := 0
+			faultHook = func(step string) error {
+				if step == failAt {
+					calls++
+					if calls == 2 {
+						return os.ErrInvalid
+					}
+				}
+				return nil
+			}
+			defer func() {
+				faultHook = func(string) error { return nil }
+			}()
+
+			upload("?"+urlQueryKeyBatch, "leo.jpg", "sala.webp", "output.pdf")
+
+			Expect(res.Code).Should(Equal(http.StatusInternalServerError))
+			for _, result := range results.Files {
+				Expect(result.Error).Should(Equal("CANT_CREATE_FILE"))
+				Expect(exists(result)).Should(BeFalse())
+			}
+		})
+	})
+
+	Context("Best effort", func() {
+		It("should store the files that do not fail", func() {
+			upload("?"+urlQueryKeyBatch+"="+fs.BatchBestEffort, "leo.jpg", "sala.webp", "leo.jpg")
+
+			Expect(res.Code).Should(Equal(http.StatusMultiStatus))
+			Expect(results.Mode).Should(Equal(fs.BatchBestEffort))
+			Expect(results.Files[0].Error).Should(BeEmpty())
+			Expect(exists(results.Files[0])).Should(BeTrue())
+			Expect(results.Files[1].Error).Should(BeEmpty())
+			Expect(exists(results.Files[1])).Should(BeTrue())
+			Expect(results.Files[2].Error).Should(Equal("DUPLICATE_FILE_PATH"))
+		})
+	})
+})
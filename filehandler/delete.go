@@ -1,49 +1,15 @@
 package file
 
 import (
+	"github.com/Sirupsen/logrus"
 	fs "github.com/gidyon/file-handlers"
-	"github.com/jinzhu/gorm"
 	"net/http"
 	"os"
 	"path/filepath"
 )
 
 func (fsh *fsHandler) deleteFile(w http.ResponseWriter, r *http.Request, key, path string) {
-	var (
-		ownerID = r.URL.Query().Get(urlQueryKeyOwnerID)
-		tx      *gorm.DB
-		err     error
-	)
-
-	// rollbacks a transaction
-	rollBack := func() {
-		if fsh.useDB {
-			tx.Rollback()
-		}
-	}
-
-	// Create a transaction
-	if fsh.useDB {
-		tx = fsh.db.Begin()
-		defer func() {
-			if err := recover(); err != nil {
-				http.Error(w, "RUNTIME_ERROR", http.StatusInternalServerError)
-				return
-			}
-		}()
-		if tx.Error != nil {
-			http.Error(w, "TRANSACTION_BEGIN_FAILED: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		// delete file in database
-		err := tx.Delete(&fs.FileInfo{}, "id=? AND owner_id=?", key, ownerID).Error
-		if err != nil {
-			rollBack()
-			http.Error(w, "TX_DELETE_FILE_FAILED: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-	}
+	ownerID := r.URL.Query().Get(urlQueryKeyOwnerID)
 
 	// if user can specify which directory to delete file from, use it
 	dir := r.URL.Query().Get(urlQueryKeyDirectory)
@@ -51,7 +17,6 @@ func (fsh *fsHandler) deleteFile(w http.ResponseWriter, r *http.Request, key, pa
 	if dir != "" {
 		dir = filepath.Clean(dir)
 		if !fsh.isDirAllowed(dir) {
-			rollBack()
 			http.Error(w, "NOT_ALLOWED_DIRECTORY", http.StatusBadRequest)
 			return
 		}
@@ -62,26 +27,73 @@ func (fsh *fsHandler) deleteFile(w http.ResponseWriter, r *http.Request, key, pa
 		dir = fsh.defaultDir
 	}
 
-	// path to file
-	filePath := filepath.Join(dir, key)
+	st := newStage(dir, opDelete, key)
 
-	// delete the file in directory
-	err = os.Remove(filePath)
+	// record the operation before changing metadata or the file
+	err := st.writeJournal()
 	if err != nil {
-		rollBack()
-		http.Error(w, "DELETE_FILE_FAILED: "+err.Error(), http.StatusBadRequest)
+		http.Error(w, "CANT_STAGE_FILE: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// commit db transaction
+	// mark the file as deleted in database
 	if fsh.useDB {
-		err = tx.Commit().Error
+		res := fsh.db.Delete(&fs.FileInfo{}, "id=? AND owner_id=?", key, ownerID)
+		if res.Error != nil {
+			st.discard()
+			http.Error(w, "DB_DELETE_FILE_FAILED: "+res.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		if res.RowsAffected == 0 {
+			st.discard()
+			http.Error(w, "DELETE_FILE_FAILED: file not found", http.StatusBadRequest)
+			return
+		}
+
+		err = faultHook(stepMarked)
 		if err != nil {
-			rollBack()
-			http.Error(w, "FAILED_TO_COMMIT_FILE: "+err.Error(), http.StatusInternalServerError)
+			fsh.unmark(st)
+			http.Error(w, "DB_DELETE_FILE_FAILED: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 	}
 
+	// delete the file in directory
+	err = os.Remove(st.target())
+	if err == nil {
+		err = syncDir(dir)
+	}
+	if err != nil {
+		fsh.unmark(st)
+		http.Error(w, "DELETE_FILE_FAILED: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the file is gone, a failure from here on is resolved by recovery on next start
+	err = faultHook(stepUnlinked)
+	if err == nil && fsh.useDB {
+		// purge the marked row
+		err = fsh.db.Unscoped().Delete(&fs.FileInfo{}, "id=? AND deleted_at IS NOT NULL", key).Error
+	}
+	if err == nil {
+		err = st.discard()
+	}
+	if err != nil {
+		logrus.Errorln(err)
+	}
+
 	w.Write([]byte("SUCCESS"))
 }
+
+// unmark restores the row marked by an unfinished delete and discards the stage
+func (fsh *fsHandler) unmark(st *stage) {
+	if fsh.useDB {
+		err := fsh.db.Unscoped().Model(&fs.FileInfo{}).Where("id=?", st.j.Key).Update("deleted_at", nil).Error
+		if err != nil {
+			// leave the journal for recovery to complete the delete
+			logrus.Errorln(err)
+			return
+		}
+	}
+	st.discard()
+}
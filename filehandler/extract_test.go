@@ -0,0 +1,222 @@
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	fs "github.com/gidyon/file-handlers"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("Archive upload", func() {
+	var (
+		res     *httptest.ResponseRecorder
+		fsh     *fsHandler
+		results *fs.BatchResponse
+		leo     []byte
+	)
+
+	const ExtractURL = "/albums/1"
+
+	text := []byte("plain text file")
+
+	// zipArchive creates a zip archive of the named contents in the given order
+	zipArchive := func(names []string, contents ...[]byte) []byte {
+		body := &bytes.Buffer{}
+		zw := zip.NewWriter(body)
+		for i, name := range names {
+			ew, err := zw.Create(name)
+			Expect(err).ShouldNot(HaveOccurred())
+			_, err = ew.Write(contents[i])
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		Expect(zw.Close()).ShouldNot(HaveOccurred())
+		return body.Bytes()
+	}
+
+	extract := func(format string) string {
+		return "?" + urlQueryKeyExtract + "=" + format
+	}
+
+	upload := func(query string, archive []byte) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile(urlQueryKeyFormFile, "archive")
+		Expect(err).ShouldNot(HaveOccurred())
+		_, err = part.Write(archive)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(writer.Close()).ShouldNot(HaveOccurred())
+
+		req := httptest.NewRequest(http.MethodPost, Server.URL()+ExtractURL+query, body)
+		req.Header.Set("content-type", writer.FormDataContentType())
+
+		Handler.ServeHTTP(res, req)
+
+		results = &fs.BatchResponse{}
+		if res.Header().Get("content-type") == "application/json" {
+			Expect(json.Unmarshal(res.Body.Bytes(), results)).ShouldNot(HaveOccurred())
+		}
+	}
+
+	stored := func(upath string) []byte {
+		bs, err := ioutil.ReadFile(filepath.Join(fsh.defaultDir, fsh.fileKey(upath)))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		Expect(err).ShouldNot(HaveOccurred())
+		return bs
+	}
+
+	BeforeEach(func() {
+		var err error
+		leo, err = ioutil.ReadFile(filepath.Join(DataDir, "leo.jpg"))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		res = httptest.NewRecorder()
+		fsh = Handler.(*fsHandler)
+	})
+
+	AfterEach(func() {
+		fsh.maxArchiveEntries = maxArchiveEntries
+		fsh.maxArchiveSize = maxArchiveSize
+		fsh.allowedMimeTypes = nil
+
+		for _, result := range results.Files {
+			os.Remove(filepath.Join(fsh.defaultDir, result.Key))
+			DB.Unscoped().Delete(&fs.FileInfo{}, "id=?", result.Key)
+		}
+	})
+
+	Context("Extracting a valid archive", func() {
+		It("should store each zip entry under the request path", func() {
+			upload(extract(fs.ArchiveZip), zipArchive([]string{"photos/leo.jpg", "notes.txt", "photos/"}, leo, text, nil))
+
+			Expect(res.Code).Should(Equal(http.StatusCreated))
+			Expect(results.Files).Should(HaveLen(2))
+			Expect(results.Files[0].Path).Should(Equal(ExtractURL + "/photos/leo.jpg"))
+			Expect(results.Files[0].Name).Should(Equal("leo.jpg"))
+			Expect(results.Files[1].Path).Should(Equal(ExtractURL + "/notes.txt"))
+
+			Expect(stored(ExtractURL + "/photos/leo.jpg")).Should(Equal(leo))
+			Expect(stored(ExtractURL + "/notes.txt")).Should(Equal(text))
+
+			fileInfo := &fs.FileInfo{}
+			Expect(DB.First(fileInfo, "id=?", results.Files[0].Key).Error).ShouldNot(HaveOccurred())
+			Expect(fileInfo.Mime).Should(Equal("image/jpeg"))
+			Expect(fileInfo.Path).Should(Equal(ExtractURL + "/photos/leo.jpg"))
+		})
+
+		It("should store each tar.gz entry under the request path", func() {
+			body := &bytes.Buffer{}
+			gw := gzip.NewWriter(body)
+			tw := tar.NewWriter(gw)
+			Expect(tw.WriteHeader(&tar.Header{Name: "notes.txt", Mode: 0644, Size: int64(len(text))})).ShouldNot(HaveOccurred())
+			_, err := tw.Write(text)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(tw.Close()).ShouldNot(HaveOccurred())
+			Expect(gw.Close()).ShouldNot(HaveOccurred())
+
+			upload(extract(fs.ArchiveTarGz), body.Bytes())
+
+			Expect(res.Code).Should(Equal(http.StatusCreated))
+			Expect(results.Files).Should(HaveLen(1))
+			Expect(stored(ExtractURL + "/notes.txt")).Should(Equal(text))
+		})
+	})
+
+	Context("Extracting an unsafe archive", func() {
+		It("should reject entries that escape the request path", func() {
+			upload(extract(fs.ArchiveZip), zipArchive([]string{"notes.txt", "../../escaped.txt"}, text, text))
+
+			Expect(res.Code).Should(Equal(http.StatusBadRequest))
+			Expect(res.Body.String()).Should(ContainSubstring("UNSAFE_ARCHIVE_ENTRY_PATH"))
+			Expect(stored(ExtractURL + "/notes.txt")).Should(BeNil())
+			Expect(stored("/escaped.txt")).Should(BeNil())
+		})
+
+		It("should reject absolute entry paths", func() {
+			upload(extract(fs.ArchiveZip), zipArchive([]string{"/etc/escaped.txt"}, text))
+
+			Expect(res.Code).Should(Equal(http.StatusBadRequest))
+		})
+
+		It("should reject symbolic links", func() {
+			body := &bytes.Buffer{}
+			gw := gzip.NewWriter(body)
+			tw := tar.NewWriter(gw)
+			Expect(tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})).ShouldNot(HaveOccurred())
+			Expect(tw.Close()).ShouldNot(HaveOccurred())
+			Expect(gw.Close()).ShouldNot(HaveOccurred())
+
+			upload(extract(fs.ArchiveTarGz), body.Bytes())
+
+			Expect(res.Code).Should(Equal(http.StatusBadRequest))
+			Expect(res.Body.String()).Should(ContainSubstring("UNSUPPORTED_ARCHIVE_ENTRY"))
+		})
+
+		It("should reject archives with too many entries", func() {
+			fsh.maxArchiveEntries = 1
+			upload(extract(fs.ArchiveZip), zipArchive([]string{"a.txt", "b.txt"}, text, text))
+
+			Expect(res.Code).Should(Equal(http.StatusRequestEntityTooLarge))
+			Expect(stored(ExtractURL + "/a.txt")).Should(BeNil())
+		})
+
+		It("should reject archives that decompress beyond the size limit", func() {
+			fsh.maxArchiveSize = 1024
+			upload(extract(fs.ArchiveZip), zipArchive([]string{"zeros.txt"}, make([]byte, 64*1024)))
+
+			Expect(res.Code).Should(Equal(http.StatusRequestEntityTooLarge))
+			Expect(stored(ExtractURL + "/zeros.txt")).Should(BeNil())
+		})
+
+		It("should fail for an unknown archive format", func() {
+			upload(extract("rar"), zipArchive([]string{"notes.txt"}, text))
+
+			Expect(res.Code).Should(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Context("Extracting with a MIME policy", func() {
+		BeforeEach(func() {
+			fsh.allowedMimeTypes = []string{"image/*"}
+		})
+
+		It("should store nothing when an entry type is not allowed", func() {
+			upload(extract(fs.ArchiveZip), zipArchive([]string{"leo.jpg", "notes.txt"}, leo, text))
+
+			Expect(res.Code).Should(Equal(http.StatusBadRequest))
+			Expect(results.Files[1].Error).Should(Equal("MIME_TYPE_NOT_ALLOWED"))
+			Expect(results.Files[0].Error).Should(Equal("ABORTED"))
+			Expect(stored(ExtractURL + "/leo.jpg")).Should(BeNil())
+		})
+
+		It("should store the allowed entries in best effort mode", func() {
+			upload(extract(fs.ArchiveZip)+"&"+urlQueryKeyBatch+"="+fs.BatchBestEffort, zipArchive([]string{"leo.jpg", "notes.txt"}, leo, text))
+
+			Expect(res.Code).Should(Equal(http.StatusMultiStatus))
+			Expect(stored(ExtractURL + "/leo.jpg")).Should(Equal(leo))
+			Expect(stored(ExtractURL + "/notes.txt")).Should(BeNil())
+		})
+
+		It("should reject a single upload whose type is not allowed", func() {
+			body, ctype, err := createFormFile(filepath.Join(DataDir, "output.pdf"))
+			Expect(err).ShouldNot(HaveOccurred())
+
+			req := httptest.NewRequest(http.MethodPost, Server.URL()+ExtractURL+"/output.pdf", body)
+			req.Header.Set("content-type", ctype)
+			Handler.ServeHTTP(res, req)
+
+			results = &fs.BatchResponse{}
+			Expect(res.Code).Should(Equal(http.StatusUnsupportedMediaType))
+			Expect(stored(ExtractURL + "/output.pdf")).Should(BeNil())
+		})
+	})
+})
@@ -1,12 +1,10 @@
 package file
 
 import (
-	"crypto/sha256"
-	"fmt"
-	"github.com/gidyon/file-handlers"
+	fs "github.com/gidyon/file-handlers"
 	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
-	"hash"
+	"github.com/pkg/errors"
 	"net/http"
 	"os"
 	"path"
@@ -19,10 +17,20 @@ var (
 	urlQueryKeyOwnerTag  = "otag"
 	urlQueryKeyDirectory = "dir"
 	urlQueryKeyFormFile  = "file"
+	urlQueryKeyBatch     = "batch"
+	urlQueryKeyArchive   = "archive"
+	urlQueryKeyFileKey   = "key"
+	urlQueryKeyExtract   = "extract"
 
-	maxUploadSize int64 = 8 * 1024 * 1024
-	defaultDir          = "."
-	useDB               = true
+	maxUploadSize       int64 = 8 * 1024 * 1024
+	maxBatchConcurrency       = 4
+	maxArchiveEntries         = 1000
+	maxArchiveSize      int64 = 64 * 1024 * 1024
+	defaultDir                = "."
+	useDB                     = true
+	runMigrations             = true
+
+	allowedMimeTypes []string
 )
 
 // SetURLQueryKeyOwnerID sets the URL query key for passing owner id
@@ -45,9 +53,56 @@ func SetURLQueryKeyFormFile(key string) {
 	urlQueryKeyFormFile = key
 }
 
+// SetURLQueryKeyBatch sets the URL query key for passing the batch upload mode
+func SetURLQueryKeyBatch(key string) {
+	urlQueryKeyBatch = key
+}
+
+// SetURLQueryKeyArchive sets the URL query key for passing the format of an archive download
+func SetURLQueryKeyArchive(key string) {
+	urlQueryKeyArchive = key
+}
+
+// SetURLQueryKeyFileKey sets the URL query key for passing keys of files to include in an archive download
+func SetURLQueryKeyFileKey(key string) {
+	urlQueryKeyFileKey = key
+}
+
+// SetURLQueryKeyExtract sets the URL query key for passing the format of an uploaded archive to extract
+func SetURLQueryKeyExtract(key string) {
+	urlQueryKeyExtract = key
+}
+
+// SetMaxBatchConcurrency sets the maximum number of files of a batch upload that are processed concurrently
+func SetMaxBatchConcurrency(n int) {
+	if n > 0 {
+		maxBatchConcurrency = n
+	}
+}
+
+// SetMaxArchiveEntries sets the maximum number of files that an uploaded archive may contain
+func SetMaxArchiveEntries(n int) {
+	if n > 0 {
+		maxArchiveEntries = n
+	}
+}
+
+// SetMaxArchiveSize sets the maximum total size of the files of an uploaded archive after decompression
+func SetMaxArchiveSize(size int64) {
+	if size > 0 {
+		maxArchiveSize = size
+	}
+}
+
+// SetAllowedMimeTypes sets the content types of files that can be uploaded. Types may end with a /* wildcard such as image/*.
+// All types are allowed when no type is set
+func SetAllowedMimeTypes(mimeTypes ...string) {
+	allowedMimeTypes = mimeTypes
+}
+
 // SetMaxUploadSize sets the maximum upload size for files/files
 func SetMaxUploadSize(size int) {
-	if size < 0 {
+	if size > 0 {
 		maxUploadSize = int64(size)
 	}
 }
@@ -62,23 +117,32 @@ func DisableDB() {
 	useDB = false
 }
 
+// DisableMigrations prevents New from applying schema migrations. Migrations can then be applied with Migrate or the migrate command
+func DisableMigrations() {
+	runMigrations = false
+}
+
 // ServerOptions contains options to setup and configure the file server
 type ServerOptions struct {
 	RootDir         string       // Root directory
 	AllowedDirs     []string     // List of directories that is allowed access by server under root
 	NotFoundHandler http.Handler // NotFound costom handler
 	DB              *gorm.DB     // Database connection for storing file metadata
+	DefaultDir      string       // Uploads directory relative to root. Overrides the directory set with SetDefaultDir
 }
 
 type fsHandler struct {
-	root            string
-	allowedDirs     []string
-	defaultDir      string
-	notFoundHandler http.Handler
-	hashFn          hash.Hash
-	db              *gorm.DB
-	useDB           bool
-	maxUploadSize   int64
+	root                string
+	allowedDirs         []string
+	defaultDir          string
+	notFoundHandler     http.Handler
+	db                  *gorm.DB
+	useDB               bool
+	maxUploadSize       int64
+	maxBatchConcurrency int
+	maxArchiveEntries   int
+	maxArchiveSize      int64
+	allowedMimeTypes    []string
 }
 
 // New creates a file server for the given root dir. It stores files metadata on the provided database connection.
@@ -93,7 +157,12 @@ func New(opt *ServerOptions) (http.Handler, error) {
 	// clean root
 	opt.RootDir = filepath.Clean(opt.RootDir)
 
-	defaultDir := filepath.Join(opt.RootDir, defaultDir)
+	uploadDir := defaultDir
+	if opt.DefaultDir != "" {
+		uploadDir = filepath.Clean(opt.DefaultDir)
+	}
+
+	defaultDir := filepath.Join(opt.RootDir, uploadDir)
 
 	// allowed directories
 	allowedDirs := make([]string, 0, len(opt.AllowedDirs)+1)
@@ -125,24 +194,35 @@ func New(opt *ServerOptions) (http.Handler, error) {
 		useDB = false
 	}
 
-	if useDB {
-		// perform automigration
-		opt.DB.AutoMigrate(&fs.FileData{}, &fs.FileInfo{})
+	if useDB && runMigrations {
+		// apply pending schema migrations
+		err = Migrate(opt.DB)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fsh := &fsHandler{
+		root:                opt.RootDir,
+		allowedDirs:         allowedDirs,
+		defaultDir:          defaultDir,
+		notFoundHandler:     opt.NotFoundHandler,
+		db:                  opt.DB,
+		useDB:               useDB,
+		maxUploadSize:       maxUploadSize,
+		maxBatchConcurrency: maxBatchConcurrency,
+		maxArchiveEntries:   maxArchiveEntries,
+		maxArchiveSize:      maxArchiveSize,
+		allowedMimeTypes:    allowedMimeTypes,
 	}
 
-	// hash function
-	hashFn := sha256.New()
+	// resolve operations interrupted by a previous crash
+	err = fsh.recoverStaging()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to recover staged files")
+	}
 
-	return &fsHandler{
-		root:            opt.RootDir,
-		allowedDirs:     allowedDirs,
-		defaultDir:      defaultDir,
-		notFoundHandler: opt.NotFoundHandler,
-		hashFn:          hashFn,
-		db:              opt.DB,
-		useDB:           useDB,
-		maxUploadSize:   maxUploadSize,
-	}, nil
+	return fsh, nil
 }
 
 func (fsh *fsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -154,7 +234,7 @@ func (fsh *fsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// get hash of file path
-	key := fmt.Sprintf("%x", string(fsh.hashFn.Sum([]byte(upath))))
+	key := fsh.fileKey(upath)
 
 	switch r.Method {
 	case http.MethodGet:
@@ -168,6 +248,16 @@ func (fsh *fsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// fileKey returns the key under which the file at upath is stored
+func (fsh *fsHandler) fileKey(upath string) string {
+	return fs.FileKey(upath)
+}
+
+// isMimeAllowed checks if a content type is allowed by the upload policy
+func (fsh *fsHandler) isMimeAllowed(ctype string) bool {
+	return fs.MimeAllowed(ctype, fsh.allowedMimeTypes)
+}
+
 // isDirAllowed checks if a directory is present in the list of allowed directories
 func (fsh *fsHandler) isDirAllowed(dir string) bool {
 	for _, d := range fsh.allowedDirs {
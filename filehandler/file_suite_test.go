@@ -51,7 +51,12 @@ var _ = BeforeSuite(func() {
 	SetURLQueryKeyOwnerID("id")
 
 	// setup handler
-	Handler, err = New(&ServerOptions{RootDir, []string{"uploads"}, http.NotFoundHandler(), DB})
+	Handler, err = New(&ServerOptions{
+		RootDir:         RootDir,
+		AllowedDirs:     []string{"uploads"},
+		NotFoundHandler: http.NotFoundHandler(),
+		DB:              DB,
+	})
 	Expect(err).ShouldNot(HaveOccurred())
 	Expect(Handler).ShouldNot(BeNil())
 
@@ -122,6 +127,35 @@ func createFormFile(filename string) (*bytes.Buffer, string, error) {
 	return body, writer.FormDataContentType(), nil
 }
 
+func createFormFiles(filenames ...string) (*bytes.Buffer, string, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	for _, filename := range filenames {
+		bs, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, "", err
+		}
+
+		part, err := writer.CreateFormFile(urlQueryKeyFormFile, filepath.Base(filename))
+		if err != nil {
+			return nil, "", err
+		}
+
+		_, err = part.Write(bs)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	err := writer.Close()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, writer.FormDataContentType(), nil
+}
+
 // Declarations for Ginkgo DSL
 type Done ginkgo.Done
 type Benchmarker ginkgo.Benchmarker
@@ -0,0 +1,80 @@
+package file
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("Creating file server", func() {
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "filehandler")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(os.Mkdir(filepath.Join(root, "uploads"), 0755)).ShouldNot(HaveOccurred())
+		Expect(os.Mkdir(filepath.Join(root, "other"), 0755)).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	newHandler := func(dir string) *fsHandler {
+		handler, err := New(&ServerOptions{
+			RootDir:    root,
+			DB:         DB,
+			DefaultDir: dir,
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		return handler.(*fsHandler)
+	}
+
+	It("should store uploads in the default directory of its options", func() {
+		fsh := newHandler("other")
+		Expect(fsh.defaultDir).Should(Equal(filepath.Join(root, "other")))
+		Expect(fsh.allowedDirs).Should(ContainElement(filepath.Join(root, "other")))
+	})
+
+	It("should not share the default directory of its options with other handlers", func() {
+		newHandler("other")
+
+		fsh := newHandler("")
+		Expect(fsh.defaultDir).Should(Equal(filepath.Join(root, "uploads")))
+	})
+
+	It("should fail when the default directory does not exist", func() {
+		_, err := New(&ServerOptions{
+			RootDir:         root,
+			NotFoundHandler: http.NotFoundHandler(),
+			DB:              DB,
+			DefaultDir:      "missing",
+		})
+		Expect(err).Should(HaveOccurred())
+	})
+})
+
+var _ = Describe("Setting limits", func() {
+	var uploadSize int64
+
+	BeforeEach(func() {
+		uploadSize = maxUploadSize
+	})
+
+	AfterEach(func() {
+		maxUploadSize = uploadSize
+	})
+
+	It("should apply positive upload sizes", func() {
+		SetMaxUploadSize(1024)
+		Expect(maxUploadSize).Should(BeEquivalentTo(1024))
+	})
+
+	It("should ignore upload sizes that are not positive", func() {
+		SetMaxUploadSize(0)
+		SetMaxUploadSize(-1)
+		Expect(maxUploadSize).Should(Equal(uploadSize))
+	})
+})
@@ -9,6 +9,12 @@ import (
 )
 
 func (fsh *fsHandler) getFile(w http.ResponseWriter, r *http.Request, key, path string) {
+	// stream many files as one archive
+	if r.URL.Query().Get(urlQueryKeyArchive) != "" {
+		fsh.getArchive(w, r, path)
+		return
+	}
+
 	// if user has specified to get file from a given directory, use it
 	dir := r.URL.Query().Get(urlQueryKeyDirectory)
 
@@ -0,0 +1,89 @@
+package file
+
+import (
+	"github.com/gidyon/file-handlers/migrate"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// MigrationSource is the name under which the file handler migrations are recorded
+const MigrationSource = "filehandler"
+
+// fileInfoV1 is the schema of file_infos table at version 1
+type fileInfoV1 struct {
+	ID        string `gorm:"primary_key"`
+	OwnerID   string `gorm:"type:varchar(50)"`
+	OwnerTag  string `gorm:"type:varchar(20)"`
+	Mime      string `gorm:"type:varchar(40)"`
+	Name      string `gorm:"type:varchar(100)"`
+	Path      string `gorm:"type:text"`
+	Size      int64  `gorm:"type:int"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time `sql:"index"`
+}
+
+func (*fileInfoV1) TableName() string {
+	return "file_infos"
+}
+
+// fileInfoV2 adds the staged save that last wrote a row, so that recovery can tell whether the save committed
+type fileInfoV2 struct {
+	fileInfoV1
+	StageID string `gorm:"type:varchar(36)"`
+}
+
+// fileInfoV3 adds the directory a file is stored in, so that selections can be scoped to a directory
+type fileInfoV3 struct {
+	fileInfoV2
+	Dir string `gorm:"type:text"`
+}
+
+// Migrations returns the schema migrations for the tables used by the file handler
+func Migrations() []*migrate.Migration {
+	return []*migrate.Migration{
+		{
+			Version: 1,
+			Name:    "create file_infos table",
+			Up: func(tx *gorm.DB) error {
+				return tx.CreateTable(&fileInfoV1{}).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.DropTableIfExists(&fileInfoV1{}).Error
+			},
+			// the table may already exist from auto migrations of earlier releases, reverting must not drop it then
+			Adopt: func(tx *gorm.DB) bool {
+				return tx.HasTable(&fileInfoV1{})
+			},
+		},
+		{
+			Version: 2,
+			Name:    "add stage_id to file_infos",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&fileInfoV2{}).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Model(&fileInfoV2{}).DropColumn("stage_id").Error
+			},
+		},
+		{
+			Version: 3,
+			Name:    "add dir to file_infos",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&fileInfoV3{}).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Model(&fileInfoV3{}).DropColumn("dir").Error
+			},
+		},
+	}
+}
+
+// Migrate applies pending schema migrations of the file handler to db
+func Migrate(db *gorm.DB) error {
+	migrator, err := migrate.New(db, MigrationSource, Migrations())
+	if err != nil {
+		return err
+	}
+	return migrator.Up()
+}
@@ -3,17 +3,19 @@ package file
 import (
 	"github.com/Sirupsen/logrus"
 	fs "github.com/gidyon/file-handlers"
-	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
-	"github.com/pkg/errors"
-	"io/ioutil"
-	"mime"
+	"mime/multipart"
 	"net/http"
-	"os"
 	"path/filepath"
-	"time"
 )
 
+// upload is a file received in a request to be stored together with its stage
+type upload struct {
+	*fs.Upload
+	st     *stage
+	staged bool // whether the temporary file of the stage was written
+}
+
 func (fsh *fsHandler) saveFile(w http.ResponseWriter, r *http.Request, key, path string) {
 	// validate size
 	r.Body = http.MaxBytesReader(w, r.Body, fsh.maxUploadSize)
@@ -23,136 +25,239 @@ func (fsh *fsHandler) saveFile(w http.ResponseWriter, r *http.Request, key, path
 		return
 	}
 
+	// store every file of an uploaded archive
+	if r.URL.Query().Get(urlQueryKeyExtract) != "" {
+		fsh.saveArchive(w, r, path)
+		return
+	}
+
+	// store every file part when the request is a batch upload
+	if isBatch(r) {
+		fsh.saveFiles(w, r, path)
+		return
+	}
+
 	// get file from request
-	file, header, err := r.FormFile(urlQueryKeyFormFile)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	headers := r.MultipartForm.File[urlQueryKeyFormFile]
+	if len(headers) == 0 {
+		http.Error(w, http.ErrMissingFile.Error(), http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
 
 	// read content
-	bs, err := ioutil.ReadAll(file)
+	up, err := readUpload(r, headers[0])
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	up.Key = key
+	up.Path = path
+
+	if !fsh.isMimeAllowed(up.Mime) {
+		http.Error(w, "MIME_TYPE_NOT_ALLOWED", http.StatusUnsupportedMediaType)
+		return
+	}
 
-	// detect content-type
-	ctype := http.DetectContentType(bs)
+	// if user can specify which directory to save file, use it
+	dir := r.URL.Query().Get(urlQueryKeyDirectory)
 
-	fileName, err := func() (string, error) {
-		if header.Filename != "" {
-			return header.Filename, nil
+	if dir != "" {
+		dir = filepath.Clean(dir)
+		if !fsh.isDirAllowed(dir) {
+			http.Error(w, "NOT_ALLOWED_ACESS_TO_DIRECTORY", http.StatusBadRequest)
+			return
 		}
-		fileEndings, err := mime.ExtensionsByType(ctype)
+	}
+
+	// use default uploads when user has not specified which directory to save the file
+	if dir == "" {
+		dir = fsh.defaultDir
+	}
+
+	serr := fsh.storeUploads(dir, []*upload{up})
+	if serr != nil {
+		http.Error(w, serr.Msg, serr.Status)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		w.WriteHeader(http.StatusCreated)
+	}
+
+	w.Write([]byte("SUCCESS"))
+}
+
+// readUpload reads the content of a file part that belongs to the owner in the request query
+func readUpload(r *http.Request, header *multipart.FileHeader) (*upload, error) {
+	up, err := fs.ReadUpload(header, r.URL.Query().Get(urlQueryKeyOwnerID), r.URL.Query().Get(urlQueryKeyOwnerTag))
+	if err != nil {
+		return nil, err
+	}
+	return &upload{Upload: up}, nil
+}
+
+// storeUploads stores the uploads in dir through the staging protocol. Either all uploads are stored or none is.
+func (fsh *fsHandler) storeUploads(dir string, uploads []*upload) *fs.StatusError {
+	errs := make([]*fs.StatusError, len(uploads))
+
+	// write the content of every upload to a temporary file in the staging directory
+	fs.ForEach(len(uploads), fsh.maxBatchConcurrency, func(i int) {
+		up := uploads[i]
+		up.st = newStage(dir, opSave, up.Key)
+
+		err := up.st.writeTemp(up.Data)
 		if err != nil {
-			return "", errors.New("CANT_READ_FILE_EXT_TYPE")
+			errs[i] = &fs.StatusError{Status: http.StatusInternalServerError, Msg: "CANT_WRITE_TO_FILE"}
+			return
+		}
+
+		up.staged = true
+
+		// record the operation before changing metadata or the target file
+		err = faultHook(stepTempWritten)
+		if err == nil {
+			err = up.st.writeJournal()
+		}
+		if err != nil {
+			errs[i] = &fs.StatusError{Status: http.StatusInternalServerError, Msg: "CANT_STAGE_FILE"}
+		}
+	})
+	for _, serr := range errs {
+		if serr != nil {
+			rollbackUploads(uploads)
+			return serr
 		}
-		return uuid.New().String() + fileEndings[0], nil
-	}()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
 	}
 
 	var tx *gorm.DB
 	// Create a transaction
 	if fsh.useDB {
 		tx = fsh.db.Begin()
-		defer func() {
-			if err := recover(); err != nil {
-				http.Error(w, "RUNTIME_ERROR", http.StatusInternalServerError)
-			}
-		}()
 		if tx.Error != nil {
-			http.Error(w, "TRANSACTION_BEGIN_FAILED", http.StatusInternalServerError)
-			return
+			rollbackUploads(uploads)
+			return &fs.StatusError{Status: http.StatusInternalServerError, Msg: "TRANSACTION_BEGIN_FAILED"}
 		}
+		defer tx.RollbackUnlessCommitted()
 
-		// save file info metadata to database
-		fileInfo := fs.FileInfo{
-			FileMeta: fs.FileMeta{
-				ID:       key,
-				OwnerID:  r.URL.Query().Get(urlQueryKeyOwnerID),
-				OwnerTag: r.URL.Query().Get(urlQueryKeyOwnerTag),
-				Mime:     ctype,
-				Size:     header.Size,
-				Name:     fileName,
-				Path:     path,
-			},
-			Model: fs.Model{
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
-			},
+		for _, up := range uploads {
+			// save file info metadata to database
+			fileInfo := fs.FileInfo{
+				FileMeta: fs.FileMeta{
+					ID:       up.Key,
+					OwnerID:  up.OwnerID,
+					OwnerTag: up.OwnerTag,
+					Mime:     up.Mime,
+					Size:     up.Size,
+					Name:     up.Name,
+					Path:     up.Path,
+				},
+				Model: fs.Model{
+					CreatedAt: up.st.j.Stamp,
+					UpdatedAt: up.st.j.Stamp,
+				},
+				StageID: up.st.id,
+				Dir:     rowDir(dir),
+			}
+
+			// save file info
+			err := tx.Unscoped().Save(fileInfo).Error
+			if err == nil {
+				err = faultHook(stepRowSaved)
+			}
+			if err != nil {
+				rollbackUploads(uploads)
+				logrus.Errorln(err)
+				return &fs.StatusError{Status: http.StatusInternalServerError, Msg: "TX_SAVE_FILE_FAILED"}
+			}
 		}
+	}
 
-		// save file info
-		err = tx.Unscoped().Save(fileInfo).Error
+	// rename the temporary files into place
+	for _, up := range uploads {
+		err := up.st.install()
+		if err == nil {
+			err = faultHook(stepInstalled)
+		}
 		if err != nil {
-			tx.Rollback()
-			logrus.Errorln(err)
-			http.Error(w, "TX_SAVE_FILE_FAILED", http.StatusInternalServerError)
-			return
+			rollbackUploads(uploads)
+			return &fs.StatusError{Status: http.StatusInternalServerError, Msg: "CANT_CREATE_FILE"}
 		}
 	}
 
-	// rollbacks the transaction
-	rollBack := func() {
-		if fsh.useDB {
-			tx.Rollback()
+	// commit files to database
+	if fsh.useDB {
+		err := tx.Commit().Error
+		if err != nil {
+			// the outcome of a failed commit is resolved against the database
+			for _, up := range uploads {
+				if err := fsh.recoverSave(up.st); err != nil {
+					logrus.Errorln(err)
+				}
+			}
+			return &fs.StatusError{Status: http.StatusInternalServerError, Msg: "FAILED_TO_COMMIT_FILE"}
 		}
 	}
 
-	// if user can specify which directory to save file, use it
-	dir := r.URL.Query().Get(urlQueryKeyDirectory)
-
-	if dir != "" {
-		dir = filepath.Clean(dir)
-		if !fsh.isDirAllowed(dir) {
-			rollBack()
-			http.Error(w, "NOT_ALLOWED_ACESS_TO_DIRECTORY", http.StatusBadRequest)
-			return
+	// the files are saved, a failure from here on is resolved by recovery on next start
+	for _, up := range uploads {
+		err := faultHook(stepCommitted)
+		if err == nil {
+			err = up.st.finish()
+		}
+		if err != nil {
+			logrus.Errorln(err)
 		}
 	}
 
-	// use default uploads when user has not specified which directory to save the file
-	if dir == "" {
-		dir = fsh.defaultDir
+	return nil
+}
+
+// StoreFile stores data with its metadata in dir the way the handler stores uploads, so that a handler serving dir
+// never reads a partial file and resolves an interrupted store when it starts. A nil db stores the file only
+func StoreFile(db *gorm.DB, dir string, meta *fs.FileMeta, data []byte) error {
+	fsh := &fsHandler{
+		db:                  db,
+		useDB:               db != nil,
+		maxBatchConcurrency: 1,
 	}
 
-	// path to file
-	filePath := filepath.Join(dir, key)
+	up := &upload{Upload: &fs.Upload{
+		Key:      meta.ID,
+		Path:     meta.Path,
+		Name:     meta.Name,
+		Mime:     meta.Mime,
+		OwnerID:  meta.OwnerID,
+		OwnerTag: meta.OwnerTag,
+		Size:     int64(len(data)),
+		Data:     data,
+	}}
 
-	// create the file
-	newFile, err := os.Create(filePath)
-	if err != nil {
-		rollBack()
-		http.Error(w, "CANT_CREATE_FILE", http.StatusInternalServerError)
-		return
+	serr := fsh.storeUploads(filepath.Clean(dir), []*upload{up})
+	if serr != nil {
+		return serr
 	}
-	defer newFile.Close()
+	return nil
+}
 
-	_, err = newFile.Write(bs)
+// rowDir returns the directory recorded in the rows of files stored in dir, which is absolute
+// so that handlers and tools naming the directory differently record the same one
+func rowDir(dir string) string {
+	abs, err := filepath.Abs(dir)
 	if err != nil {
-		rollBack()
-		http.Error(w, "CANT_WRITE_TO_FILE", http.StatusInternalServerError)
-		return
+		return dir
 	}
+	return abs
+}
 
-	// commit file to database
-	if fsh.useDB {
-		err = tx.Commit().Error
+// rollbackUploads rolls back the staged uploads in reverse order
+func rollbackUploads(uploads []*upload) {
+	for i := len(uploads) - 1; i >= 0; i-- {
+		if !uploads[i].staged {
+			continue
+		}
+		err := uploads[i].st.rollback()
 		if err != nil {
-			rollBack()
-			http.Error(w, "FAILED_TO_COMMIT_FILE", http.StatusInternalServerError)
-			return
+			logrus.Errorln(err)
 		}
 	}
-
-	if r.Method == http.MethodPost {
-		w.WriteHeader(http.StatusCreated)
-	}
-
-	w.Write([]byte("SUCCESS"))
 }
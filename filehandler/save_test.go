@@ -1,8 +1,11 @@
 package file
 
 import (
+	fs "github.com/gidyon/file-handlers"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path"
 	"path/filepath"
 )
@@ -114,4 +117,59 @@ var _ = Describe("Save File", func() {
 			Expect(res.Code).Should(BeEquivalentTo(http.StatusCreated))
 		})
 	})
+
+	Context("Storing files outside requests", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "store")
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		meta := func(upath string) *fs.FileMeta {
+			return &fs.FileMeta{
+				ID:      fs.FileKey(upath),
+				OwnerID: "admin",
+				Mime:    "text/plain; charset=utf-8",
+				Name:    path.Base(upath),
+				Path:    upath,
+			}
+		}
+
+		It("should store the file and its metadata and leave nothing staged", func() {
+			m := meta("/stored/notes.txt")
+			defer DB.Unscoped().Delete(&fs.FileInfo{}, "id=?", m.ID)
+
+			Expect(StoreFile(DB, dir, m, []byte("notes"))).ShouldNot(HaveOccurred())
+
+			bs, err := ioutil.ReadFile(filepath.Join(dir, m.ID))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(string(bs)).Should(Equal("notes"))
+
+			fileInfo := &fs.FileInfo{}
+			Expect(DB.First(fileInfo, "id=?", m.ID).Error).ShouldNot(HaveOccurred())
+			Expect(fileInfo.Path).Should(Equal("/stored/notes.txt"))
+			Expect(fileInfo.Size).Should(BeEquivalentTo(5))
+
+			finfos, err := ioutil.ReadDir(stagingDir(dir))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(finfos).Should(BeEmpty())
+		})
+
+		It("should replace a stored file", func() {
+			m := meta("/stored/replaced.txt")
+			Expect(ioutil.WriteFile(filepath.Join(dir, m.ID), []byte("old"), 0644)).ShouldNot(HaveOccurred())
+
+			Expect(StoreFile(nil, dir, m, []byte("new"))).ShouldNot(HaveOccurred())
+
+			bs, err := ioutil.ReadFile(filepath.Join(dir, m.ID))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(string(bs)).Should(Equal("new"))
+		})
+	})
 })
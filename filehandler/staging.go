@@ -0,0 +1,378 @@
+package file
+
+import (
+	"encoding/json"
+	fs "github.com/gidyon/file-handlers"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Files are written and removed through a write-ahead staging protocol so that disk and metadata stay consistent across failures.
+// Every operation first records a journal in the staging directory of the target directory.
+// A save writes and syncs a temporary file, records the journal, inserts the metadata row, swaps the temporary file into place and commits.
+// A delete records the journal, marks the metadata row as deleted, unlinks the file and purges the row.
+// Journals left behind by a crash are resolved by recoverStaging when the handler starts. A save is committed when its
+// metadata row carries the id of its stage.
+
+const (
+	stagingDirName = ".staging"
+	journalExt     = ".journal"
+	tempExt        = ".tmp"
+	backupExt      = ".bak"
+
+	opSave   = "save"
+	opDelete = "delete"
+)
+
+// Steps of the staging protocol at which faultHook is called
+const (
+	stepTempWritten = "temp-written"
+	stepRowSaved    = "row-saved"
+	stepInstalled   = "installed"
+	stepCommitted   = "committed"
+	stepMarked      = "marked"
+	stepUnlinked    = "unlinked"
+)
+
+// orphanAge is the age after which files in a staging directory without a journal are removed on recovery
+var orphanAge = time.Hour
+
+// faultHook is called after each step of the staging protocol. Tests replace it to inject failures
+var faultHook = func(step string) error {
+	return nil
+}
+
+// journal records an in-flight operation on a file
+type journal struct {
+	Op        string    `json:"op"`
+	Key       string    `json:"key"`
+	Stamp     time.Time `json:"stamp"`
+	Committed bool      `json:"committed"`
+}
+
+// stage is an in-flight operation on a file in a directory
+type stage struct {
+	id  string
+	dir string
+	j   *journal
+}
+
+func newStage(dir, op, key string) *stage {
+	return &stage{
+		id:  uuid.New().String(),
+		dir: dir,
+		j: &journal{
+			Op:    op,
+			Key:   key,
+			Stamp: time.Now().UTC().Truncate(time.Second),
+		},
+	}
+}
+
+// stagingDir returns the staging directory for files in dir
+func stagingDir(dir string) string {
+	return filepath.Join(dir, stagingDirName)
+}
+
+func (s *stage) path(ext string) string {
+	return filepath.Join(stagingDir(s.dir), s.id+ext)
+}
+
+func (s *stage) target() string {
+	return filepath.Join(s.dir, s.j.Key)
+}
+
+// writeTemp writes data to the temporary file of the stage and syncs it to disk
+func (s *stage) writeTemp(data []byte) error {
+	err := os.MkdirAll(stagingDir(s.dir), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = writeSynced(s.path(tempExt), data)
+	if err != nil {
+		os.Remove(s.path(tempExt))
+		return err
+	}
+
+	return nil
+}
+
+// writeJournal atomically replaces the journal of the stage
+func (s *stage) writeJournal() error {
+	err := os.MkdirAll(stagingDir(s.dir), 0755)
+	if err != nil {
+		return err
+	}
+
+	bs, err := json.Marshal(s.j)
+	if err != nil {
+		return err
+	}
+
+	name := s.path(journalExt)
+	err = writeSynced(name+tempExt, bs)
+	if err != nil {
+		os.Remove(name + tempExt)
+		return err
+	}
+
+	err = os.Rename(name+tempExt, name)
+	if err != nil {
+		os.Remove(name + tempExt)
+		return err
+	}
+
+	return syncDir(stagingDir(s.dir))
+}
+
+// install moves an existing target file to the backup and renames the temporary file into its place
+func (s *stage) install() error {
+	err := os.Rename(s.target(), s.path(backupExt))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	err = os.Rename(s.path(tempExt), s.target())
+	if err != nil {
+		// put back the previous file
+		os.Rename(s.path(backupExt), s.target())
+		return err
+	}
+
+	return syncDir(s.dir)
+}
+
+// installed reports whether the temporary file has been renamed into place
+func (s *stage) installed() bool {
+	_, err := os.Stat(s.path(tempExt))
+	return os.IsNotExist(err)
+}
+
+// rollback undoes an uncommitted save by restoring the previous file and discards the stage
+func (s *stage) rollback() error {
+	installed := s.installed()
+	if !installed {
+		err := os.Remove(s.path(tempExt))
+		if err != nil {
+			return err
+		}
+	}
+
+	err := os.Rename(s.path(backupExt), s.target())
+	switch {
+	case os.IsNotExist(err) && installed:
+		// there was no previous file, remove the installed one
+		err = os.Remove(s.target())
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	}
+
+	err = syncDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	return s.discard()
+}
+
+// finish records that the operation committed and removes the backup and journal
+func (s *stage) finish() error {
+	if !s.j.Committed {
+		s.j.Committed = true
+		err := s.writeJournal()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := os.Remove(s.path(backupExt))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return s.discard()
+}
+
+// discard removes the journal of the stage
+func (s *stage) discard() error {
+	err := os.Remove(s.path(journalExt))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// recoverStaging resolves operations interrupted by a crash in the staging directories of all allowed directories.
+// Saves that committed are kept and the rest are rolled back. Deletes whose row was marked are completed.
+func (fsh *fsHandler) recoverStaging() error {
+	for _, dir := range fsh.allowedDirs {
+		err := fsh.recoverDir(dir)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fsh *fsHandler) recoverDir(dir string) error {
+	finfos, err := ioutil.ReadDir(stagingDir(dir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	resolved := make(map[string]struct{})
+	for _, finfo := range finfos {
+		name := finfo.Name()
+		if !strings.HasSuffix(name, journalExt) {
+			continue
+		}
+
+		bs, err := ioutil.ReadFile(filepath.Join(stagingDir(dir), name))
+		if err != nil {
+			return err
+		}
+
+		s := &stage{
+			id:  strings.TrimSuffix(name, journalExt),
+			dir: dir,
+			j:   &journal{},
+		}
+
+		err = json.Unmarshal(bs, s.j)
+		if err != nil {
+			return err
+		}
+
+		resolved[s.id] = struct{}{}
+
+		switch s.j.Op {
+		case opSave:
+			err = fsh.recoverSave(s)
+		case opDelete:
+			err = fsh.recoverDelete(s)
+		default:
+			err = s.discard()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// whatever is left of the resolved operations goes, files of other operations only once they are orphaned.
+	// Another handler or process may still be writing them
+	for _, finfo := range finfos {
+		id := strings.SplitN(finfo.Name(), ".", 2)[0]
+		if _, ok := resolved[id]; !ok && time.Since(finfo.ModTime()) < orphanAge {
+			continue
+		}
+		err = os.Remove(filepath.Join(stagingDir(dir), finfo.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (fsh *fsHandler) recoverSave(s *stage) error {
+	committed := s.j.Committed
+	if !committed && s.installed() {
+		if fsh.useDB {
+			// the commit may have succeeded before the journal was updated
+			fileInfo := &fs.FileInfo{}
+			err := fsh.db.Unscoped().First(fileInfo, "id=?", s.j.Key).Error
+			if err != nil && !gorm.IsRecordNotFoundError(err) {
+				return err
+			}
+			committed = err == nil && fileInfo.DeletedAt == nil && fileInfo.StageID == s.id
+		} else {
+			committed = true
+		}
+	}
+
+	if committed {
+		return s.finish()
+	}
+
+	return s.rollback()
+}
+
+func (fsh *fsHandler) recoverDelete(s *stage) error {
+	if fsh.useDB {
+		fileInfo := &fs.FileInfo{}
+		err := fsh.db.Unscoped().First(fileInfo, "id=?", s.j.Key).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+		if err != nil || fileInfo.DeletedAt == nil {
+			// the row was never marked, so the file was not unlinked. A missing row is a delete the handler refused
+			// or one that already completed
+			return s.discard()
+		}
+	}
+
+	err := os.Remove(s.target())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if fsh.useDB {
+		err = fsh.db.Unscoped().Delete(&fs.FileInfo{}, "id=? AND deleted_at IS NOT NULL", s.j.Key).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.discard()
+}
+
+// writeSynced writes data to a new file and syncs it to disk
+func writeSynced(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// syncDir syncs directory entries to disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	err = d.Sync()
+	if err != nil {
+		d.Close()
+		return err
+	}
+
+	return d.Close()
+}
@@ -0,0 +1,280 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	fs "github.com/gidyon/file-handlers"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var errCrash = errors.New("crash")
+
+var _ = Describe("Staging protocol with injected faults", func() {
+	var (
+		fsh     *fsHandler
+		res     *httptest.ResponseRecorder
+		fileURL string
+		key     string
+		count   int
+	)
+
+	// failAt makes the protocol fail with an error after step
+	failAt := func(step string) {
+		faultHook = func(s string) error {
+			if s == step {
+				return errors.New("injected fault")
+			}
+			return nil
+		}
+	}
+
+	// crashAt makes the protocol stop abruptly after step
+	crashAt := func(step string) {
+		faultHook = func(s string) error {
+			if s == step {
+				panic(errCrash)
+			}
+			return nil
+		}
+	}
+
+	// serve serves the request, absorbing a simulated crash
+	serve := func(req *http.Request) (crashed bool) {
+		defer func() {
+			if v := recover(); v != nil {
+				Expect(v).Should(Equal(errCrash))
+				crashed = true
+			}
+		}()
+		fsh.ServeHTTP(res, req)
+		return false
+	}
+
+	saveRequest := func(method, name string) *http.Request {
+		body, ctype, err := createFormFile(filepath.Join(DataDir, name))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		req := httptest.NewRequest(method, Server.URL()+fileURL, body)
+		req.Header.Set("content-type", ctype)
+		return req
+	}
+
+	deleteRequest := func() *http.Request {
+		return httptest.NewRequest(http.MethodDelete, Server.URL()+fileURL, nil)
+	}
+
+	// age dates every file in the staging directory back by d
+	age := func(d time.Duration) {
+		finfos, err := ioutil.ReadDir(stagingDir(fsh.defaultDir))
+		Expect(err).ShouldNot(HaveOccurred())
+		for _, finfo := range finfos {
+			then := finfo.ModTime().Add(-d)
+			Expect(os.Chtimes(filepath.Join(stagingDir(fsh.defaultDir), finfo.Name()), then, then)).ShouldNot(HaveOccurred())
+		}
+	}
+
+	target := func() string {
+		return filepath.Join(fsh.defaultDir, key)
+	}
+
+	findRow := func() (*fs.FileInfo, error) {
+		fileInfo := &fs.FileInfo{}
+		return fileInfo, DB.Unscoped().First(fileInfo, "id=?", key).Error
+	}
+
+	expectStagingEmpty := func() {
+		finfos, err := ioutil.ReadDir(stagingDir(fsh.defaultDir))
+		if os.IsNotExist(err) {
+			return
+		}
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(finfos).Should(BeEmpty())
+	}
+
+	expectNoFile := func() {
+		_, err := os.Stat(target())
+		Expect(os.IsNotExist(err)).Should(BeTrue())
+		_, err = findRow()
+		Expect(err).Should(HaveOccurred())
+	}
+
+	expectFile := func(name string) {
+		bs, err := ioutil.ReadFile(target())
+		Expect(err).ShouldNot(HaveOccurred())
+		want, err := ioutil.ReadFile(filepath.Join(DataDir, name))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(bs).Should(Equal(want))
+
+		fileInfo, err := findRow()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(fileInfo.DeletedAt).Should(BeNil())
+		Expect(fileInfo.Name).Should(Equal(name))
+	}
+
+	BeforeEach(func() {
+		var ok bool
+		fsh, ok = Handler.(*fsHandler)
+		Expect(ok).Should(BeTrue())
+
+		res = httptest.NewRecorder()
+		count++
+		fileURL = fmt.Sprintf("/staged/%d", count)
+		key = fsh.fileKey(fileURL)
+	})
+
+	AfterEach(func() {
+		faultHook = func(string) error { return nil }
+		os.Remove(target())
+		DB.Unscoped().Delete(&fs.FileInfo{}, "id=?", key)
+	})
+
+	Context("Saving a file", func() {
+		It("should roll back when saving metadata fails", func() {
+			failAt(stepRowSaved)
+			Expect(serve(saveRequest(http.MethodPost, "leo.jpg"))).Should(BeFalse())
+			Expect(res.Code).Should(Equal(http.StatusInternalServerError))
+
+			expectNoFile()
+			expectStagingEmpty()
+		})
+
+		It("should keep the previous file when installing the new one fails", func() {
+			Expect(serve(saveRequest(http.MethodPost, "leo.jpg"))).Should(BeFalse())
+			Expect(res.Code).Should(Equal(http.StatusCreated))
+
+			failAt(stepInstalled)
+			res = httptest.NewRecorder()
+			Expect(serve(saveRequest(http.MethodPut, "sala.webp"))).Should(BeFalse())
+			Expect(res.Code).Should(Equal(http.StatusInternalServerError))
+
+			expectFile("leo.jpg")
+			expectStagingEmpty()
+		})
+
+		It("should roll back on recovery after a crash before commit", func() {
+			crashAt(stepInstalled)
+			Expect(serve(saveRequest(http.MethodPost, "leo.jpg"))).Should(BeTrue())
+
+			Expect(fsh.recoverStaging()).ShouldNot(HaveOccurred())
+			expectNoFile()
+			expectStagingEmpty()
+		})
+
+		It("should restore the previous file on recovery after a crash before commit", func() {
+			Expect(serve(saveRequest(http.MethodPost, "leo.jpg"))).Should(BeFalse())
+
+			crashAt(stepRowSaved)
+			Expect(serve(saveRequest(http.MethodPut, "sala.webp"))).Should(BeTrue())
+
+			Expect(fsh.recoverStaging()).ShouldNot(HaveOccurred())
+			expectFile("leo.jpg")
+			expectStagingEmpty()
+		})
+
+		It("should keep the file on recovery after a crash following commit", func() {
+			crashAt(stepCommitted)
+			Expect(serve(saveRequest(http.MethodPost, "leo.jpg"))).Should(BeTrue())
+
+			Expect(fsh.recoverStaging()).ShouldNot(HaveOccurred())
+			expectFile("leo.jpg")
+			expectStagingEmpty()
+		})
+
+		It("should restore the previous file on recovery after a crash following install in the same second", func() {
+			Expect(serve(saveRequest(http.MethodPost, "leo.jpg"))).Should(BeFalse())
+
+			// the row of the previous save is not older than the stamp of the interrupted one
+			Expect(DB.Model(&fs.FileInfo{}).Where("id=?", key).UpdateColumn("updated_at", time.Now().Add(time.Minute)).Error).ShouldNot(HaveOccurred())
+
+			crashAt(stepInstalled)
+			Expect(serve(saveRequest(http.MethodPut, "sala.webp"))).Should(BeTrue())
+
+			Expect(fsh.recoverStaging()).ShouldNot(HaveOccurred())
+			expectFile("leo.jpg")
+			expectStagingEmpty()
+		})
+
+		It("should remove orphaned temporary files that have no journal on recovery", func() {
+			crashAt(stepTempWritten)
+			Expect(serve(saveRequest(http.MethodPost, "leo.jpg"))).Should(BeTrue())
+			age(orphanAge + time.Minute)
+
+			Expect(fsh.recoverStaging()).ShouldNot(HaveOccurred())
+			expectNoFile()
+			expectStagingEmpty()
+		})
+
+		It("should keep recent temporary files of saves in progress on recovery", func() {
+			crashAt(stepTempWritten)
+			Expect(serve(saveRequest(http.MethodPost, "leo.jpg"))).Should(BeTrue())
+
+			Expect(fsh.recoverStaging()).ShouldNot(HaveOccurred())
+			finfos, err := ioutil.ReadDir(stagingDir(fsh.defaultDir))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(finfos).Should(HaveLen(1))
+
+			age(orphanAge + time.Minute)
+			Expect(fsh.recoverStaging()).ShouldNot(HaveOccurred())
+			expectStagingEmpty()
+		})
+	})
+
+	Context("Deleting a file", func() {
+		BeforeEach(func() {
+			Expect(serve(saveRequest(http.MethodPost, "leo.jpg"))).Should(BeFalse())
+			Expect(res.Code).Should(Equal(http.StatusCreated))
+			res = httptest.NewRecorder()
+		})
+
+		It("should keep the file when marking fails", func() {
+			failAt(stepMarked)
+			Expect(serve(deleteRequest())).Should(BeFalse())
+			Expect(res.Code).Should(Equal(http.StatusInternalServerError))
+
+			expectFile("leo.jpg")
+			expectStagingEmpty()
+		})
+
+		It("should complete the delete on recovery after a crash following mark", func() {
+			crashAt(stepMarked)
+			Expect(serve(deleteRequest())).Should(BeTrue())
+
+			Expect(fsh.recoverStaging()).ShouldNot(HaveOccurred())
+			expectNoFile()
+			expectStagingEmpty()
+		})
+
+		It("should purge the row on recovery after a crash following unlink", func() {
+			crashAt(stepUnlinked)
+			Expect(serve(deleteRequest())).Should(BeTrue())
+
+			Expect(fsh.recoverStaging()).ShouldNot(HaveOccurred())
+			expectNoFile()
+			expectStagingEmpty()
+		})
+
+		It("should keep the file on recovery of a delete whose row does not exist", func() {
+			Expect(DB.Unscoped().Delete(&fs.FileInfo{}, "id=?", key).Error).ShouldNot(HaveOccurred())
+
+			st := newStage(fsh.defaultDir, opDelete, key)
+			Expect(st.writeJournal()).ShouldNot(HaveOccurred())
+
+			Expect(fsh.recoverStaging()).ShouldNot(HaveOccurred())
+			Expect(target()).Should(BeAnExistingFile())
+			expectStagingEmpty()
+		})
+
+		It("should purge the row when the delete succeeds", func() {
+			Expect(serve(deleteRequest())).Should(BeFalse())
+			Expect(res.Code).Should(Equal(http.StatusOK))
+
+			expectNoFile()
+			expectStagingEmpty()
+		})
+	})
+})
@@ -0,0 +1,14 @@
+package fs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path"
+)
+
+// FileKey returns the key under which the file handlers store the file at a URL path. The path is relative to
+// where the handler is mounted, and is cleaned and rooted so that equivalent paths give the same key
+func FileKey(upath string) string {
+	upath = path.Clean("/" + upath)
+	return fmt.Sprintf("%x", string(sha256.New().Sum([]byte(upath))))
+}
@@ -0,0 +1,351 @@
+// Package migrate applies ordered and versioned schema migrations for the file handlers.
+// Migrations are compiled into the binary and applied versions are recorded in a migrations table, so that each migration runs exactly once per source.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// TableName is the name of the table that records applied migrations
+const TableName = "schema_migrations"
+
+// lockName is the name of the advisory lock held while migrations are applied or reverted
+const lockName = "file-handlers." + TableName
+
+// lockTimeout is how long to wait for migrations applied by another process
+var lockTimeout = time.Minute
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version uint                 // Version of the migration, must be unique and greater than zero
+	Name    string               // Short description of the migration
+	Up      func(*gorm.DB) error // Applies the migration
+	Down    func(*gorm.DB) error // Reverts the migration, nil if the migration is irreversible
+	// Adopt reports whether the schema of the migration already exists, such as tables of earlier releases.
+	// An adopted migration is recorded without running Up, and reverting it leaves the schema in place. Nil if the migration always runs
+	Adopt func(*gorm.DB) bool
+}
+
+// Status contains the state of a migration in the database
+type Status struct {
+	Version   uint
+	Name      string
+	Applied   bool
+	Adopted   bool // the schema existed when the migration was applied
+	AppliedAt *time.Time
+}
+
+// record is a row in the migrations table
+type record struct {
+	Source    string `gorm:"primary_key;type:varchar(50)"`
+	Version   uint   `gorm:"primary_key;auto_increment:false"`
+	Name      string `gorm:"type:varchar(100)"`
+	Adopted   bool
+	AppliedAt time.Time
+}
+
+func (*record) TableName() string {
+	return TableName
+}
+
+// Migrator applies the migrations of a source to a database
+type Migrator struct {
+	db         *gorm.DB
+	source     string
+	migrations []*Migration
+}
+
+// New creates a migrator for the migrations of source. Source namespaces the recorded versions so that several handlers can share one database.
+// Migrations are applied in ascending order of version regardless of their order in the slice.
+func New(db *gorm.DB, source string, migrations []*Migration) (*Migrator, error) {
+	if db == nil {
+		return nil, errors.New("database connection is required")
+	}
+	if source == "" {
+		return nil, errors.New("migration source is required")
+	}
+
+	// sort a copy of the migrations by version
+	sorted := make([]*Migration, 0, len(migrations))
+	versions := make(map[uint]struct{}, len(migrations))
+	for _, migration := range migrations {
+		if migration == nil {
+			return nil, errors.New("nil migration")
+		}
+		if migration.Version == 0 {
+			return nil, errors.Errorf("migration %q has no version", migration.Name)
+		}
+		if migration.Up == nil {
+			return nil, errors.Errorf("migration %d has no up function", migration.Version)
+		}
+		if _, ok := versions[migration.Version]; ok {
+			return nil, errors.Errorf("duplicate migration version %d", migration.Version)
+		}
+		versions[migration.Version] = struct{}{}
+		sorted = append(sorted, migration)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	return &Migrator{
+		db:         db,
+		source:     source,
+		migrations: sorted,
+	}, nil
+}
+
+// Up applies all pending migrations in ascending order of version. Each migration runs in its own transaction,
+// but MySQL commits schema changes implicitly, so a failed migration may leave part of its changes applied.
+// Processes migrating the same database wait for each other on MySQL so that no migration runs twice.
+func (m *Migrator) Up() (err error) {
+	unlock, err := m.lock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if uerr := unlock(); err == nil {
+			err = uerr
+		}
+	}()
+
+	applied, err := m.applied()
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err = m.apply(func(tx *gorm.DB) error {
+			adopted := migration.Adopt != nil && migration.Adopt(tx)
+			if !adopted {
+				err := migration.Up(tx)
+				if err != nil {
+					return err
+				}
+			}
+			return tx.Create(&record{
+				Source:    m.source,
+				Version:   migration.Version,
+				Name:      migration.Name,
+				Adopted:   adopted,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to apply migration %d (%s)", migration.Version, migration.Name)
+		}
+	}
+
+	return nil
+}
+
+// Down reverts the given number of most recently applied migrations in descending order of version.
+// Adopted migrations are only removed from the migrations table, the schema they found is left in place.
+// Like Up, it waits for other processes migrating the same MySQL database.
+func (m *Migrator) Down(steps int) (err error) {
+	if steps < 1 {
+		return errors.New("steps must be greater than zero")
+	}
+
+	unlock, err := m.lock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if uerr := unlock(); err == nil {
+			err = uerr
+		}
+	}()
+
+	applied, err := m.applied()
+	if err != nil {
+		return err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+		migration := m.migrations[i]
+		rec, ok := applied[migration.Version]
+		if !ok {
+			continue
+		}
+		if migration.Down == nil && !rec.Adopted {
+			return errors.Errorf("migration %d (%s) is irreversible", migration.Version, migration.Name)
+		}
+
+		err = m.apply(func(tx *gorm.DB) error {
+			if !rec.Adopted {
+				err := migration.Down(tx)
+				if err != nil {
+					return err
+				}
+			}
+			return tx.Delete(&record{}, "source=? AND version=?", m.source, migration.Version).Error
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to revert migration %d (%s)", migration.Version, migration.Name)
+		}
+		steps--
+	}
+
+	return nil
+}
+
+// Status returns the state of every known migration in ascending order of version
+func (m *Migrator) Status() ([]*Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := &Status{
+			Version: migration.Version,
+			Name:    migration.Name,
+		}
+		if rec, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.Adopted = rec.Adopted
+			status.AppliedAt = &rec.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Run executes a migrate command against the migrator and writes its output to w.
+// Supported commands are "up", "down [steps]" and "status". Down reverts one migration when steps is omitted.
+func (m *Migrator) Run(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("missing command: expected up, down or status")
+	}
+
+	switch args[0] {
+	case "up":
+		if len(args) > 1 {
+			return errors.New("up takes no arguments")
+		}
+		return m.Up()
+	case "down":
+		steps := 1
+		if len(args) > 2 {
+			return errors.New("down takes at most one argument")
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return errors.Wrap(err, "invalid number of steps")
+			}
+			steps = n
+		}
+		return m.Down(steps)
+	case "status":
+		if len(args) > 1 {
+			return errors.New("status takes no arguments")
+		}
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "SOURCE\tVERSION\tNAME\tAPPLIED AT\n")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			if status.Adopted {
+				appliedAt += " (adopted)"
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", m.source, status.Version, status.Name, appliedAt)
+		}
+		return tw.Flush()
+	default:
+		return errors.Errorf("unknown command %q: expected up, down or status", args[0])
+	}
+}
+
+// applied returns the applied migrations of the source keyed by version
+func (m *Migrator) applied() (map[uint]*record, error) {
+	// creates the migrations table, or adds the columns that migrations tables of earlier releases lack
+	err := m.db.AutoMigrate(&record{}).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create migrations table")
+	}
+
+	records := make([]*record, 0)
+	err = m.db.Find(&records, "source=?", m.source).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read migrations table")
+	}
+
+	applied := make(map[uint]*record, len(records))
+	for _, rec := range records {
+		applied[rec.Version] = rec
+	}
+
+	return applied, nil
+}
+
+// lock takes the advisory lock of the migrations and returns the function releasing it.
+// The lock belongs to a session, so it is taken on a connection of its own. Only MySQL is locked
+func (m *Migrator) lock() (func() error, error) {
+	if m.db.Dialect().GetName() != "mysql" {
+		return func() error { return nil }, nil
+	}
+
+	ctx := context.Background()
+	conn, err := m.db.DB().Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to lock migrations")
+	}
+
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, int(lockTimeout/time.Second)).Scan(&locked)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "failed to lock migrations")
+	}
+	if locked.Int64 != 1 {
+		conn.Close()
+		return nil, errors.Errorf("timed out after %s waiting for migrations lock held by another process", lockTimeout)
+	}
+
+	return func() error {
+		defer conn.Close()
+		var released sql.NullInt64
+		err := conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", lockName).Scan(&released)
+		return errors.Wrap(err, "failed to unlock migrations")
+	}, nil
+}
+
+// apply runs fn in a transaction
+func (m *Migrator) apply(fn func(*gorm.DB) error) error {
+	tx := m.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	err := fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
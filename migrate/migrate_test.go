@@ -0,0 +1,236 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+const testSource = "migrate-test"
+
+type widget struct {
+	ID   uint `gorm:"primary_key"`
+	Name string
+}
+
+type gadget struct {
+	ID uint `gorm:"primary_key"`
+}
+
+func testMigrations() []*Migration {
+	return []*Migration{
+		{
+			Version: 2,
+			Name:    "create gadgets table",
+			Up: func(tx *gorm.DB) error {
+				return tx.CreateTable(&gadget{}).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.DropTableIfExists(&gadget{}).Error
+			},
+		},
+		{
+			Version: 1,
+			Name:    "create widgets table",
+			Up: func(tx *gorm.DB) error {
+				return tx.CreateTable(&widget{}).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.DropTableIfExists(&widget{}).Error
+			},
+		},
+	}
+}
+
+var _ = Describe("Versioned migrations", func() {
+
+	AfterEach(func() {
+		DB.DropTableIfExists(&widget{}, &gadget{})
+		DB.Delete(&record{}, "source=?", testSource)
+	})
+
+	Context("Creating migrator", func() {
+		It("should fail when database connection is nil", func() {
+			_, err := New(nil, testSource, testMigrations())
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should fail when source is empty", func() {
+			_, err := New(DB, "", testMigrations())
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should fail when a version is duplicated", func() {
+			migrations := append(testMigrations(), &Migration{Version: 1, Up: func(*gorm.DB) error { return nil }})
+			_, err := New(DB, testSource, migrations)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should fail when a migration has no version or up function", func() {
+			_, err := New(DB, testSource, []*Migration{{Up: func(*gorm.DB) error { return nil }}})
+			Expect(err).Should(HaveOccurred())
+
+			_, err = New(DB, testSource, []*Migration{{Version: 1}})
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("Applying and reverting migrations", func() {
+		It("should apply pending migrations in order and only once", func() {
+			migrator, err := New(DB, testSource, testMigrations())
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(migrator.Up()).ShouldNot(HaveOccurred())
+			Expect(DB.HasTable(&widget{})).Should(BeTrue())
+			Expect(DB.HasTable(&gadget{})).Should(BeTrue())
+
+			// applying again is a no-op
+			Expect(migrator.Up()).ShouldNot(HaveOccurred())
+
+			statuses, err := migrator.Status()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(statuses).Should(HaveLen(2))
+			Expect(statuses[0].Version).Should(BeEquivalentTo(1))
+			Expect(statuses[0].Applied).Should(BeTrue())
+			Expect(statuses[1].Version).Should(BeEquivalentTo(2))
+			Expect(statuses[1].Applied).Should(BeTrue())
+		})
+
+		It("should revert the latest migrations", func() {
+			migrator, err := New(DB, testSource, testMigrations())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(migrator.Up()).ShouldNot(HaveOccurred())
+
+			Expect(migrator.Down(1)).ShouldNot(HaveOccurred())
+			Expect(DB.HasTable(&gadget{})).Should(BeFalse())
+			Expect(DB.HasTable(&widget{})).Should(BeTrue())
+
+			statuses, err := migrator.Status()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(statuses[0].Applied).Should(BeTrue())
+			Expect(statuses[1].Applied).Should(BeFalse())
+
+			Expect(migrator.Down(5)).ShouldNot(HaveOccurred())
+			Expect(DB.HasTable(&widget{})).Should(BeFalse())
+		})
+
+		It("should adopt an existing schema and leave it in place when reverting", func() {
+			Expect(DB.CreateTable(&widget{}).Error).ShouldNot(HaveOccurred())
+			Expect(DB.Create(&widget{Name: "legacy"}).Error).ShouldNot(HaveOccurred())
+
+			migrations := testMigrations()
+			for _, migration := range migrations {
+				migration.Adopt = func(tx *gorm.DB) bool {
+					return tx.HasTable(&widget{}) && migration.Version == 1
+				}
+			}
+			migrator, err := New(DB, testSource, migrations)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(migrator.Up()).ShouldNot(HaveOccurred())
+
+			statuses, err := migrator.Status()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(statuses[0].Adopted).Should(BeTrue())
+			Expect(statuses[1].Adopted).Should(BeFalse())
+
+			Expect(migrator.Down(2)).ShouldNot(HaveOccurred())
+			Expect(DB.HasTable(&gadget{})).Should(BeFalse())
+			Expect(DB.HasTable(&widget{})).Should(BeTrue())
+
+			count := 0
+			Expect(DB.Model(&widget{}).Count(&count).Error).ShouldNot(HaveOccurred())
+			Expect(count).Should(Equal(1))
+
+			statuses, err = migrator.Status()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(statuses[0].Applied).Should(BeFalse())
+		})
+
+		It("should not record a migration whose up function fails", func() {
+			migrations := append(testMigrations(), &Migration{
+				Version: 3,
+				Name:    "broken",
+				Up: func(tx *gorm.DB) error {
+					return tx.Exec("NOT VALID SQL").Error
+				},
+			})
+			migrator, err := New(DB, testSource, migrations)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(migrator.Up()).Should(HaveOccurred())
+
+			statuses, err := migrator.Status()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(statuses[1].Applied).Should(BeTrue())
+			Expect(statuses[2].Applied).Should(BeFalse())
+		})
+	})
+
+	Context("Migrating from several processes", func() {
+		var timeout time.Duration
+
+		BeforeEach(func() {
+			if DB.Dialect().GetName() != "mysql" {
+				Skip("advisory locks are only taken on mysql")
+			}
+			timeout = lockTimeout
+			lockTimeout = time.Second
+		})
+
+		AfterEach(func() {
+			lockTimeout = timeout
+		})
+
+		It("should wait for the migrations lock held by another process", func() {
+			ctx := context.Background()
+			conn, err := DB.DB().Conn(ctx)
+			Expect(err).ShouldNot(HaveOccurred())
+			defer conn.Close()
+
+			locked := 0
+			Expect(conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", lockName).Scan(&locked)).ShouldNot(HaveOccurred())
+			Expect(locked).Should(Equal(1))
+
+			migrator, err := New(DB, testSource, testMigrations())
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = migrator.Up()
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("migrations lock"))
+			Expect(DB.HasTable(&widget{})).Should(BeFalse())
+
+			released := 0
+			Expect(conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", lockName).Scan(&released)).ShouldNot(HaveOccurred())
+
+			Expect(migrator.Up()).ShouldNot(HaveOccurred())
+			Expect(DB.HasTable(&widget{})).Should(BeTrue())
+			Expect(migrator.Down(2)).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("Running commands", func() {
+		It("should run up, status and down commands", func() {
+			migrator, err := New(DB, testSource, testMigrations())
+			Expect(err).ShouldNot(HaveOccurred())
+
+			out := &bytes.Buffer{}
+			Expect(migrator.Run([]string{"up"}, out)).ShouldNot(HaveOccurred())
+			Expect(migrator.Run([]string{"status"}, out)).ShouldNot(HaveOccurred())
+			Expect(out.String()).Should(ContainSubstring("create widgets table"))
+			Expect(migrator.Run([]string{"down", "2"}, out)).ShouldNot(HaveOccurred())
+			Expect(DB.HasTable(&widget{})).Should(BeFalse())
+		})
+
+		It("should fail on unknown commands and bad arguments", func() {
+			migrator, err := New(DB, testSource, testMigrations())
+			Expect(err).ShouldNot(HaveOccurred())
+
+			out := &bytes.Buffer{}
+			Expect(migrator.Run(nil, out)).Should(HaveOccurred())
+			Expect(migrator.Run([]string{"sideways"}, out)).Should(HaveOccurred())
+			Expect(migrator.Run([]string{"down", "many"}, out)).Should(HaveOccurred())
+			Expect(migrator.Run([]string{"down", "0"}, out)).Should(HaveOccurred())
+		})
+	})
+})
@@ -26,6 +26,8 @@ type FileMeta struct {
 type FileInfo struct {
 	FileMeta
 	Model
+	StageID string `gorm:"type:varchar(36)"` // staged save that last wrote the row, used to recover interrupted saves
+	Dir     string `gorm:"type:text"`        // absolute directory the file is stored in, empty for files stored before it was recorded
 }
 
 // FileData model stores a file metadata and its content
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/gidyon/file-handlers/static"
+	"net/http"
+	"path"
+	"sort"
+)
+
+// MountInfo describes a mounted handler
+type MountInfo struct {
+	Prefix string `json:"prefix"`
+	Kind   string `json:"kind"`
+}
+
+// HandleAPI registers a management endpoint at a path relative to the API prefix
+func (s *Server) HandleAPI(pattern string, handler http.Handler) {
+	s.api.Handle(path.Join(s.apiPrefix, pattern), handler)
+}
+
+// registerAPI registers the built in management endpoints
+func (s *Server) registerAPI() {
+	s.HandleAPI("/health", allowMethod(http.MethodGet, http.HandlerFunc(s.health)))
+	s.HandleAPI("/mounts", allowMethod(http.MethodGet, http.HandlerFunc(s.listMounts)))
+	s.HandleAPI("/assets", allowMethod(http.MethodGet, http.HandlerFunc(s.listAssets)))
+	s.HandleAPI("/reload", allowMethod(http.MethodPost, http.HandlerFunc(s.reload)))
+	s.HandleAPI("/invalidate", allowMethod(http.MethodPost, http.HandlerFunc(s.invalidate)))
+}
+
+// serveAPI authorizes and serves management requests. Without an authorizer only reads are served
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
+	if s.apiAuth == nil && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "API_ACCESS_DENIED", http.StatusForbidden)
+		return
+	}
+
+	if s.apiAuth != nil && !s.apiAuth(r) {
+		http.Error(w, "API_ACCESS_DENIED", http.StatusForbidden)
+		return
+	}
+
+	s.api.ServeHTTP(w, r)
+}
+
+// allowMethod replies with 405 to requests of other methods than method
+func allowMethod(method string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method && !(method == http.MethodGet && r.Method == http.MethodHead) {
+			w.Header().Set("Allow", method)
+			http.Error(w, "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON writes v as the JSON body of the response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	_, err = w.Write(bs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// health replies when the server is up
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{"status": "ok"})
+}
+
+// listMounts replies with the mounted handlers sorted by prefix
+func (s *Server) listMounts(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	infos := make([]MountInfo, 0, len(s.mounts))
+	for _, m := range s.mounts {
+		infos = append(infos, MountInfo{Prefix: m.prefix, Kind: m.kind})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Prefix < infos[j].Prefix
+	})
+
+	writeJSON(w, infos)
+}
+
+// listAssets replies with the cached files of the static file servers
+func (s *Server) listAssets(w http.ResponseWriter, r *http.Request) {
+	assets := make([]static.Asset, 0)
+
+	s.mu.RLock()
+	for _, m := range s.mounts {
+		if manifest, ok := m.handler.(static.AssetManifest); ok {
+			assets = append(assets, manifest.Assets()...)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(assets, func(i, j int) bool {
+		return assets[i].Path < assets[j].Path
+	})
+
+	writeJSON(w, assets)
+}
+
+// reload drops the cached files of the static file servers
+func (s *Server) reload(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, m := range s.mounts {
+		if cache, ok := m.handler.(static.Cache); ok {
+			err := cache.Reload()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// invalidate drops the cached file of the URL path in the path query key from the static file server it is served by
+func (s *Server) invalidate(w http.ResponseWriter, r *http.Request) {
+	upath := r.URL.Query().Get("path")
+	if upath == "" {
+		http.Error(w, "MISSING_PATH", http.StatusBadRequest)
+		return
+	}
+	upath = path.Clean("/" + upath)
+
+	m, ok := s.match(upath)
+	if !ok {
+		http.Error(w, "MOUNT_NOT_FOUND", http.StatusNotFound)
+		return
+	}
+
+	cache, ok := m.handler.(static.Cache)
+	if !ok {
+		http.Error(w, "MOUNT_NOT_CACHED", http.StatusBadRequest)
+		return
+	}
+
+	cache.Invalidate(upath)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,203 @@
+// Package server composes the static, filehandler and dbstorage handlers under URL path prefixes of a single http.Handler.
+// A reserved API prefix serves management endpoints next to them without changing the paths of files.
+package server
+
+import (
+	"github.com/gidyon/file-handlers/dbstorage"
+	file "github.com/gidyon/file-handlers/filehandler"
+	"github.com/gidyon/file-handlers/static"
+	"github.com/go-redis/redis"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultAPIPrefix is the URL path under which management endpoints are served
+const DefaultAPIPrefix = "/_api"
+
+// Kinds of mounted handlers
+const (
+	KindStatic  = "static"
+	KindFiles   = "files"
+	KindDB      = "dbstorage"
+	KindHandler = "handler"
+)
+
+// Options contains options for configuring the server
+type Options struct {
+	APIPrefix string                   // URL path of management endpoints, defaults to DefaultAPIPrefix
+	APIAuth   func(*http.Request) bool // Authorizes management requests. Without it only GET endpoints are served
+}
+
+// mount is a handler served under a URL path prefix
+type mount struct {
+	prefix  string
+	kind    string
+	handler http.Handler
+}
+
+// Server routes requests to the handler mounted at the longest URL path prefix containing them.
+// Requests under the API prefix are served by management endpoints
+type Server struct {
+	apiPrefix string
+	apiAuth   func(*http.Request) bool
+	api       *http.ServeMux
+	mu        *sync.RWMutex // guards mounts
+	mounts    []*mount
+}
+
+// New creates a server without mounts
+func New(opt *Options) (*Server, error) {
+	if opt == nil {
+		opt = &Options{}
+	}
+
+	if opt.APIPrefix == "" {
+		opt.APIPrefix = DefaultAPIPrefix
+	}
+
+	// clean and update APIPrefix
+	opt.APIPrefix = path.Clean("/" + opt.APIPrefix)
+	if opt.APIPrefix == "/" {
+		return nil, errors.New("API prefix cannot be the root path")
+	}
+
+	s := &Server{
+		apiPrefix: opt.APIPrefix,
+		apiAuth:   opt.APIAuth,
+		api:       http.NewServeMux(),
+		mu:        &sync.RWMutex{},
+		mounts:    make([]*mount, 0),
+	}
+
+	s.registerAPI()
+
+	return s, nil
+}
+
+// Mount serves handler under a URL path prefix. The prefix is stripped from request paths,
+// so that handlers see the same paths as when they are served at the root
+func (s *Server) Mount(prefix string, handler http.Handler) error {
+	return s.mount(prefix, KindHandler, handler, true)
+}
+
+// MountStatic creates a static file server and mounts it at the URLPathPrefix of its options
+func (s *Server) MountStatic(opt *static.ServerOptions) error {
+	handler, err := static.NewHandler(opt)
+	if err != nil {
+		return err
+	}
+
+	// the static file server strips its own prefix
+	err = s.mount(opt.URLPathPrefix, KindStatic, handler, false)
+	if err != nil {
+		if cache, ok := handler.(static.Cache); ok {
+			cache.Close()
+		}
+		return err
+	}
+
+	return nil
+}
+
+// MountFiles creates a file server that stores files on disk and mounts it at prefix
+func (s *Server) MountFiles(prefix string, opt *file.ServerOptions) error {
+	handler, err := file.New(opt)
+	if err != nil {
+		return err
+	}
+	return s.mount(prefix, KindFiles, handler, true)
+}
+
+// MountDB creates a file server that stores files in the database and mounts it at prefix
+func (s *Server) MountDB(prefix string, db *gorm.DB, redisClient *redis.Client) error {
+	handler, err := dbstorage.NewFileHandler(db, redisClient)
+	if err != nil {
+		return err
+	}
+	return s.mount(prefix, KindDB, handler, true)
+}
+
+func (s *Server) mount(prefix, kind string, handler http.Handler, strip bool) error {
+	prefix = path.Clean("/" + prefix)
+
+	if withinPrefix(prefix, s.apiPrefix) {
+		return errors.Errorf("URL path prefix %s is reserved for the API", prefix)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range s.mounts {
+		if m.prefix == prefix {
+			return errors.Errorf("URL path prefix %s is mounted more than once", prefix)
+		}
+	}
+
+	if strip && prefix != "/" {
+		handler = http.StripPrefix(prefix, handler)
+	}
+
+	s.mounts = append(s.mounts, &mount{prefix: prefix, kind: kind, handler: handler})
+
+	sort.SliceStable(s.mounts, func(i, j int) bool {
+		return len(s.mounts[i].prefix) > len(s.mounts[j].prefix)
+	})
+
+	return nil
+}
+
+// match returns the mount at the longest prefix containing upath
+func (s *Server) match(upath string) (*mount, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, m := range s.mounts {
+		if withinPrefix(upath, m.prefix) {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	upath := path.Clean("/" + r.URL.Path)
+
+	if withinPrefix(upath, s.apiPrefix) {
+		s.serveAPI(w, r)
+		return
+	}
+
+	m, ok := s.match(upath)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	m.handler.ServeHTTP(w, r)
+}
+
+// Close stops watching and revalidation of files of the mounted static file servers
+func (s *Server) Close() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var err error
+	for _, m := range s.mounts {
+		if cache, ok := m.handler.(static.Cache); ok {
+			if cerr := cache.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
+
+// withinPrefix checks whether a cleaned URL path is the prefix or below it
+func withinPrefix(upath, prefix string) bool {
+	return prefix == "/" || upath == prefix || strings.HasPrefix(upath, prefix+"/")
+}
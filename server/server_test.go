@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	fs "github.com/gidyon/file-handlers"
+	file "github.com/gidyon/file-handlers/filehandler"
+	"github.com/gidyon/file-handlers/static"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing/fstest"
+)
+
+var _ = Describe("Routing requests to mounted handlers", func() {
+	var (
+		res *httptest.ResponseRecorder
+		srv *Server
+		dir string
+	)
+
+	do := func(method, path string) {
+		req := httptest.NewRequest(method, path, nil)
+		res = httptest.NewRecorder()
+		srv.ServeHTTP(res, req)
+	}
+
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	})
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "server")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		srv, err = New(nil)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		err = srv.MountStatic(&static.ServerOptions{
+			FS: fstest.MapFS{
+				"index.html": {Data: []byte("<html>app</html>")},
+				"app.js":     {Data: []byte("app()")},
+			},
+			URLPathPrefix: "/app",
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Expect(srv.Mount("/echo", echo)).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		srv.Close()
+		os.RemoveAll(dir)
+	})
+
+	Context("Serving files", func() {
+		It("should serve static files at their prefix", func() {
+			do(http.MethodGet, "/app/app.js")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("app()"))
+		})
+
+		It("should strip the prefix of other handlers", func() {
+			do(http.MethodGet, "/echo/a/b.txt")
+			Expect(res.Body.String()).Should(Equal("/a/b.txt"))
+		})
+
+		It("should look up files by the same key as without the prefix", func() {
+			key := fs.FileKey("/docs/report.txt")
+			Expect(ioutil.WriteFile(filepath.Join(dir, key), []byte("report"), 0644)).Should(Succeed())
+
+			Expect(srv.MountFiles("/files", &file.ServerOptions{RootDir: dir})).Should(Succeed())
+
+			do(http.MethodGet, "/files/docs/report.txt")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("report"))
+		})
+
+		It("should serve the longest matching prefix", func() {
+			Expect(srv.Mount("/echo/deep", http.NotFoundHandler())).Should(Succeed())
+
+			do(http.MethodGet, "/echo/deep/x")
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+
+			do(http.MethodGet, "/echo/deeper")
+			Expect(res.Body.String()).Should(Equal("/deeper"))
+		})
+
+		It("should reply with 404 outside mounts", func() {
+			do(http.MethodGet, "/other/file.txt")
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+		})
+
+		It("should refuse duplicate and reserved prefixes", func() {
+			Expect(srv.Mount("/echo/", echo)).ShouldNot(Succeed())
+			Expect(srv.Mount("/_api/files", echo)).ShouldNot(Succeed())
+			Expect(srv.Mount("/_apis", echo)).Should(Succeed())
+		})
+	})
+
+	Context("Serving management endpoints", func() {
+		It("should not pass API paths to handlers mounted at the root", func() {
+			Expect(srv.Mount("/", echo)).Should(Succeed())
+
+			do(http.MethodGet, "/_api/health")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(MatchJSON(`{"status": "ok"}`))
+
+			do(http.MethodGet, "/_api.txt")
+			Expect(res.Body.String()).Should(Equal("/_api.txt"))
+		})
+
+		It("should list mounts and cached assets", func() {
+			do(http.MethodGet, "/_api/mounts")
+			Expect(res.Body.String()).Should(MatchJSON(`[{"prefix": "/app", "kind": "static"}, {"prefix": "/echo", "kind": "handler"}]`))
+
+			do(http.MethodGet, "/app/app.js")
+
+			do(http.MethodGet, "/_api/assets")
+			assets := make([]static.Asset, 0)
+			Expect(json.Unmarshal(res.Body.Bytes(), &assets)).Should(Succeed())
+			Expect(assets).Should(HaveLen(1))
+			Expect(assets[0].Path).Should(Equal("/app/app.js"))
+		})
+
+		It("should only allow reads without an authorizer", func() {
+			do(http.MethodPost, "/_api/reload")
+			Expect(res.Code).Should(Equal(http.StatusForbidden))
+		})
+
+		It("should authorize management requests", func() {
+			var err error
+			srv, err = New(&Options{
+				APIPrefix: "/admin/",
+				APIAuth: func(r *http.Request) bool {
+					return r.Header.Get("Authorization") == "Bearer token"
+				},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			do(http.MethodGet, "/admin/health")
+			Expect(res.Code).Should(Equal(http.StatusForbidden))
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+			req.Header.Set("Authorization", "Bearer token")
+			res = httptest.NewRecorder()
+			srv.ServeHTTP(res, req)
+			Expect(res.Code).Should(Equal(http.StatusNoContent))
+
+			req = httptest.NewRequest(http.MethodGet, "/admin/reload", nil)
+			req.Header.Set("Authorization", "Bearer token")
+			res = httptest.NewRecorder()
+			srv.ServeHTTP(res, req)
+			Expect(res.Code).Should(Equal(http.StatusMethodNotAllowed))
+		})
+
+		It("should invalidate cached files of static mounts", func() {
+			srv.apiAuth = func(*http.Request) bool { return true }
+
+			cached := func() []string {
+				do(http.MethodGet, "/_api/assets")
+				assets := make([]static.Asset, 0)
+				Expect(json.Unmarshal(res.Body.Bytes(), &assets)).Should(Succeed())
+				paths := make([]string, 0, len(assets))
+				for _, asset := range assets {
+					paths = append(paths, asset.Path)
+				}
+				return paths
+			}
+
+			do(http.MethodGet, "/app/app.js")
+			do(http.MethodGet, "/app/")
+			Expect(cached()).Should(ConsistOf("/app/app.js", "/app/index.html"))
+
+			do(http.MethodPost, "/_api/invalidate?path=/app/app.js")
+			Expect(res.Code).Should(Equal(http.StatusNoContent))
+			Expect(cached()).Should(ConsistOf("/app/index.html"))
+
+			do(http.MethodPost, "/_api/invalidate?path=/echo/x")
+			Expect(res.Code).Should(Equal(http.StatusBadRequest))
+
+			do(http.MethodPost, "/_api/invalidate?path=/nowhere")
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+		})
+
+		It("should serve registered endpoints", func() {
+			srv.HandleAPI("/version", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "1.0")
+			}))
+
+			do(http.MethodGet, "/_api/version")
+			Expect(res.Body.String()).Should(Equal("1.0"))
+		})
+	})
+})
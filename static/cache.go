@@ -0,0 +1,129 @@
+package static
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Cache-Control values of the default policy
+const (
+	CacheImmutable = "public, max-age=31536000, immutable"
+	CacheNoCache   = "no-cache"
+)
+
+// defaultHashedPattern matches file names that carry a content hash such as app.2a385984.js
+var defaultHashedPattern = regexp.MustCompile(`\.[0-9a-f]{8,}\.[^./]+$`)
+
+// CacheRule sets the Cache-Control header of paths matching a glob pattern.
+// Patterns without a slash are matched against the file name, other patterns against the whole URL path
+type CacheRule struct {
+	Pattern      string
+	CacheControl string
+}
+
+// CachePolicy decides the Cache-Control header of static files.
+// Rules are checked in order, then NoCache paths, then hashed paths. Other paths get Default
+type CachePolicy struct {
+	Rules         []CacheRule    // Per glob overrides, the first matching rule wins
+	NoCache       []string       // Glob patterns of paths that must be revalidated, defaults to index.html and service-worker.js
+	HashedPattern *regexp.Regexp // Pattern of content hashed paths that never change, defaults to a dot separated hex hash before the extension
+	Hashed        string         // Cache-Control of content hashed paths, defaults to CacheImmutable
+	Default       string         // Cache-Control of other paths, no header is set when empty
+}
+
+// withDefaults returns a copy of the policy with unset fields filled with defaults
+func (cp *CachePolicy) withDefaults() *CachePolicy {
+	policy := &CachePolicy{}
+	if cp != nil {
+		*policy = *cp
+	}
+	if policy.NoCache == nil {
+		policy.NoCache = []string{"index.html", "service-worker.js"}
+	}
+	if policy.HashedPattern == nil {
+		policy.HashedPattern = defaultHashedPattern
+	}
+	if policy.Hashed == "" {
+		policy.Hashed = CacheImmutable
+	}
+	return policy
+}
+
+// cacheControl returns the Cache-Control header for a URL path
+func (cp *CachePolicy) cacheControl(upath string) string {
+	for _, rule := range cp.Rules {
+		if matchGlob(rule.Pattern, upath) {
+			return rule.CacheControl
+		}
+	}
+
+	for _, pattern := range cp.NoCache {
+		if matchGlob(pattern, upath) {
+			return CacheNoCache
+		}
+	}
+
+	if cp.HashedPattern.MatchString(upath) {
+		return cp.Hashed
+	}
+
+	return cp.Default
+}
+
+// matchGlob matches a URL path against a glob pattern. Patterns without a slash are matched against the last element
+func matchGlob(pattern, upath string) bool {
+	name := upath
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(upath)
+	}
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
+
+// computeETag returns a strong entity tag for file data
+func computeETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// encodedETag returns the entity tag of an encoded representation of a file
+func encodedETag(etag, encoding string) string {
+	if encoding == "" {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+}
+
+// notModified checks the conditional headers of a request against the entity tag and modification time of a representation.
+// If-None-Match takes precedence over If-Modified-Since
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			// If-None-Match uses weak comparison
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modTime.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		return !modTime.Truncate(time.Second).After(t)
+	}
+
+	return false
+}
@@ -0,0 +1,148 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"time"
+)
+
+var _ = Describe("Caching headers of static files", func() {
+	var res *httptest.ResponseRecorder
+
+	get := func(handler http.Handler, path string, header http.Header) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+	}
+
+	Context("With the default policy", func() {
+		It("should mark content hashed files as immutable", func() {
+			get(Handler, "/app/js/app.2a385984.js", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Header().Get("Cache-Control")).Should(Equal(CacheImmutable))
+
+			get(Handler, "/app/fonts/Roboto-Bold.b52fac2b.woff2", nil)
+			Expect(res.Header().Get("Cache-Control")).Should(Equal(CacheImmutable))
+		})
+
+		It("should require revalidation of the index page and service worker", func() {
+			get(Handler, "/app/", nil)
+			Expect(res.Header().Get("Cache-Control")).Should(Equal(CacheNoCache))
+
+			get(Handler, "/app/service-worker.js", nil)
+			Expect(res.Header().Get("Cache-Control")).Should(Equal(CacheNoCache))
+		})
+
+		It("should not set Cache-Control for other files", func() {
+			get(Handler, "/app/manifest.json", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Header().Get("Cache-Control")).Should(BeEmpty())
+		})
+	})
+
+	Context("With conditional requests", func() {
+		It("should set a strong ETag that is stable across requests", func() {
+			get(Handler, "/app/manifest.json", nil)
+			etag := res.Header().Get("ETag")
+			Expect(etag).Should(MatchRegexp(`^"[0-9a-f]+"$`))
+
+			get(Handler, "/app/manifest.json", nil)
+			Expect(res.Header().Get("ETag")).Should(Equal(etag))
+		})
+
+		It("should reply with StatusNotModified when If-None-Match matches", func() {
+			get(Handler, "/app/manifest.json", nil)
+			etag := res.Header().Get("ETag")
+
+			get(Handler, "/app/manifest.json", http.Header{"If-None-Match": {`"other", ` + etag}})
+			Expect(res.Code).Should(Equal(http.StatusNotModified))
+			Expect(res.Body.Len()).Should(BeZero())
+			Expect(res.Header().Get("ETag")).Should(Equal(etag))
+		})
+
+		It("should reply with the file when If-None-Match does not match", func() {
+			get(Handler, "/app/manifest.json", http.Header{"If-None-Match": {`"other"`}})
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.Len()).ShouldNot(BeZero())
+		})
+
+		It("should use a different ETag for an encoded representation", func() {
+			get(Handler, "/app/js/chunk-vendors.fe8e2aad.js", nil)
+			etag := res.Header().Get("ETag")
+
+			get(Handler, "/app/js/chunk-vendors.fe8e2aad.js", http.Header{"Accept-Encoding": {"gzip"}})
+			Expect(res.Header().Get("Content-Encoding")).Should(Equal("gzip"))
+			Expect(res.Header().Get("ETag")).ShouldNot(Equal(etag))
+
+			get(Handler, "/app/js/chunk-vendors.fe8e2aad.js", http.Header{"If-None-Match": {etag}})
+			Expect(res.Code).Should(Equal(http.StatusNotModified))
+		})
+
+		It("should honour If-Modified-Since when If-None-Match is absent", func() {
+			get(Handler, "/app/manifest.json", nil)
+			lastModified := res.Header().Get("Last-Modified")
+
+			get(Handler, "/app/manifest.json", http.Header{"If-Modified-Since": {lastModified}})
+			Expect(res.Code).Should(Equal(http.StatusNotModified))
+
+			past := time.Unix(0, 0).UTC().Format(http.TimeFormat)
+			get(Handler, "/app/manifest.json", http.Header{"If-Modified-Since": {past}})
+			Expect(res.Code).Should(Equal(http.StatusOK))
+		})
+
+		It("should ignore If-Modified-Since when If-None-Match does not match", func() {
+			get(Handler, "/app/manifest.json", nil)
+			lastModified := res.Header().Get("Last-Modified")
+
+			get(Handler, "/app/manifest.json", http.Header{
+				"If-None-Match":     {`"other"`},
+				"If-Modified-Since": {lastModified},
+			})
+			Expect(res.Code).Should(Equal(http.StatusOK))
+		})
+	})
+
+	Context("With a custom policy", func() {
+		var handler http.Handler
+
+		BeforeEach(func() {
+			var err error
+			handler, err = NewHandler(&ServerOptions{
+				RootDir: RootDir,
+				Index:   "index.html",
+				CachePolicy: &CachePolicy{
+					Rules: []CacheRule{
+						{Pattern: "/img/icons/*", CacheControl: "public, max-age=86400"},
+						{Pattern: "*.json", CacheControl: "no-store"},
+					},
+					HashedPattern: regexp.MustCompile(`\.[0-9a-f]{8}\.js$`),
+					Default:       "public, max-age=60",
+				},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should apply the first matching rule", func() {
+			get(handler, "/img/icons/favicon-16x16.png", nil)
+			Expect(res.Header().Get("Cache-Control")).Should(Equal("public, max-age=86400"))
+
+			get(handler, "/manifest.json", nil)
+			Expect(res.Header().Get("Cache-Control")).Should(Equal("no-store"))
+		})
+
+		It("should use the custom hashed pattern and default", func() {
+			get(handler, "/js/app.2a385984.js", nil)
+			Expect(res.Header().Get("Cache-Control")).Should(Equal(CacheImmutable))
+
+			get(handler, "/css/app.f1c93db5.css", nil)
+			Expect(res.Header().Get("Cache-Control")).Should(Equal("public, max-age=60"))
+
+			get(handler, "/index.html", nil)
+			Expect(res.Header().Get("Cache-Control")).Should(Equal(CacheNoCache))
+		})
+	})
+})
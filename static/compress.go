@@ -0,0 +1,150 @@
+package static
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// minCompressSize is the size below which files are not compressed on the fly
+const minCompressSize = 1024
+
+// encodingExts maps content encodings to the extension of precompressed sibling files, in order of preference
+var encodingExts = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// compressibleTypes contains non text content types that benefit from compression
+var compressibleTypes = map[string]struct{}{
+	"application/javascript":        {},
+	"application/json":              {},
+	"application/manifest+json":     {},
+	"application/xml":               {},
+	"application/wasm":              {},
+	"image/svg+xml":                 {},
+	"image/x-icon":                  {},
+	"font/ttf":                      {},
+	"application/x-font-ttf":        {},
+	"application/vnd.ms-fontobject": {},
+}
+
+// isCompressible checks whether files of a content type are worth compressing
+func isCompressible(ctype string) bool {
+	mediaType, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	_, ok := compressibleTypes[mediaType]
+	return ok
+}
+
+// readEncoded returns the encoded variants of the file name in fsys. Precompressed sibling files take precedence,
+// otherwise compressible data is gzipped when that makes it smaller
+func readEncoded(fsys fs.FS, name, ctype string, data []byte) (map[string][]byte, error) {
+	encoded := make(map[string][]byte, 0)
+
+	for _, ee := range encodingExts {
+		bs, err := fs.ReadFile(fsys, name+ee.ext)
+		if err != nil {
+			continue
+		}
+		encoded[ee.encoding] = bs
+	}
+
+	if len(encoded) > 0 {
+		return encoded, nil
+	}
+
+	return compressData(ctype, data)
+}
+
+// compressData returns the gzipped variant of compressible data when that makes it smaller
+func compressData(ctype string, data []byte) (map[string][]byte, error) {
+	encoded := make(map[string][]byte, 0)
+
+	if len(data) < minCompressSize || !isCompressible(ctype) {
+		return encoded, nil
+	}
+
+	buf := &bytes.Buffer{}
+	gw, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = gw.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = gw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if buf.Len() < len(data) {
+		encoded["gzip"] = buf.Bytes()
+	}
+
+	return encoded, nil
+}
+
+// negotiateEncoding returns the preferred encoding among encoded that is acceptable according to an Accept-Encoding header.
+// It returns an empty string when the identity encoding should be used
+func negotiateEncoding(acceptEncoding string, encoded map[string][]byte) string {
+	if acceptEncoding == "" || len(encoded) == 0 {
+		return ""
+	}
+
+	// quality values of accepted encodings
+	qvalues := make(map[string]float64, 0)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				if err == nil {
+					q = v
+				}
+			}
+		}
+		qvalues[coding] = q
+	}
+
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, ee := range encodingExts {
+		if _, ok := encoded[ee.encoding]; !ok {
+			continue
+		}
+
+		q, ok := qvalues[ee.encoding]
+		if !ok {
+			q, ok = qvalues["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = ee.encoding, q
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,133 @@
+package static
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var _ = Describe("Compression of static files", func() {
+	var (
+		handler http.Handler
+		rootDir string
+		res     *httptest.ResponseRecorder
+	)
+
+	script := []byte(strings.Repeat("console.log('chunk-vendors');\n", 200))
+
+	get := func(path, acceptEncoding string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		Expect(res.Code).Should(Equal(http.StatusOK))
+		Expect(res.Header().Get("Content-Length")).Should(Equal(strconv.Itoa(res.Body.Len())))
+	}
+
+	gunzip := func(bs []byte) []byte {
+		gr, err := gzip.NewReader(bytes.NewReader(bs))
+		Expect(err).ShouldNot(HaveOccurred())
+		data, err := ioutil.ReadAll(gr)
+		Expect(err).ShouldNot(HaveOccurred())
+		return data
+	}
+
+	writeFile := func(name string, data []byte) {
+		Expect(ioutil.WriteFile(filepath.Join(rootDir, name), data, 0644)).ShouldNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var err error
+		rootDir, err = ioutil.TempDir("", "static")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		writeFile("index.html", []byte("<html></html>"))
+		writeFile("chunk-vendors.js", script)
+		writeFile("app.js", script)
+		writeFile("app.js.br", []byte("brotli encoded"))
+		writeFile("app.css", script)
+		writeFile("app.css.gz", []byte("gzip encoded"))
+
+		png, err := ioutil.ReadFile(filepath.Join(RootDir, "img/icons/favicon-32x32.png"))
+		Expect(err).ShouldNot(HaveOccurred())
+		writeFile("favicon.png", png)
+
+		handler, err = NewHandler(&ServerOptions{
+			RootDir: rootDir,
+			Index:   "index.html",
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(rootDir)
+	})
+
+	It("should gzip compressible files when the client accepts gzip", func() {
+		get("/chunk-vendors.js", "gzip, deflate")
+
+		Expect(res.Header().Get("Content-Encoding")).Should(Equal("gzip"))
+		Expect(res.Header().Get("Vary")).Should(Equal("Accept-Encoding"))
+		Expect(res.Body.Len()).Should(BeNumerically("<", len(script)))
+		Expect(gunzip(res.Body.Bytes())).Should(Equal(script))
+	})
+
+	It("should send identity data when the client accepts no encoding", func() {
+		get("/chunk-vendors.js", "")
+
+		Expect(res.Header().Get("Content-Encoding")).Should(BeEmpty())
+		Expect(res.Header().Get("Vary")).Should(Equal("Accept-Encoding"))
+		Expect(res.Body.Bytes()).Should(Equal(script))
+	})
+
+	It("should not use an encoding the client refuses", func() {
+		get("/chunk-vendors.js", "gzip;q=0, identity")
+
+		Expect(res.Header().Get("Content-Encoding")).Should(BeEmpty())
+		Expect(res.Body.Bytes()).Should(Equal(script))
+	})
+
+	It("should prefer a precompressed brotli sibling", func() {
+		get("/app.js", "gzip, br")
+
+		Expect(res.Header().Get("Content-Encoding")).Should(Equal("br"))
+		Expect(res.Body.String()).Should(Equal("brotli encoded"))
+	})
+
+	It("should serve a precompressed gzip sibling", func() {
+		get("/app.css", "gzip;q=0.8, br;q=0.1")
+
+		Expect(res.Header().Get("Content-Encoding")).Should(Equal("gzip"))
+		Expect(res.Body.String()).Should(Equal("gzip encoded"))
+	})
+
+	It("should not compress files that are already compressed", func() {
+		get("/favicon.png", "gzip, br")
+
+		Expect(res.Header().Get("Content-Encoding")).Should(BeEmpty())
+		Expect(res.Header().Get("Vary")).Should(BeEmpty())
+	})
+
+	It("should not compress when compression is disabled", func() {
+		var err error
+		handler, err = NewHandler(&ServerOptions{
+			RootDir:            rootDir,
+			Index:              "index.html",
+			DisableCompression: true,
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		get("/app.js", "gzip, br")
+
+		Expect(res.Header().Get("Content-Encoding")).Should(BeEmpty())
+		Expect(res.Body.Bytes()).Should(Equal(script))
+	})
+})
@@ -0,0 +1,107 @@
+package static
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"html"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// defaultRuntimeConfigVar is the global variable the runtime config is assigned to
+const defaultRuntimeConfigVar = "__ENV__"
+
+var (
+	// headTagPattern matches the start tag of the head element
+	headTagPattern = regexp.MustCompile(`(?i)<head\b[^>]*>`)
+	// identPattern matches JavaScript identifiers that can name the runtime config variable
+	identPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+)
+
+// runtimeConfig is configuration injected into the index page when it is cached,
+// so that one build can be deployed to several environments
+type runtimeConfig struct {
+	values    map[string]string
+	envPrefix string
+	varName   string
+}
+
+func newRuntimeConfig(values map[string]string, envPrefix, varName string) (*runtimeConfig, error) {
+	if varName == "" {
+		varName = defaultRuntimeConfigVar
+	}
+	if !identPattern.MatchString(varName) {
+		return nil, errors.Errorf("runtime config variable %q is not a valid identifier", varName)
+	}
+
+	return &runtimeConfig{
+		values:    values,
+		envPrefix: envPrefix,
+		varName:   varName,
+	}, nil
+}
+
+// current returns environment variables with the prefix, overridden by configured values
+func (rc *runtimeConfig) current() map[string]string {
+	config := make(map[string]string, len(rc.values))
+
+	if rc.envPrefix != "" {
+		for _, env := range os.Environ() {
+			kv := strings.SplitN(env, "=", 2)
+			if len(kv) == 2 && strings.HasPrefix(kv[0], rc.envPrefix) {
+				config[kv[0]] = kv[1]
+			}
+		}
+	}
+
+	for key, value := range rc.values {
+		config[key] = value
+	}
+
+	return config
+}
+
+// inject replaces %KEY% placeholders in an HTML page with HTML escaped values and adds a script
+// assigning the config to window before any other script of the page
+func (rc *runtimeConfig) inject(data []byte) ([]byte, error) {
+	config := rc.current()
+
+	// keys are sorted so that the page and its entity tag only change with the config
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if len(keys) > 0 {
+		oldnew := make([]string, 0, 2*len(keys))
+		for _, key := range keys {
+			oldnew = append(oldnew, "%"+key+"%", html.EscapeString(config[key]))
+		}
+		data = []byte(strings.NewReplacer(oldnew...).Replace(string(data)))
+	}
+
+	// json escapes <, > and & so that values cannot close the script
+	bs, err := json.Marshal(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode runtime config")
+	}
+	script := []byte("<script>window." + rc.varName + "=" + string(bs) + ";</script>")
+
+	offset := 0
+	if loc := headTagPattern.FindIndex(data); loc != nil {
+		offset = loc[1]
+	} else if loc := scriptTagPattern.FindIndex(data); loc != nil {
+		offset = loc[0]
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)+len(script)))
+	buf.Write(data[:offset])
+	buf.Write(script)
+	buf.Write(data[offset:])
+
+	return buf.Bytes(), nil
+}
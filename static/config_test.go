@@ -0,0 +1,104 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing/fstest"
+)
+
+var _ = Describe("Runtime config injection", func() {
+	var res *httptest.ResponseRecorder
+
+	get := func(handler http.Handler, path string, header http.Header) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+	}
+
+	files := fstest.MapFS{
+		"index.html":    {Data: []byte(`<html><head lang="en"><title>%TITLE%</title><script src="/app.js"></script></head></html>`)},
+		"index.html.gz": {Data: []byte("stale")},
+		"about.html":    {Data: []byte(`<html><head><title>%TITLE%</title></head></html>`)},
+	}
+
+	AfterEach(func() {
+		os.Unsetenv("STATIC_TEST_API_URL")
+	})
+
+	It("should inject the config before the scripts of the index page", func() {
+		handler, err := NewHandler(&ServerOptions{
+			FS:            files,
+			RuntimeConfig: map[string]string{"TITLE": "Shop", "API_URL": "https://api.example.com"},
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		get(handler, "/", nil)
+		Expect(res.Code).Should(Equal(http.StatusOK))
+		Expect(res.Body.String()).Should(Equal(`<html><head lang="en">` +
+			`<script>window.__ENV__={"API_URL":"https://api.example.com","TITLE":"Shop"};</script>` +
+			`<title>Shop</title><script src="/app.js"></script></head></html>`))
+	})
+
+	It("should escape values", func() {
+		handler, err := NewHandler(&ServerOptions{
+			FS:               files,
+			RuntimeConfig:    map[string]string{"TITLE": `</script><script>alert("x")</script>`},
+			RuntimeConfigVar: "APP_CONFIG",
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		get(handler, "/", nil)
+		Expect(res.Body.String()).Should(ContainSubstring(`window.APP_CONFIG={"TITLE":"\u003c/script\u003e\u003cscript\u003ealert(\"x\")\u003c/script\u003e"};`))
+		Expect(res.Body.String()).ShouldNot(ContainSubstring(`<script>alert`))
+		Expect(res.Body.String()).Should(ContainSubstring(`<title>&lt;/script&gt;&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</title>`))
+	})
+
+	It("should only change the index page", func() {
+		handler, err := NewHandler(&ServerOptions{FS: files, RuntimeConfig: map[string]string{"TITLE": "Shop"}})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		get(handler, "/about.html", nil)
+		Expect(res.Body.String()).Should(ContainSubstring("%TITLE%"))
+		Expect(res.Body.String()).ShouldNot(ContainSubstring("__ENV__"))
+	})
+
+	It("should not serve stale precompressed index pages", func() {
+		handler, err := NewHandler(&ServerOptions{FS: files, RuntimeConfig: map[string]string{"TITLE": "Shop"}})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		get(handler, "/", http.Header{"Accept-Encoding": {"gzip"}})
+		Expect(res.Header().Get("Content-Encoding")).Should(BeEmpty())
+		Expect(res.Body.String()).Should(ContainSubstring("Shop"))
+	})
+
+	It("should read environment variables with the prefix and change the entity tag with them", func() {
+		os.Setenv("STATIC_TEST_API_URL", "https://one.example.com")
+
+		handler, err := NewHandler(&ServerOptions{FS: files, RuntimeConfigPrefix: "STATIC_TEST_"})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		get(handler, "/", nil)
+		Expect(res.Body.String()).Should(ContainSubstring(`window.__ENV__={"STATIC_TEST_API_URL":"https://one.example.com"};`))
+		etag := res.Header().Get("ETag")
+
+		get(handler, "/", nil)
+		Expect(res.Header().Get("ETag")).Should(Equal(etag))
+
+		os.Setenv("STATIC_TEST_API_URL", "https://two.example.com")
+		Expect(handler.(Cache).Reload()).Should(Succeed())
+
+		get(handler, "/", http.Header{"If-None-Match": {etag}})
+		Expect(res.Code).Should(Equal(http.StatusOK))
+		Expect(res.Body.String()).Should(ContainSubstring("https://two.example.com"))
+		Expect(res.Header().Get("ETag")).ShouldNot(Equal(etag))
+	})
+
+	It("should reject invalid variable names", func() {
+		_, err := NewHandler(&ServerOptions{FS: files, RuntimeConfig: map[string]string{"A": "1"}, RuntimeConfigVar: "a.b"})
+		Expect(err).Should(HaveOccurred())
+	})
+})
@@ -50,7 +50,7 @@ var _ = Describe("Custom notFoundhandler", func() {
 	Context("Sending Request", func() {
 
 		It("should return index page when requested file resource is not in the server", func() {
-			url := server.URL() + "/notfound"
+			url := server.URL() + "/app/notfound"
 			req := httptest.NewRequest(http.MethodGet, url, nil)
 			Expect(req).ShouldNot(BeNil())
 
@@ -65,7 +65,7 @@ var _ = Describe("Custom notFoundhandler", func() {
 		})
 
 		It("should return file resource when requested file is present in the server", func() {
-			url := server.URL() + "/css/app.f1c93db5.css"
+			url := server.URL() + "/app/css/app.f1c93db5.css"
 			req := httptest.NewRequest(http.MethodGet, url, nil)
 			Expect(req).ShouldNot(BeNil())
 
@@ -0,0 +1,123 @@
+package static
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// fallbackRoute serves a fallback document for missing paths matching a pattern
+type fallbackRoute struct {
+	pattern  string
+	literal  string // pattern up to its first wildcard
+	document string // name of the document relative to root
+}
+
+// newFallbackRoutes compiles route patterns to fallback documents, most specific first
+func newFallbackRoutes(documents map[string]string) []*fallbackRoute {
+	routes := make([]*fallbackRoute, 0, len(documents))
+	for pattern, document := range documents {
+		pattern, literal := cleanPattern(pattern)
+		routes = append(routes, &fallbackRoute{
+			pattern:  pattern,
+			literal:  literal,
+			document: fsName(document),
+		})
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if len(routes[i].literal) != len(routes[j].literal) {
+			return len(routes[i].literal) > len(routes[j].literal)
+		}
+		if len(routes[i].pattern) != len(routes[j].pattern) {
+			return len(routes[i].pattern) > len(routes[j].pattern)
+		}
+		return routes[i].pattern < routes[j].pattern
+	})
+
+	return routes
+}
+
+// isNavigation checks whether a request is a browser navigation to a page rather than a request for an asset
+func isNavigation(r *http.Request, upath string) bool {
+	if r.Header.Get("Sec-Fetch-Mode") == "navigate" {
+		return true
+	}
+
+	if path.Ext(upath) == "" {
+		return true
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fallbackDocument returns the document served for a missing path. Only navigation requests
+// and paths matching fallback route patterns fall back
+func (sfs *staticFileServer) fallbackDocument(r *http.Request, upath string) (string, bool) {
+	route := false
+	for _, pattern := range sfs.fallbackPaths {
+		if matchPattern(pattern, upath) {
+			route = true
+			break
+		}
+	}
+
+	if !route && !isNavigation(r, upath) {
+		return "", false
+	}
+
+	for _, fr := range sfs.fallbackDocs {
+		if matchPattern(fr.pattern, upath) {
+			return fr.document, true
+		}
+	}
+
+	if sfs.fallbackIndex {
+		return sfs.indexPage, true
+	}
+
+	return "", false
+}
+
+// serveNotFound replies to a request for a missing path with its fallback document or the not found handler
+func (sfs *staticFileServer) serveNotFound(w http.ResponseWriter, r *http.Request, upath string) {
+	document, fallback := sfs.fallbackDocument(r, upath)
+
+	if !fallback {
+		sfs.notFoundHandler.ServeHTTP(w, r)
+		return
+	}
+
+	// fallback pages get the pushes of their path, or those of the root path which is also served by the index page
+	if !sfs.serverPush(w, r, upath) {
+		sfs.serverPush(w, r, "/")
+	}
+
+	sfs.serveDocument(w, r, document)
+}
+
+// serveDocument replies with a document from the cache, reading it when missing
+func (sfs *staticFileServer) serveDocument(w http.ResponseWriter, r *http.Request, document string) {
+	key := "/" + fsName(document)
+
+	sfile, ok := sfs.getStaticFile(key)
+	if !ok {
+		var err error
+		sfile, err = sfs.addStaticFile(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	sfs.writeResponse(w, r, key, sfile)
+}
@@ -0,0 +1,112 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+)
+
+var _ = Describe("Falling back to index documents for missing pages", func() {
+	var res *httptest.ResponseRecorder
+
+	get := func(handler http.Handler, path string, header http.Header) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+	}
+
+	newFS := func() fstest.MapFS {
+		return fstest.MapFS{
+			"index.html":       {Data: []byte("<html>index</html>")},
+			"admin/index.html": {Data: []byte("<html>admin</html>")},
+			"js/app.js":        {Data: []byte("console.log('app')")},
+		}
+	}
+
+	Context("With an index page and route documents", func() {
+		mapFS := newFS()
+
+		handler, err := NewHandler(&ServerOptions{
+			FS:                mapFS,
+			Index:             "index.html",
+			FallBackIndex:     true,
+			FallBackRoutes:    []string{"/reports/*"},
+			FallBackDocuments: map[string]string{"/admin/*": "admin/index.html"},
+		})
+
+		It("should setup handler without an error", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should serve the index page for paths without an extension", func() {
+			get(handler, "/users/1", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("<html>index</html>"))
+			Expect(res.Header().Get("Cache-Control")).Should(Equal(CacheNoCache))
+		})
+
+		It("should reply with 404 for missing assets", func() {
+			get(handler, "/js/missing.js", http.Header{"Accept": {"*/*"}})
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+
+			get(handler, "/favicon.png", http.Header{"Accept": {"image/avif,image/webp,*/*"}})
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+		})
+
+		It("should serve the index page for navigations to paths with an extension", func() {
+			get(handler, "/users/john.doe", http.Header{"Accept": {"text/html,application/xhtml+xml;q=0.9,*/*;q=0.8"}})
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("<html>index</html>"))
+
+			get(handler, "/users/jane.doe", http.Header{"Sec-Fetch-Mode": {"navigate"}})
+			Expect(res.Code).Should(Equal(http.StatusOK))
+		})
+
+		It("should serve the index page for fallback routes", func() {
+			get(handler, "/reports/2020.pdf", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("<html>index</html>"))
+		})
+
+		It("should serve the document of the route", func() {
+			get(handler, "/admin/users", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("<html>admin</html>"))
+
+			get(handler, "/admin/logo.png", nil)
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+		})
+
+		It("should serve the index page from the cache", func() {
+			get(handler, "/users/1", nil)
+			mapFS["index.html"] = &fstest.MapFile{Data: []byte("<html>changed</html>")}
+
+			get(handler, "/users/2", nil)
+			Expect(res.Body.String()).Should(Equal("<html>index</html>"))
+		})
+	})
+
+	Context("With route documents only", func() {
+		handler, err := NewHandler(&ServerOptions{
+			FS:                newFS(),
+			Index:             "index.html",
+			FallBackDocuments: map[string]string{"/admin/*": "admin/index.html"},
+		})
+
+		It("should setup handler without an error", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should only fall back for routes with documents", func() {
+			get(handler, "/users/1", nil)
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+
+			get(handler, "/admin/users", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("<html>admin</html>"))
+		})
+	})
+})
@@ -0,0 +1,226 @@
+package static
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"embed"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing/fstest"
+)
+
+//go:embed testdata/dist
+var distFS embed.FS
+
+var _ = Describe("Serving files from an fs.FS", func() {
+	var res *httptest.ResponseRecorder
+
+	script := strings.Repeat("console.log('app');\n", 100)
+
+	mapFS := fstest.MapFS{
+		"dist/index.html":                  {Data: []byte("<html>index</html>")},
+		"dist/js/app.2a385984.js":          {Data: []byte(script)},
+		"dist/css/app.f1c93db5.css":        {Data: []byte("body {}")},
+		"dist/css/app.f1c93db5.css.br":     {Data: []byte("brotli encoded")},
+		"dist/private/secret.txt":          {Data: []byte("secret")},
+		"dist/img/icons/favicon-16x16.png": {Data: []byte("png")},
+		"other/outside.txt":                {Data: []byte("outside")},
+	}
+
+	get := func(handler http.Handler, path string, header http.Header) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+	}
+
+	newHandler := func(opt *ServerOptions) http.Handler {
+		handler, err := NewHandler(opt)
+		Expect(err).ShouldNot(HaveOccurred())
+		return handler
+	}
+
+	Context("With a map filesystem", func() {
+		var handler http.Handler
+
+		BeforeEach(func() {
+			handler = newHandler(&ServerOptions{
+				FS:      mapFS,
+				RootDir: "dist",
+				Index:   "index.html",
+			})
+		})
+
+		It("should serve the index page and files under root", func() {
+			get(handler, "/", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("<html>index</html>"))
+			Expect(res.Header().Get("Content-Type")).Should(ContainSubstring("text/html"))
+
+			get(handler, "/js/app.2a385984.js", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal(script))
+			Expect(res.Header().Get("Cache-Control")).Should(Equal(CacheImmutable))
+		})
+
+		It("should not serve files outside root", func() {
+			get(handler, "/../other/outside.txt", nil)
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+
+			get(handler, "/other/outside.txt", nil)
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+		})
+
+		It("should compress and serve precompressed siblings", func() {
+			get(handler, "/js/app.2a385984.js", http.Header{"Accept-Encoding": {"gzip"}})
+			Expect(res.Header().Get("Content-Encoding")).Should(Equal("gzip"))
+			gr, err := gzip.NewReader(res.Body)
+			Expect(err).ShouldNot(HaveOccurred())
+			bs, err := ioutil.ReadAll(gr)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(string(bs)).Should(Equal(script))
+
+			get(handler, "/css/app.f1c93db5.css", http.Header{"Accept-Encoding": {"br"}})
+			Expect(res.Header().Get("Content-Encoding")).Should(Equal("br"))
+			Expect(res.Body.String()).Should(Equal("brotli encoded"))
+		})
+
+		It("should fall back to the index page", func() {
+			handler = newHandler(&ServerOptions{
+				FS:            mapFS,
+				RootDir:       "dist",
+				Index:         "index.html",
+				FallBackIndex: true,
+			})
+
+			get(handler, "/users/1", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("<html>index</html>"))
+		})
+
+		It("should stream files larger than the maximum cacheable size", func() {
+			handler = newHandler(&ServerOptions{
+				FS:               mapFS,
+				RootDir:          "dist",
+				Index:            "index.html",
+				MaxCacheFileSize: 100,
+			})
+
+			get(handler, "/js/app.2a385984.js", http.Header{"Range": {"bytes=0-6"}})
+			Expect(res.Code).Should(Equal(http.StatusPartialContent))
+			Expect(res.Body.String()).Should(Equal("console"))
+		})
+	})
+
+	Context("With an embedded filesystem", func() {
+		It("should serve the embedded files", func() {
+			handler := newHandler(&ServerOptions{
+				FS:      distFS,
+				RootDir: RootDir,
+				Index:   "index.html",
+			})
+
+			get(handler, "/", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Header().Get("Content-Type")).Should(ContainSubstring("text/html"))
+
+			get(handler, "/fonts/Roboto-Bold.b52fac2b.woff2", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Header().Get("Cache-Control")).Should(Equal(CacheImmutable))
+		})
+	})
+
+	Context("With allowed directories", func() {
+		It("should only serve files in allowed directories", func() {
+			handler := newHandler(&ServerOptions{
+				FS:          mapFS,
+				RootDir:     "dist",
+				Index:       "index.html",
+				AllowedDirs: []string{"js", "css", "img"},
+			})
+
+			get(handler, "/img/icons/favicon-16x16.png", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+
+			get(handler, "/private/secret.txt", nil)
+			Expect(res.Code).Should(Equal(http.StatusInternalServerError))
+		})
+	})
+
+	Context("With push content", func() {
+		It("should cache push files when created", func() {
+			handler := newHandler(&ServerOptions{
+				FS:          mapFS,
+				RootDir:     "dist",
+				Index:       "index.html",
+				PushContent: map[string][]string{"/": {"/css/app.f1c93db5.css", "/js/app.2a385984.js"}},
+			})
+
+			_, ok := handler.(*staticFileServer).getStaticFile("/css/app.f1c93db5.css")
+			Expect(ok).Should(BeTrue())
+		})
+
+		It("should fail when a push file is missing", func() {
+			_, err := NewHandler(&ServerOptions{
+				FS:          mapFS,
+				RootDir:     "dist",
+				PushContent: map[string][]string{"/": {"/css/missing.css"}},
+			})
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("With a zip archive", func() {
+		var handler http.Handler
+
+		BeforeEach(func() {
+			buf := &bytes.Buffer{}
+			zw := zip.NewWriter(buf)
+			for name, content := range map[string]string{
+				"index.html":                  "<html>zipped</html>",
+				"js/app.2a385984.js":          script,
+				"fonts/Roboto.b52fac2b.woff2": "font",
+			} {
+				w, err := zw.Create(name)
+				Expect(err).ShouldNot(HaveOccurred())
+				_, err = w.Write([]byte(content))
+				Expect(err).ShouldNot(HaveOccurred())
+			}
+			Expect(zw.Close()).ShouldNot(HaveOccurred())
+
+			zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			Expect(err).ShouldNot(HaveOccurred())
+
+			handler = newHandler(&ServerOptions{
+				FS:               zr,
+				Index:            "index.html",
+				MaxCacheFileSize: 100,
+			})
+		})
+
+		It("should serve files from the archive", func() {
+			get(handler, "/", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("<html>zipped</html>"))
+
+			get(handler, "/fonts/Roboto.b52fac2b.woff2", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("font"))
+		})
+
+		It("should stream large entries that cannot seek", func() {
+			get(handler, "/js/app.2a385984.js", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal(script))
+
+			get(handler, "/js/app.2a385984.js", http.Header{"Range": {"bytes=0-6"}})
+			Expect(res.Code).Should(Equal(http.StatusPartialContent))
+			Expect(res.Body.String()).Should(Equal("console"))
+		})
+	})
+})
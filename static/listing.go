@@ -0,0 +1,227 @@
+package static
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes of directory listings
+const (
+	defaultListingPageSize = 100
+	maxListingPageSize     = 1000
+)
+
+// errIsDirectory is returned when a path to be cached names a directory
+var errIsDirectory = errors.New("path is a directory")
+
+// listingEntry is a file or directory in a directory listing
+type listingEntry struct {
+	Name     string    `json:"name"`
+	URL      string    `json:"url"`
+	Dir      bool      `json:"dir"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modTime"`
+	MimeType string    `json:"mimeType,omitempty"`
+}
+
+// listing is a page of the entries of a directory
+type listing struct {
+	Path     string          `json:"path"`
+	Parent   string          `json:"parent,omitempty"`
+	Entries  []*listingEntry `json:"entries"`
+	Page     int             `json:"page"`
+	PageSize int             `json:"pageSize"`
+	Total    int             `json:"total"`
+	PrevPage int             `json:"prevPage,omitempty"`
+	NextPage int             `json:"nextPage,omitempty"`
+}
+
+var listingTemplate = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Index of {{.Path}}</title>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<thead><tr><th>Name</th><th>Size</th><th>Modified</th><th>Type</th></tr></thead>
+<tbody>
+{{- if .Parent}}
+<tr><td><a href="{{.Parent}}">../</a></td><td></td><td></td><td></td></tr>
+{{- end}}
+{{- range .Entries}}
+<tr><td><a href="{{.URL}}">{{.Name}}{{if .Dir}}/{{end}}</a></td><td>{{if not .Dir}}{{.Size}}{{end}}</td><td>{{.ModTime.UTC.Format "2006-01-02 15:04:05"}}</td><td>{{.MimeType}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+<p>
+{{- if .PrevPage}}<a href="?page={{.PrevPage}}&per_page={{.PageSize}}">Previous</a>{{end}}
+{{- if .NextPage}} <a href="?page={{.NextPage}}&per_page={{.PageSize}}">Next</a>{{end}}
+</p>
+</body>
+</html>
+`))
+
+// serveListing replies with a page of the entries of the directory dir in HTML or JSON
+func (sfs *staticFileServer) serveListing(w http.ResponseWriter, r *http.Request, upath, dir string) {
+	if !sfs.dirAllowed(dir) {
+		http.Error(w, "DIRECTORY_ACCESS_NOT_ALLOWED", http.StatusForbidden)
+		return
+	}
+
+	dirEntries, err := fs.ReadDir(sfs.fsys, dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// URL path of the directory with a trailing slash
+	dirURL := path.Join(sfs.urlPrefix, upath)
+	if dirURL != "/" {
+		dirURL += "/"
+	}
+
+	entries := make([]*listingEntry, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if dirEntry.IsDir() && !sfs.dirAllowed(path.Join(dir, name)) {
+			continue
+		}
+		// hidden, denied and escaping entries are not listed
+		if _, err := sfs.resolve(path.Join(dir, name)); err != nil {
+			continue
+		}
+
+		finfo, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+
+		entry := &listingEntry{
+			Name:    name,
+			URL:     dirURL + name,
+			Dir:     dirEntry.IsDir(),
+			ModTime: finfo.ModTime(),
+		}
+		if entry.Dir {
+			entry.URL += "/"
+		} else {
+			entry.Size = finfo.Size()
+			entry.MimeType = contentType(name)
+		}
+		entries = append(entries, entry)
+	}
+
+	// directories first, then by name
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Dir != entries[j].Dir {
+			return entries[i].Dir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	page, pageSize := listingPage(r, sfs.listingPageSize, len(entries))
+
+	list := &listing{
+		Path:     dirURL,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    len(entries),
+	}
+	if dir != "." {
+		list.Parent = path.Dir(strings.TrimSuffix(dirURL, "/"))
+		if list.Parent != "/" {
+			list.Parent += "/"
+		}
+	}
+
+	start := (page - 1) * pageSize
+	if start > len(entries) {
+		start = len(entries)
+	}
+	end := start + pageSize
+	if end > len(entries) {
+		end = len(entries)
+	}
+	list.Entries = entries[start:end]
+	if page > 1 {
+		list.PrevPage = page - 1
+	}
+	if end < len(entries) {
+		list.NextPage = page + 1
+	}
+
+	// listings change with the directory
+	w.Header().Set("Cache-Control", CacheNoCache)
+
+	buf := &bytes.Buffer{}
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(buf).Encode(list)
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = listingTemplate.Execute(buf, list)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// listingPage returns the page number and page size requested in the query for a directory of total entries
+func listingPage(r *http.Request, defaultPageSize, total int) (int, int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxListingPageSize {
+		pageSize = maxListingPageSize
+	}
+
+	// pages past the end are clamped so that the offset of the page cannot overflow
+	lastPage := (total + pageSize - 1) / pageSize
+	if lastPage < 1 {
+		lastPage = 1
+	}
+	if page > lastPage {
+		page = lastPage
+	}
+
+	return page, pageSize
+}
+
+// wantsJSON checks whether a listing should be written as JSON rather than HTML
+func wantsJSON(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "json"
+	}
+
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
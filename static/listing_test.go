@@ -0,0 +1,180 @@
+package static
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+	"time"
+)
+
+var _ = Describe("Listing directories", func() {
+	var res *httptest.ResponseRecorder
+
+	get := func(handler http.Handler, path string, header http.Header) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+	}
+
+	getListing := func(handler http.Handler, path string) *listing {
+		get(handler, path, http.Header{"Accept": {"application/json"}})
+		Expect(res.Code).Should(Equal(http.StatusOK))
+		Expect(res.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+		list := &listing{}
+		Expect(json.Unmarshal(res.Body.Bytes(), list)).Should(Succeed())
+		return list
+	}
+
+	names := func(list *listing) []string {
+		names := make([]string, 0, len(list.Entries))
+		for _, entry := range list.Entries {
+			names = append(names, entry.Name)
+		}
+		return names
+	}
+
+	modTime := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	mapFS := fstest.MapFS{
+		"docs/b.txt":           {Data: []byte("bb"), ModTime: modTime},
+		"docs/a.html":          {Data: []byte("a"), ModTime: modTime},
+		"docs/.secret":         {Data: []byte("secret"), ModTime: modTime},
+		"docs/guides/one.md":   {Data: []byte("one"), ModTime: modTime},
+		"docs/.git/config":     {Data: []byte("config"), ModTime: modTime},
+		"private/keys.txt":     {Data: []byte("keys"), ModTime: modTime},
+		"readme.txt":           {Data: []byte("readme"), ModTime: modTime},
+		"many/placeholder.txt": {Data: []byte(""), ModTime: modTime},
+	}
+	for i := 0; i < 25; i++ {
+		mapFS[fmt.Sprintf("many/file%02d.txt", i)] = &fstest.MapFile{Data: []byte("x"), ModTime: modTime}
+	}
+
+	Context("With directory listing enabled", func() {
+		handler, err := NewHandler(&ServerOptions{
+			FS:               mapFS,
+			URLPathPrefix:    "/files",
+			AllowedDirs:      []string{"docs", "many"},
+			DirectoryListing: true,
+			ListingPageSize:  10,
+		})
+
+		It("should setup handler without an error", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should list sorted entries with directories first", func() {
+			list := getListing(handler, "/files/docs/")
+			Expect(list.Path).Should(Equal("/files/docs/"))
+			Expect(list.Parent).Should(Equal("/files/"))
+			Expect(names(list)).Should(Equal([]string{"guides", "a.html", "b.txt"}))
+
+			Expect(list.Entries[0].Dir).Should(BeTrue())
+			Expect(list.Entries[0].URL).Should(Equal("/files/docs/guides/"))
+
+			entry := list.Entries[2]
+			Expect(entry.URL).Should(Equal("/files/docs/b.txt"))
+			Expect(entry.Size).Should(BeEquivalentTo(2))
+			Expect(entry.ModTime.Equal(modTime)).Should(BeTrue())
+			Expect(entry.MimeType).Should(ContainSubstring("text/plain"))
+		})
+
+		It("should render HTML listings", func() {
+			get(handler, "/files/docs", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Header().Get("Content-Type")).Should(ContainSubstring("text/html"))
+			Expect(res.Body.String()).Should(ContainSubstring("Index of /files/docs/"))
+			Expect(res.Body.String()).Should(ContainSubstring(`<a href="/files/docs/guides/">guides/</a>`))
+			Expect(res.Body.String()).Should(ContainSubstring(`<a href="/files/docs/a.html">a.html</a>`))
+			Expect(res.Body.String()).ShouldNot(ContainSubstring(".secret"))
+		})
+
+		It("should list the root without an index page and skip directories that are not allowed", func() {
+			list := getListing(handler, "/files/")
+			Expect(list.Parent).Should(BeEmpty())
+			Expect(names(list)).Should(Equal([]string{"docs", "many", "readme.txt"}))
+
+			get(handler, "/files/private/", nil)
+			Expect(res.Code).Should(Equal(http.StatusForbidden))
+		})
+
+		It("should paginate large directories", func() {
+			list := getListing(handler, "/files/many/")
+			Expect(list.Total).Should(Equal(26))
+			Expect(list.Entries).Should(HaveLen(10))
+			Expect(list.PrevPage).Should(BeZero())
+			Expect(list.NextPage).Should(Equal(2))
+
+			list = getListing(handler, "/files/many/?page=3")
+			Expect(list.Entries).Should(HaveLen(6))
+			Expect(list.PrevPage).Should(Equal(2))
+			Expect(list.NextPage).Should(BeZero())
+			Expect(list.Entries[5].Name).Should(Equal("placeholder.txt"))
+
+			list = getListing(handler, "/files/many/?per_page=30&format=json")
+			Expect(list.Entries).Should(HaveLen(26))
+		})
+
+		It("should clamp pages past the end", func() {
+			list := getListing(handler, "/files/many/?page=2305843009213693953&per_page=4")
+			Expect(list.Page).Should(Equal(7))
+			Expect(names(list)).Should(Equal([]string{"file24.txt", "placeholder.txt"}))
+			Expect(list.NextPage).Should(BeZero())
+		})
+
+		It("should clamp pages past the end to the last full page", func() {
+			list := getListing(handler, "/files/many/?page=3&per_page=13")
+			Expect(list.Page).Should(Equal(2))
+			Expect(list.Entries).Should(HaveLen(13))
+			Expect(list.Entries[12].Name).Should(Equal("placeholder.txt"))
+			Expect(list.PrevPage).Should(Equal(1))
+			Expect(list.NextPage).Should(BeZero())
+		})
+
+		It("should still serve files", func() {
+			get(handler, "/files/docs/b.txt", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("bb"))
+		})
+	})
+
+	Context("With hidden files shown", func() {
+		handler, err := NewHandler(&ServerOptions{
+			FS:               mapFS,
+			DirectoryListing: true,
+			ShowHiddenFiles:  true,
+		})
+
+		It("should setup handler without an error", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should list hidden files and directories", func() {
+			list := getListing(handler, "/docs/")
+			Expect(names(list)).Should(Equal([]string{".git", "guides", ".secret", "a.html", "b.txt"}))
+		})
+	})
+
+	Context("With directory listing disabled", func() {
+		handler, err := NewHandler(&ServerOptions{
+			FS: mapFS,
+		})
+
+		It("should setup handler without an error", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should reply with 404 for directories", func() {
+			get(handler, "/docs/", nil)
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+
+			get(handler, "/", nil)
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+		})
+	})
+})
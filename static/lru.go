@@ -0,0 +1,159 @@
+package static
+
+import (
+	"container/list"
+	"time"
+)
+
+// Default limits of the caches of a static file server
+const (
+	defaultMaxCacheSize     int64 = 64 * 1024 * 1024 // ~ 64mb
+	defaultMaxCacheFileSize int64 = 4 * 1024 * 1024  // ~ 4mb
+	defaultMaxNotFoundPaths       = 1024
+	defaultNotFoundTTL            = 5 * time.Minute
+)
+
+// fileCache is a least recently used cache of static files bounded by the total size of their data
+type fileCache struct {
+	maxSize int64
+	size    int64
+	ll      *list.List
+	items   map[string]*list.Element
+}
+
+type fileCacheItem struct {
+	key   string
+	sfile *staticFile
+}
+
+func newFileCache(maxSize int64) *fileCache {
+	return &fileCache{
+		maxSize: maxSize,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element, 0),
+	}
+}
+
+// get returns the file cached under key and marks it as recently used
+func (c *fileCache) get(key string) (*staticFile, bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*fileCacheItem).sfile, true
+}
+
+// add caches the file under key, evicting least recently used files to stay within the size budget.
+// It reports whether the file was cached
+func (c *fileCache) add(key string, sfile *staticFile) bool {
+	c.remove(key)
+
+	size := sfile.size()
+	if size > c.maxSize {
+		return false
+	}
+
+	for c.size+size > c.maxSize {
+		c.remove(c.ll.Back().Value.(*fileCacheItem).key)
+	}
+
+	c.items[key] = c.ll.PushFront(&fileCacheItem{key: key, sfile: sfile})
+	c.size += size
+
+	return true
+}
+
+// remove drops the file cached under key
+func (c *fileCache) remove(key string) {
+	e, ok := c.items[key]
+	if !ok {
+		return
+	}
+	c.ll.Remove(e)
+	delete(c.items, key)
+	c.size -= e.Value.(*fileCacheItem).sfile.size()
+}
+
+// each calls fn for every cached file
+func (c *fileCache) each(fn func(key string, sfile *staticFile)) {
+	for key, e := range c.items {
+		fn(key, e.Value.(*fileCacheItem).sfile)
+	}
+}
+
+// clear drops every cached file
+func (c *fileCache) clear() {
+	c.ll.Init()
+	c.items = make(map[string]*list.Element, 0)
+	c.size = 0
+}
+
+// notFoundCache remembers paths that resulted to 404 for a limited time. The oldest paths are dropped when it is full
+type notFoundCache struct {
+	maxPaths int
+	ttl      time.Duration
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type notFoundItem struct {
+	path    string
+	expires time.Time
+}
+
+func newNotFoundCache(maxPaths int, ttl time.Duration) *notFoundCache {
+	return &notFoundCache{
+		maxPaths: maxPaths,
+		ttl:      ttl,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element, 0),
+	}
+}
+
+// has checks whether the path is remembered and has not expired
+func (c *notFoundCache) has(path string) bool {
+	e, ok := c.items[path]
+	if !ok {
+		return false
+	}
+	return time.Now().Before(e.Value.(*notFoundItem).expires)
+}
+
+// add remembers the path, dropping the oldest paths when full. Paths expire in insertion order, so the oldest are expired first
+func (c *notFoundCache) add(path string) {
+	c.remove(path)
+
+	now := time.Now()
+	for c.ll.Len() > 0 && c.ll.Len() >= c.maxPaths {
+		oldest := c.ll.Back().Value.(*notFoundItem)
+		c.remove(oldest.path)
+	}
+
+	c.items[path] = c.ll.PushFront(&notFoundItem{path: path, expires: now.Add(c.ttl)})
+}
+
+// remove forgets the path
+func (c *notFoundCache) remove(path string) {
+	e, ok := c.items[path]
+	if !ok {
+		return
+	}
+	c.ll.Remove(e)
+	delete(c.items, path)
+}
+
+// paths returns every remembered path
+func (c *notFoundCache) paths() []string {
+	paths := make([]string, 0, len(c.items))
+	for path := range c.items {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// clear forgets every path
+func (c *notFoundCache) clear() {
+	c.ll.Init()
+	c.items = make(map[string]*list.Element, 0)
+}
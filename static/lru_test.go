@@ -0,0 +1,167 @@
+package static
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Bounded caches of the static file server", func() {
+	newFile := func(size int) *staticFile {
+		return &staticFile{data: make([]byte, size)}
+	}
+
+	Context("Caching files", func() {
+		It("should evict least recently used files to stay within the budget", func() {
+			c := newFileCache(100)
+			Expect(c.add("/a", newFile(40))).Should(BeTrue())
+			Expect(c.add("/b", newFile(40))).Should(BeTrue())
+
+			// use /a so that /b is the least recently used
+			_, ok := c.get("/a")
+			Expect(ok).Should(BeTrue())
+
+			Expect(c.add("/c", newFile(40))).Should(BeTrue())
+			Expect(c.size).Should(BeEquivalentTo(80))
+
+			_, ok = c.get("/b")
+			Expect(ok).Should(BeFalse())
+			_, ok = c.get("/a")
+			Expect(ok).Should(BeTrue())
+			_, ok = c.get("/c")
+			Expect(ok).Should(BeTrue())
+		})
+
+		It("should count encoded variants against the budget", func() {
+			c := newFileCache(100)
+			sfile := newFile(40)
+			sfile.encoded = map[string][]byte{"gzip": make([]byte, 30)}
+			Expect(c.add("/a", sfile)).Should(BeTrue())
+			Expect(c.size).Should(BeEquivalentTo(70))
+
+			c.remove("/a")
+			Expect(c.size).Should(BeZero())
+		})
+
+		It("should not cache a file larger than the budget", func() {
+			c := newFileCache(100)
+			Expect(c.add("/a", newFile(40))).Should(BeTrue())
+			Expect(c.add("/big", newFile(101))).Should(BeFalse())
+
+			_, ok := c.get("/a")
+			Expect(ok).Should(BeTrue())
+		})
+	})
+
+	Context("Remembering paths resulting to 404", func() {
+		It("should drop the oldest paths when full", func() {
+			c := newNotFoundCache(2, time.Minute)
+			c.add("/a")
+			c.add("/b")
+			c.add("/c")
+
+			Expect(c.has("/a")).Should(BeFalse())
+			Expect(c.has("/b")).Should(BeTrue())
+			Expect(c.has("/c")).Should(BeTrue())
+			Expect(c.paths()).Should(HaveLen(2))
+		})
+
+		It("should forget paths once expired", func() {
+			c := newNotFoundCache(2, 10*time.Millisecond)
+			c.add("/a")
+			Expect(c.has("/a")).Should(BeTrue())
+
+			time.Sleep(20 * time.Millisecond)
+			Expect(c.has("/a")).Should(BeFalse())
+		})
+	})
+
+	Context("Serving files", func() {
+		var (
+			handler http.Handler
+			sfs     *staticFileServer
+			rootDir string
+		)
+
+		large := strings.Repeat("0123456789", 100)
+
+		get := func(path string, header http.Header) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			for key, values := range header {
+				req.Header[key] = values
+			}
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+			return res
+		}
+
+		BeforeEach(func() {
+			var err error
+			rootDir, err = ioutil.TempDir("", "static")
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(ioutil.WriteFile(filepath.Join(rootDir, "index.html"), []byte("index"), 0644)).ShouldNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(rootDir, "large.txt"), []byte(large), 0644)).ShouldNot(HaveOccurred())
+			for i := 0; i < 4; i++ {
+				name := filepath.Join(rootDir, fmt.Sprintf("%d.txt", i))
+				Expect(ioutil.WriteFile(name, []byte(strings.Repeat("x", 100)), 0644)).ShouldNot(HaveOccurred())
+			}
+
+			handler, err = NewHandler(&ServerOptions{
+				RootDir:            rootDir,
+				Index:              "index.html",
+				MaxCacheSize:       250,
+				MaxCacheFileSize:   500,
+				MaxNotFoundPaths:   3,
+				DisableCompression: true,
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			sfs = handler.(*staticFileServer)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(rootDir)
+		})
+
+		It("should keep cached files within the budget", func() {
+			for i := 0; i < 4; i++ {
+				res := get(fmt.Sprintf("/%d.txt", i), nil)
+				Expect(res.Code).Should(Equal(http.StatusOK))
+			}
+			Expect(sfs.files.size).Should(BeNumerically("<=", 250))
+			Expect(sfs.files.items).Should(HaveLen(2))
+		})
+
+		It("should stream files larger than the maximum cacheable size", func() {
+			res := get("/large.txt", nil)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal(large))
+			Expect(res.Header().Get("Content-Length")).Should(Equal("1000"))
+			Expect(res.Header().Get("ETag")).Should(HavePrefix(`"`))
+
+			_, ok := sfs.getStaticFile("/large.txt")
+			Expect(ok).Should(BeFalse())
+
+			res = get("/large.txt", http.Header{"Range": {"bytes=10-19"}})
+			Expect(res.Code).Should(Equal(http.StatusPartialContent))
+			Expect(res.Body.String()).Should(Equal("0123456789"))
+
+			etag := res.Header().Get("ETag")
+			res = get("/large.txt", http.Header{"If-None-Match": {etag}})
+			Expect(res.Code).Should(Equal(http.StatusNotModified))
+		})
+
+		It("should cap the number of remembered 404 paths", func() {
+			for i := 0; i < 10; i++ {
+				res := get(fmt.Sprintf("/random/%d", i), nil)
+				Expect(res.Code).Should(Equal(http.StatusNotFound))
+			}
+			Expect(sfs.notFoundPaths.paths()).Should(HaveLen(3))
+		})
+	})
+})
@@ -0,0 +1,80 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing/fstest"
+)
+
+var _ = Describe("Handling request methods", func() {
+	var res *httptest.ResponseRecorder
+
+	do := func(handler http.Handler, method, path string) {
+		req := httptest.NewRequest(method, path, nil)
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+	}
+
+	content := []byte("console.log('app');")
+
+	handler, err := NewHandler(&ServerOptions{
+		FS: fstest.MapFS{
+			"index.html":    {Data: []byte("<html>index</html>")},
+			"js/app.js":     {Data: content},
+			"docs/page.txt": {Data: []byte("page")},
+		},
+		Index:            "index.html",
+		DirectoryListing: true,
+		MaxCacheFileSize: 10,
+	})
+
+	It("should setup handler without an error", func() {
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	It("should set Content-Length on GET", func() {
+		do(handler, http.MethodGet, "/index.html")
+		Expect(res.Code).Should(Equal(http.StatusOK))
+		Expect(res.Header().Get("Content-Length")).Should(Equal("18"))
+		Expect(res.Body.String()).Should(Equal("<html>index</html>"))
+	})
+
+	It("should reply to HEAD with the headers of GET and no body", func() {
+		do(handler, http.MethodGet, "/index.html")
+		getHeader := res.Header()
+
+		do(handler, http.MethodHead, "/index.html")
+		Expect(res.Code).Should(Equal(http.StatusOK))
+		Expect(res.Body.Len()).Should(BeZero())
+		for _, key := range []string{"Content-Length", "Content-Type", "ETag", "Last-Modified", "Cache-Control"} {
+			Expect(res.Header().Get(key)).Should(Equal(getHeader.Get(key)), key)
+		}
+	})
+
+	It("should reply to HEAD for streamed files and listings without a body", func() {
+		do(handler, http.MethodHead, "/js/app.js")
+		Expect(res.Code).Should(Equal(http.StatusOK))
+		Expect(res.Header().Get("Content-Length")).Should(Equal(strconv.Itoa(len(content))))
+		Expect(res.Body.Len()).Should(BeZero())
+
+		do(handler, http.MethodHead, "/docs/")
+		Expect(res.Code).Should(Equal(http.StatusOK))
+		Expect(res.Header().Get("Content-Length")).ShouldNot(BeEmpty())
+		Expect(res.Body.Len()).Should(BeZero())
+	})
+
+	It("should reply to OPTIONS with the allowed methods", func() {
+		do(handler, http.MethodOptions, "/index.html")
+		Expect(res.Code).Should(Equal(http.StatusNoContent))
+		Expect(res.Header().Get("Allow")).Should(Equal("GET, HEAD, OPTIONS"))
+	})
+
+	It("should reply with 405 to other methods", func() {
+		for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch} {
+			do(handler, method, "/index.html")
+			Expect(res.Code).Should(Equal(http.StatusMethodNotAllowed), method)
+			Expect(res.Header().Get("Allow")).Should(Equal("GET, HEAD, OPTIONS"))
+		}
+	})
+})
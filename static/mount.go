@@ -0,0 +1,147 @@
+package static
+
+import (
+	"github.com/pkg/errors"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// stripPrefix returns the path of a request relative to the URL path prefix of the server.
+// Requests outside the prefix are replied with 404 or redirected into the prefix
+func (sfs *staticFileServer) stripPrefix(w http.ResponseWriter, r *http.Request, fpath string) (string, bool) {
+	if sfs.urlPrefix == "/" {
+		return fpath, true
+	}
+
+	switch {
+	case r.URL.Path == sfs.urlPrefix:
+		// the mount root needs a trailing slash for relative URLs in the index page to resolve within the mount
+		redirect(w, r, sfs.urlPrefix+"/")
+		return "", false
+	case withinPrefix(fpath, sfs.urlPrefix):
+		return "/" + strings.TrimPrefix(strings.TrimPrefix(fpath, sfs.urlPrefix), "/"), true
+	case sfs.redirectOut:
+		redirect(w, r, sfs.urlPrefix+fpath)
+		return "", false
+	}
+
+	http.NotFound(w, r)
+	return "", false
+}
+
+// withinPrefix checks whether a cleaned URL path is the prefix or below it
+func withinPrefix(upath, prefix string) bool {
+	return prefix == "/" || upath == prefix || strings.HasPrefix(upath, prefix+"/")
+}
+
+// redirect permanently redirects the request to upath keeping its query
+func redirect(w http.ResponseWriter, r *http.Request, upath string) {
+	if r.URL.RawQuery != "" {
+		upath += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, upath, http.StatusMovedPermanently)
+}
+
+// mounts dispatches requests to the static file server mounted at the longest matching URL path prefix
+type mounts struct {
+	servers []*staticFileServer
+}
+
+// NewMountHandler creates a handler that serves several static file servers, each mounted at the URLPathPrefix of its options.
+// Requests are served by the server with the longest prefix containing the request path, other requests are replied with 404
+func NewMountHandler(opts ...*ServerOptions) (http.Handler, error) {
+	m := &mounts{
+		servers: make([]*staticFileServer, 0, len(opts)),
+	}
+
+	prefixes := make(map[string]struct{}, len(opts))
+	for _, opt := range opts {
+		sfs, err := newStaticFileServer(opt)
+		if err != nil {
+			m.Close()
+			return nil, errors.Wrap(err, "failed to mount "+opt.URLPathPrefix)
+		}
+
+		if _, ok := prefixes[sfs.urlPrefix]; ok {
+			sfs.Close()
+			m.Close()
+			return nil, errors.Errorf("URL path prefix %s is mounted more than once", sfs.urlPrefix)
+		}
+		prefixes[sfs.urlPrefix] = struct{}{}
+
+		// servers with outside redirects would otherwise never see requests outside their prefix
+		sfs.redirectOut = false
+
+		m.servers = append(m.servers, sfs)
+	}
+
+	sort.SliceStable(m.servers, func(i, j int) bool {
+		return len(m.servers[i].urlPrefix) > len(m.servers[j].urlPrefix)
+	})
+
+	return m, nil
+}
+
+// mount returns the server mounted at the longest prefix containing upath
+func (m *mounts) mount(upath string) (*staticFileServer, bool) {
+	upath = path.Clean("/" + upath)
+	for _, sfs := range m.servers {
+		if withinPrefix(upath, sfs.urlPrefix) {
+			return sfs, true
+		}
+	}
+	return nil, false
+}
+
+func (m *mounts) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sfs, ok := m.mount(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	sfs.ServeHTTP(w, r)
+}
+
+// Reload drops the cached files of every mounted server
+func (m *mounts) Reload() error {
+	for _, sfs := range m.servers {
+		err := sfs.Reload()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Invalidate drops the cached file of a URL path in the server it is mounted in
+func (m *mounts) Invalidate(upath string) {
+	sfs, ok := m.mount(upath)
+	if ok {
+		sfs.Invalidate(upath)
+	}
+}
+
+// Close stops watching and revalidation of files of every mounted server
+func (m *mounts) Close() error {
+	var err error
+	for _, sfs := range m.servers {
+		if cerr := sfs.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Assets returns the cached files of every mounted server sorted by URL path
+func (m *mounts) Assets() []Asset {
+	assets := make([]Asset, 0)
+	for _, sfs := range m.servers {
+		assets = append(assets, sfs.Assets()...)
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		return assets[i].Path < assets[j].Path
+	})
+	return assets
+}
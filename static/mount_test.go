@@ -0,0 +1,142 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+)
+
+var _ = Describe("Mounting static file servers at URL path prefixes", func() {
+	var res *httptest.ResponseRecorder
+
+	get := func(handler http.Handler, path string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+	}
+
+	Context("Serving a single prefix", func() {
+		handler, err := NewHandler(&ServerOptions{
+			RootDir:       RootDir,
+			Index:         "index.html",
+			URLPathPrefix: URLPrefix,
+		})
+
+		It("should setup handler without an error", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should strip the prefix from request paths", func() {
+			get(handler, "/app/css/app.f1c93db5.css")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Header().Get("Content-Type")).Should(ContainSubstring("text/css"))
+
+			get(handler, "/app/")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Header().Get("Content-Type")).Should(ContainSubstring("text/html"))
+		})
+
+		It("should redirect the prefix to its trailing slash form", func() {
+			get(handler, "/app?lang=en")
+			Expect(res.Code).Should(Equal(http.StatusMovedPermanently))
+			Expect(res.Header().Get("Location")).Should(Equal("/app/?lang=en"))
+		})
+
+		It("should reply with 404 for requests outside the prefix", func() {
+			get(handler, "/css/app.f1c93db5.css")
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+
+			get(handler, "/application/css/app.f1c93db5.css")
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+		})
+	})
+
+	Context("Redirecting requests outside the prefix", func() {
+		handler, err := NewHandler(&ServerOptions{
+			RootDir:          RootDir,
+			Index:            "index.html",
+			URLPathPrefix:    URLPrefix,
+			RedirectToPrefix: true,
+		})
+
+		It("should setup handler without an error", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should redirect to the same path within the prefix", func() {
+			get(handler, "/css/app.f1c93db5.css")
+			Expect(res.Code).Should(Equal(http.StatusMovedPermanently))
+			Expect(res.Header().Get("Location")).Should(Equal("/app/css/app.f1c93db5.css"))
+		})
+	})
+
+	Context("Serving several mounts", func() {
+		adminFS := fstest.MapFS{
+			"index.html":  {Data: []byte("<html>admin</html>")},
+			"js/admin.js": {Data: []byte("console.log('admin')")},
+		}
+
+		handler, err := NewMountHandler(
+			&ServerOptions{
+				RootDir:       RootDir,
+				Index:         "index.html",
+				URLPathPrefix: URLPrefix,
+				FallBackIndex: true,
+			},
+			&ServerOptions{
+				FS:            adminFS,
+				Index:         "index.html",
+				URLPathPrefix: "/app/admin",
+				FallBackIndex: true,
+			},
+		)
+
+		It("should setup handler without an error", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should serve each prefix from its root", func() {
+			get(handler, "/app/css/app.f1c93db5.css")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+
+			get(handler, "/app/admin/js/admin.js")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("console.log('admin')"))
+		})
+
+		It("should serve the index page of the longest matching prefix", func() {
+			get(handler, "/app/admin/users")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("<html>admin</html>"))
+
+			get(handler, "/app/users")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(ContainSubstring("Antibug"))
+		})
+
+		It("should reply with 404 for requests outside every mount", func() {
+			get(handler, "/other/index.html")
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+		})
+
+		It("should invalidate files within their mount", func() {
+			get(handler, "/app/admin/js/admin.js")
+			adminFS["js/admin.js"] = &fstest.MapFile{Data: []byte("console.log('updated')")}
+
+			get(handler, "/app/admin/js/admin.js")
+			Expect(res.Body.String()).Should(Equal("console.log('admin')"))
+
+			handler.(Cache).Invalidate("/app/admin/js/admin.js")
+			get(handler, "/app/admin/js/admin.js")
+			Expect(res.Body.String()).Should(Equal("console.log('updated')"))
+		})
+
+		It("should fail for duplicate prefixes", func() {
+			_, err := NewMountHandler(
+				&ServerOptions{FS: adminFS, URLPathPrefix: "/admin"},
+				&ServerOptions{FS: adminFS, URLPathPrefix: "/admin/"},
+			)
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+})
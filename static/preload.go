@@ -0,0 +1,130 @@
+package static
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// preloadAs infers the request destination of a preloaded URL path from its content type.
+// It returns an empty string when the destination is unknown
+func preloadAs(target string) string {
+	upath := target
+	if i := strings.IndexAny(upath, "?#"); i >= 0 {
+		upath = upath[:i]
+	}
+
+	mediaType := strings.SplitN(mime.TypeByExtension(path.Ext(upath)), ";", 2)[0]
+	switch {
+	case strings.HasSuffix(mediaType, "javascript"):
+		return "script"
+	case mediaType == "text/css":
+		return "style"
+	case strings.Contains(mediaType, "font"):
+		return "font"
+	case strings.HasPrefix(mediaType, "image/"):
+		return "image"
+	}
+
+	return ""
+}
+
+// preloadLink returns the Link header value that preloads target. Targets of unknown destination are not preloaded
+func preloadLink(target string) (string, bool) {
+	as := preloadAs(target)
+	if as == "" {
+		return "", false
+	}
+
+	link := "<" + target + ">; rel=preload; as=" + as
+	if as == "font" {
+		// fonts are always fetched in cors mode, the preload is not used otherwise
+		link += "; crossorigin"
+	}
+
+	return link, true
+}
+
+// preloadLinks returns the Link header values of push targets
+func preloadLinks(targets []string) []string {
+	links := make([]string, 0, len(targets))
+	for _, target := range targets {
+		link, ok := preloadLink(target)
+		if ok {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// indexPreloads parses an index page for the local scripts and stylesheets it loads.
+// Relative URLs are resolved against urlPrefix
+func indexPreloads(data []byte, urlPrefix string) []string {
+	var (
+		targets = make([]string, 0)
+		seen    = make(map[string]struct{}, 0)
+		z       = html.NewTokenizer(bytes.NewReader(data))
+	)
+
+	add := func(ref string) {
+		ref = strings.TrimSpace(ref)
+		if ref == "" || strings.HasPrefix(ref, "//") || strings.Contains(ref, ":") {
+			// external and data URLs are not ours to preload
+			return
+		}
+		if !strings.HasPrefix(ref, "/") {
+			ref = path.Join(urlPrefix, ref)
+		}
+		if _, ok := seen[ref]; ok {
+			return
+		}
+		seen[ref] = struct{}{}
+		targets = append(targets, ref)
+	}
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return targets
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+
+		token := z.Token()
+		attrs := make(map[string]string, len(token.Attr))
+		for _, attr := range token.Attr {
+			attrs[attr.Key] = attr.Val
+		}
+
+		switch token.DataAtom {
+		case atom.Script:
+			add(attrs["src"])
+		case atom.Link:
+			for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+				if rel == "stylesheet" || rel == "preload" || rel == "modulepreload" {
+					add(attrs["href"])
+					break
+				}
+			}
+		}
+	}
+}
+
+// sendEarlyHints writes the preload Link headers already set on w in a 103 Early Hints response.
+// Hints are only sent to GET requests about to be answered with the whole file, since the client would preload for nothing otherwise.
+// HTTP/1.0 clients do not understand informational responses
+func (sfs *staticFileServer) sendEarlyHints(w http.ResponseWriter, r *http.Request, etag string, modTime time.Time) {
+	if !sfs.earlyHints || len(w.Header()["Link"]) == 0 || !r.ProtoAtLeast(1, 1) {
+		return
+	}
+	if r.Method != http.MethodGet || r.Header.Get("Range") != "" || notModified(r, etag, modTime) {
+		return
+	}
+	w.WriteHeader(http.StatusEarlyHints)
+}
@@ -0,0 +1,193 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+)
+
+var _ = Describe("Preload hints for push content", func() {
+	var res *httptest.ResponseRecorder
+
+	get := func(handler http.Handler, path string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+	}
+
+	Context("Inferring the preload destination", func() {
+		It("should infer the destination from the mime type", func() {
+			Expect(preloadAs("/app/js/app.2a385984.js")).Should(Equal("script"))
+			Expect(preloadAs("/app/css/app.f1c93db5.css?v=1")).Should(Equal("style"))
+			Expect(preloadAs("/app/fonts/roboto.woff2")).Should(Equal("font"))
+			Expect(preloadAs("/app/img/logo.png")).Should(Equal("image"))
+			Expect(preloadAs("/app/manifest.json")).Should(BeEmpty())
+		})
+
+		It("should mark font preloads as cross origin", func() {
+			link, ok := preloadLink("/fonts/roboto.woff2")
+			Expect(ok).Should(BeTrue())
+			Expect(link).Should(Equal("</fonts/roboto.woff2>; rel=preload; as=font; crossorigin"))
+
+			_, ok = preloadLink("/manifest.json")
+			Expect(ok).Should(BeFalse())
+		})
+	})
+
+	Context("Serving pages with push content", func() {
+		handler, err := NewHandler(&ServerOptions{
+			RootDir:       RootDir,
+			Index:         "index.html",
+			URLPathPrefix: URLPrefix,
+			PushContent: map[string][]string{
+				"/": {
+					"/css/app.f1c93db5.css",
+					"/js/app.2a385984.js",
+					"/manifest.json",
+				},
+			},
+		})
+
+		It("should setup handler without an error", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should set preload Link headers for the root path", func() {
+			get(handler, "/app/")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Header()["Link"]).Should(ConsistOf(
+				"</app/css/app.f1c93db5.css>; rel=preload; as=style",
+				"</app/js/app.2a385984.js>; rel=preload; as=script",
+			))
+		})
+
+		It("should not set Link headers for paths without push content", func() {
+			get(handler, "/app/favicon.ico")
+			Expect(res.Header()["Link"]).Should(BeEmpty())
+		})
+	})
+
+	Context("Deriving push content from the index page", func() {
+		handler, err := NewHandler(&ServerOptions{
+			RootDir:       RootDir,
+			Index:         "index.html",
+			URLPathPrefix: URLPrefix,
+			PreloadIndex:  true,
+		})
+
+		It("should setup handler without an error", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should preload the scripts and stylesheets of the index page", func() {
+			for _, path := range []string{"/app/", "/app/index.html"} {
+				get(handler, path)
+				Expect(res.Code).Should(Equal(http.StatusOK))
+				Expect(res.Header()["Link"]).Should(ConsistOf(
+					"</app/css/app.f1c93db5.css>; rel=preload; as=style",
+					"</app/css/chunk-vendors.4ca44aa7.css>; rel=preload; as=style",
+					"</app/js/app.2a385984.js>; rel=preload; as=script",
+					"</app/js/chunk-vendors.fe8e2aad.js>; rel=preload; as=script",
+				))
+			}
+		})
+
+		It("should skip external, prefetched and duplicate references", func() {
+			targets := indexPreloads([]byte(`<html><head>
+				<link href=https://cdn.example.com/all.css rel=stylesheet>
+				<link href=//cdn.example.com/other.css rel=stylesheet>
+				<link href=/app/js/about.js rel=prefetch>
+				<link href=css/app.css rel=stylesheet>
+				<link rel="modulepreload" href="/app/js/module.js">
+				</head><body>
+				<script src=js/app.js></script>
+				<script src=/app/js/app.js></script>
+				<script>console.log('inline')</script>
+				</body></html>`), "/app")
+			Expect(targets).Should(Equal([]string{"/app/css/app.css", "/app/js/module.js", "/app/js/app.js"}))
+		})
+	})
+
+	Context("Sending early hints", func() {
+		handler, err := NewHandler(&ServerOptions{
+			RootDir:       RootDir,
+			Index:         "index.html",
+			URLPathPrefix: URLPrefix,
+			PreloadIndex:  true,
+			EarlyHints:    true,
+		})
+
+		It("should setup handler without an error", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		// send returns the response to a request and the codes and links of the informational responses before it
+		send := func(method, path string, header http.Header) (*http.Response, []int, []string) {
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			var (
+				hintCodes []int
+				hintLinks []string
+			)
+			trace := &httptrace.ClientTrace{
+				Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+					hintCodes = append(hintCodes, code)
+					hintLinks = append(hintLinks, header["Link"]...)
+					return nil
+				},
+			}
+
+			req, err := http.NewRequest(method, server.URL+path, nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			for key, values := range header {
+				req.Header[key] = values
+			}
+			req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ShouldNot(HaveOccurred())
+			resp.Body.Close()
+
+			return resp, hintCodes, hintLinks
+		}
+
+		It("should send the Link headers in a 103 response before the page", func() {
+			resp, hintCodes, hintLinks := send(http.MethodGet, "/app/", nil)
+
+			Expect(resp.StatusCode).Should(Equal(http.StatusOK))
+			Expect(hintCodes).Should(Equal([]int{http.StatusEarlyHints}))
+			Expect(hintLinks).Should(ContainElement("</app/js/app.2a385984.js>; rel=preload; as=script"))
+			Expect(resp.Header["Link"]).Should(HaveLen(len(hintLinks)))
+		})
+
+		It("should not send hints to HEAD requests", func() {
+			resp, hintCodes, _ := send(http.MethodHead, "/app/", nil)
+
+			Expect(resp.StatusCode).Should(Equal(http.StatusOK))
+			Expect(hintCodes).Should(BeEmpty())
+		})
+
+		It("should not send hints before a 404", func() {
+			resp, hintCodes, _ := send(http.MethodGet, "/app/missing", nil)
+
+			Expect(resp.StatusCode).Should(Equal(http.StatusNotFound))
+			Expect(hintCodes).Should(BeEmpty())
+		})
+
+		It("should not set preload Link headers on a 404 of a navigation path", func() {
+			get(handler, "/app/missing")
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+			Expect(res.Header()["Link"]).Should(BeEmpty())
+		})
+
+		It("should not send hints before a 304", func() {
+			resp, _, _ := send(http.MethodGet, "/app/", nil)
+
+			resp, hintCodes, _ := send(http.MethodGet, "/app/", http.Header{"If-None-Match": {resp.Header.Get("ETag")}})
+			Expect(resp.StatusCode).Should(Equal(http.StatusNotModified))
+			Expect(hintCodes).Should(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,240 @@
+package static
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// PushRule pushes and preloads files for requests whose URL path matches Path.
+// Path is an exact URL path, a prefix ending with * or a glob pattern. Patterns without a slash are matched against the file name.
+// When several rules match a path, exact paths win over patterns, longer patterns win over shorter ones
+// and file name patterns are tried last
+type PushRule struct {
+	Path    string            // Pattern of request URL paths
+	Files   []string          // URL paths of files to push, relative to URLPathPrefix
+	Exclude []string          // Patterns of request URL paths the rule does not apply to
+	Methods []string          // Request methods the rule applies to, all methods when empty
+	Headers map[string]string // Request headers the rule requires. An empty value only requires the header to be present
+}
+
+// pushRule is a compiled PushRule
+type pushRule struct {
+	pattern   string
+	literal   string // pattern up to its first wildcard
+	prefix    bool   // pattern is the literal followed by a single trailing *
+	exclude   []string
+	methods   map[string]struct{}
+	headers   map[string]string
+	pushFiles []string
+	links     []string // preload Link header values of pushFiles
+}
+
+// cleanPattern cleans a URL path pattern and returns it with its part up to the first wildcard
+func cleanPattern(pattern string) (string, string) {
+	if strings.Contains(pattern, "/") {
+		// request paths are cleaned, path.Clean keeps wildcards
+		pattern = path.Clean("/" + pattern)
+	}
+
+	literal := pattern
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		literal = pattern[:i]
+	}
+
+	return pattern, literal
+}
+
+// newPushRule compiles a rule whose files are already resolved to URL paths
+func newPushRule(pattern string, pushFiles []string) *pushRule {
+	pattern, literal := cleanPattern(pattern)
+
+	return &pushRule{
+		pattern:   pattern,
+		literal:   literal,
+		prefix:    pattern == literal+"*",
+		pushFiles: pushFiles,
+		links:     preloadLinks(pushFiles),
+	}
+}
+
+// exact checks whether the rule matches a single path
+func (pr *pushRule) exact() bool {
+	return pr.pattern == pr.literal && strings.HasPrefix(pr.pattern, "/")
+}
+
+// bucket returns the directory under which the rule is looked up. Rules matching file names have an empty bucket
+func (pr *pushRule) bucket() string {
+	return pr.literal[:strings.LastIndex(pr.literal, "/")+1]
+}
+
+// applies checks whether the rule applies to a request for upath
+func (pr *pushRule) applies(r *http.Request, upath string) bool {
+	if pr.prefix && strings.HasPrefix(pr.pattern, "/") {
+		if !strings.HasPrefix(upath, pr.literal) {
+			return false
+		}
+	} else if !matchPattern(pr.pattern, upath) {
+		return false
+	}
+
+	for _, pattern := range pr.exclude {
+		if matchPattern(pattern, upath) {
+			return false
+		}
+	}
+
+	if len(pr.methods) > 0 {
+		if _, ok := pr.methods[r.Method]; !ok {
+			return false
+		}
+	}
+
+	for key, want := range pr.headers {
+		values := r.Header.Values(key)
+		if len(values) == 0 {
+			return false
+		}
+		if want != "" && !headerHasValue(values, want) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// headerHasValue checks whether comma separated header values contain want, ignoring case
+func headerHasValue(values []string, want string) bool {
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchPattern matches a URL path against an exact path, a prefix ending with * or a glob pattern.
+// Patterns without a slash are matched against the last element
+func matchPattern(pattern, upath string) bool {
+	if !strings.Contains(pattern, "/") {
+		return matchGlob(pattern, upath)
+	}
+	if strings.HasSuffix(pattern, "*") && !strings.ContainsAny(pattern[:len(pattern)-1], `*?[\`) {
+		return strings.HasPrefix(upath, pattern[:len(pattern)-1])
+	}
+	ok, err := path.Match(pattern, upath)
+	return err == nil && ok
+}
+
+// pushTable finds the push rule of a request path by visiting only the rules that could match it
+type pushTable struct {
+	exact   map[string][]*pushRule // rules of exact paths in order of addition
+	buckets map[string][]*pushRule // pattern rules keyed by the directory of their literal, most specific first
+}
+
+func newPushTable() *pushTable {
+	return &pushTable{
+		exact:   make(map[string][]*pushRule, 0),
+		buckets: make(map[string][]*pushRule, 0),
+	}
+}
+
+// add adds a rule to the table
+func (pt *pushTable) add(rule *pushRule) {
+	if rule.exact() {
+		pt.exact[rule.pattern] = append(pt.exact[rule.pattern], rule)
+		return
+	}
+
+	bucket := rule.bucket()
+	rules := append(pt.buckets[bucket], rule)
+	sort.SliceStable(rules, func(i, j int) bool {
+		if len(rules[i].literal) != len(rules[j].literal) {
+			return len(rules[i].literal) > len(rules[j].literal)
+		}
+		return len(rules[i].pattern) > len(rules[j].pattern)
+	})
+	pt.buckets[bucket] = rules
+}
+
+// merge adds files to the unconditional rule of an exact path without duplicates, creating the rule when missing
+func (pt *pushTable) merge(upath string, pushFiles []string) {
+	var rule *pushRule
+	for _, pr := range pt.exact[upath] {
+		if len(pr.exclude) == 0 && len(pr.methods) == 0 && len(pr.headers) == 0 {
+			rule = pr
+			break
+		}
+	}
+	if rule == nil {
+		rule = newPushRule(upath, make([]string, 0, len(pushFiles)))
+		pt.add(rule)
+	}
+
+	for _, target := range pushFiles {
+		found := false
+		for _, pushFile := range rule.pushFiles {
+			if pushFile == target {
+				found = true
+				break
+			}
+		}
+		if !found {
+			rule.pushFiles = append(rule.pushFiles, target)
+		}
+	}
+
+	rule.links = preloadLinks(rule.pushFiles)
+}
+
+// match returns the most specific rule that applies to a request for upath
+func (pt *pushTable) match(r *http.Request, upath string) (*pushRule, bool) {
+	for _, rule := range pt.exact[upath] {
+		if rule.applies(r, upath) {
+			return rule, true
+		}
+	}
+
+	// rules of deeper directories have longer literals, so ancestors are visited from the deepest
+	dir := upath[:strings.LastIndex(upath, "/")+1]
+	for {
+		for _, rule := range pt.buckets[dir] {
+			if rule.applies(r, upath) {
+				return rule, true
+			}
+		}
+		if dir == "" {
+			return nil, false
+		}
+		dir = dir[:strings.LastIndex(strings.TrimSuffix(dir, "/"), "/")+1]
+	}
+}
+
+// serverPush pushes content to the client and sets preload Link headers for clients without push support
+func (sfs *staticFileServer) serverPush(w http.ResponseWriter, r *http.Request, upath string) bool {
+	// return early when push support is not enabled
+	if !sfs.pushSupport {
+		return false
+	}
+
+	rule, ok := sfs.pushRules.match(r, upath)
+	if !ok {
+		return false
+	}
+
+	if pusher, ok := w.(http.Pusher); ok {
+		for _, target := range rule.pushFiles {
+			pusher.Push(target, sfs.pushOptions)
+		}
+	}
+
+	// the links are sent in early hints once the file is known to be served
+	for _, link := range rule.links {
+		w.Header().Add("Link", link)
+	}
+
+	return true
+}
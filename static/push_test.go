@@ -0,0 +1,137 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Matching push rules", func() {
+	newTable := func(patterns ...string) *pushTable {
+		pt := newPushTable()
+		for _, pattern := range patterns {
+			pt.add(newPushRule(pattern, []string{pattern}))
+		}
+		return pt
+	}
+
+	matched := func(pt *pushTable, r *http.Request, upath string) string {
+		rule, ok := pt.match(r, upath)
+		if !ok {
+			return ""
+		}
+		return rule.pattern
+	}
+
+	get := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	Context("Matching paths", func() {
+		pt := newTable("/", "/docs/*", "/docs/api/*", "/docs/api/v1.html", "/blog/*/index.html", "/js/*.js", "/*", "*.css")
+
+		It("should prefer exact paths", func() {
+			Expect(matched(pt, get, "/")).Should(Equal("/"))
+			Expect(matched(pt, get, "/docs/api/v1.html")).Should(Equal("/docs/api/v1.html"))
+		})
+
+		It("should prefer the longest matching prefix", func() {
+			Expect(matched(pt, get, "/docs/guide.html")).Should(Equal("/docs/*"))
+			Expect(matched(pt, get, "/docs/api/v2.html")).Should(Equal("/docs/api/*"))
+			Expect(matched(pt, get, "/docs/api/deep/v3.html")).Should(Equal("/docs/api/*"))
+		})
+
+		It("should match glob patterns", func() {
+			Expect(matched(pt, get, "/blog/2020/index.html")).Should(Equal("/blog/*/index.html"))
+			Expect(matched(pt, get, "/js/app.js")).Should(Equal("/js/*.js"))
+		})
+
+		It("should fall back to shorter patterns", func() {
+			Expect(matched(pt, get, "/blog/2020/post.html")).Should(Equal("/*"))
+			Expect(matched(pt, get, "/js/app.map")).Should(Equal("/*"))
+		})
+
+		It("should try file name patterns last", func() {
+			pt := newTable("*.css", "/css/*.html")
+			Expect(matched(pt, get, "/css/app.css")).Should(Equal("*.css"))
+			Expect(matched(pt, get, "/css/app.html")).Should(Equal("/css/*.html"))
+			Expect(matched(pt, get, "/app.js")).Should(BeEmpty())
+		})
+	})
+
+	Context("Matching request conditions", func() {
+		pt := newPushTable()
+
+		excluded := newPushRule("/app/*", []string{"excluded"})
+		excluded.exclude = []string{"/app/admin/*", "*.map"}
+		pt.add(excluded)
+
+		methods := newPushRule("/forms/*", []string{"methods"})
+		methods.methods = map[string]struct{}{http.MethodHead: {}}
+		pt.add(methods)
+
+		headers := newPushRule("/", []string{"headers"})
+		headers.headers = map[string]string{"Accept": "text/html", "X-Preload": ""}
+		pt.add(headers)
+
+		pt.add(newPushRule("/*", []string{"fallback"}))
+
+		It("should skip excluded paths", func() {
+			Expect(matched(pt, get, "/app/home")).Should(Equal("/app/*"))
+			Expect(matched(pt, get, "/app/admin/users")).Should(Equal("/*"))
+			Expect(matched(pt, get, "/app/js/app.js.map")).Should(Equal("/*"))
+		})
+
+		It("should check the request method", func() {
+			Expect(matched(pt, get, "/forms/signup")).Should(Equal("/*"))
+			head := httptest.NewRequest(http.MethodHead, "/forms/signup", nil)
+			Expect(matched(pt, head, "/forms/signup")).Should(Equal("/forms/*"))
+		})
+
+		It("should check the request headers", func() {
+			Expect(matched(pt, get, "/")).Should(Equal("/*"))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", "text/html, application/xhtml+xml")
+			Expect(matched(pt, req, "/")).Should(Equal("/*"))
+
+			req.Header.Set("X-Preload", "1")
+			Expect(matched(pt, req, "/")).Should(Equal("/"))
+		})
+	})
+
+	Context("Serving pages with wildcard push content", func() {
+		var res *httptest.ResponseRecorder
+
+		handler, err := NewHandler(&ServerOptions{
+			RootDir:       RootDir,
+			Index:         "index.html",
+			URLPathPrefix: URLPrefix,
+			FallBackIndex: true,
+			PushContent: map[string][]string{
+				"/*": {"/css/app.f1c93db5.css"},
+			},
+			PushRules: []PushRule{
+				{
+					Path:    "/account/*",
+					Files:   []string{"/js/account.663ddf24.js"},
+					Exclude: []string{"/account/logout"},
+				},
+			},
+		})
+
+		It("should setup handler without an error", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should preload the files of the most specific rule", func() {
+			req := httptest.NewRequest(http.MethodGet, "/app/account/settings", nil)
+			res = httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Header()["Link"]).Should(Equal([]string{"</app/js/account.663ddf24.js>; rel=preload; as=script"}))
+
+			req = httptest.NewRequest(http.MethodGet, "/app/account/logout", nil)
+			res = httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+			Expect(res.Header()["Link"]).Should(Equal([]string{"</app/css/app.f1c93db5.css>; rel=preload; as=style"}))
+		})
+	})
+})
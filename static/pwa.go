@@ -0,0 +1,192 @@
+package static
+
+import (
+	"github.com/pkg/errors"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Patterns of service worker scripts and precache manifests generated by common build tools
+var (
+	defaultServiceWorkers    = []string{"service-worker.js", "sw.js"}
+	defaultPrecacheManifests = []string{"precache-manifest.*.js"}
+)
+
+// precacheURLPattern matches the url of precache entries such as {"revision": "...", "url": "/index.html"}
+var precacheURLPattern = regexp.MustCompile(`\burl["']?\s*:\s*["']([^"']+)["']`)
+
+// precacheCallPattern matches the start of a precache list passed inline to workbox, as in precacheAndRoute([...])
+var precacheCallPattern = regexp.MustCompile(`\bprecache(?:AndRoute)?\(\s*\[`)
+
+// PrecacheError lists URLs of precache manifests that have no file in root
+type PrecacheError struct {
+	Missing []string
+}
+
+func (e *PrecacheError) Error() string {
+	return "precache manifest URLs missing from root: " + strings.Join(e.Missing, ", ")
+}
+
+// contentType returns the content type of a file name. Web app manifests are told apart from other JSON
+func contentType(name string) string {
+	if path.Base(name) == "manifest.json" || path.Ext(name) == ".webmanifest" {
+		return "application/manifest+json"
+	}
+	return mime.TypeByExtension(path.Ext(name))
+}
+
+// isServiceWorker checks whether a path is a service worker script
+func (sfs *staticFileServer) isServiceWorker(name string) bool {
+	for _, pattern := range sfs.serviceWorkers {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// setFileHeaders sets the caching headers of a file. Service workers are revalidated whatever the cache policy,
+// so that clients pick up new versions of the app
+func (sfs *staticFileServer) setFileHeaders(w http.ResponseWriter, name string) {
+	cacheControl := sfs.cachePolicy.cacheControl(name)
+
+	if sfs.isServiceWorker(name) {
+		cacheControl = CacheNoCache
+		if sfs.swAllowed != "" {
+			w.Header().Set("Service-Worker-Allowed", sfs.swAllowed)
+		}
+	}
+
+	if cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+}
+
+// validatePrecache checks that every URL listed in the precache manifests and service workers in root has a file
+func (sfs *staticFileServer) validatePrecache(manifests []string) error {
+	if manifests == nil {
+		manifests = defaultPrecacheManifests
+	}
+
+	missing := make(map[string]struct{})
+	for _, pattern := range append(manifests, sfs.serviceWorkers...) {
+		matches, err := fs.Glob(sfs.fsys, pattern)
+		if err != nil {
+			return errors.Wrapf(err, "invalid precache manifest pattern %q", pattern)
+		}
+
+		for _, name := range matches {
+			bs, err := fs.ReadFile(sfs.fsys, name)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read precache manifest %s", name)
+			}
+
+			// service workers hold other code too, only the lists they precache are checked
+			lists := [][]byte{bs}
+			if sfs.isServiceWorker(name) {
+				lists = precacheLists(bs)
+			}
+
+			for _, list := range lists {
+				for _, match := range precacheURLPattern.FindAllSubmatch(list, -1) {
+					entry := string(match[1])
+					if !sfs.precached(entry) {
+						missing[entry] = struct{}{}
+					}
+				}
+			}
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	precacheErr := &PrecacheError{Missing: make([]string, 0, len(missing))}
+	for entry := range missing {
+		precacheErr.Missing = append(precacheErr.Missing, entry)
+	}
+	sort.Strings(precacheErr.Missing)
+
+	return precacheErr
+}
+
+// precacheLists returns the array literals of a script passed inline to the workbox precache calls
+func precacheLists(bs []byte) [][]byte {
+	lists := make([][]byte, 0)
+	for _, loc := range precacheCallPattern.FindAllIndex(bs, -1) {
+		start := loc[1] - 1
+		if end := closingBracket(bs, start); end > start {
+			lists = append(lists, bs[start:end+1])
+		}
+	}
+	return lists
+}
+
+// closingBracket returns the index of the bracket closing the one at start, skipping brackets in strings.
+// It returns -1 when the bracket is not closed
+func closingBracket(bs []byte, start int) int {
+	depth := 0
+	var quote byte
+	for i := start; i < len(bs); i++ {
+		c := bs[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '[' || c == '{' || c == '(':
+			depth++
+		case c == ']' || c == '}' || c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// precached checks whether a precache URL refers to a file that is served. URLs of other hosts are not checked
+func (sfs *staticFileServer) precached(entry string) bool {
+	u, err := url.Parse(entry)
+	if err != nil {
+		return false
+	}
+	if u.Scheme != "" || u.Host != "" {
+		return true
+	}
+
+	// relative URLs are relative to the service worker at the root of the app
+	upath := u.Path
+	if strings.HasPrefix(upath, "/") {
+		if !withinPrefix(path.Clean(upath), sfs.urlPrefix) {
+			return false
+		}
+		upath = strings.TrimPrefix(path.Clean(upath), sfs.urlPrefix)
+	}
+
+	name, err := sfs.resolve(upath)
+	if err != nil {
+		return false
+	}
+	if name == "." {
+		name = fsName(sfs.indexPage)
+	}
+
+	finfo, err := fs.Stat(sfs.fsys, name)
+	if err != nil {
+		return false
+	}
+	return !finfo.IsDir() || sfs.listing
+}
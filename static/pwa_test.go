@@ -0,0 +1,115 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+)
+
+var _ = Describe("Service worker and PWA serving", func() {
+	var res *httptest.ResponseRecorder
+
+	get := func(handler http.Handler, path string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+	}
+
+	manifest := `self.__precacheManifest = (self.__precacheManifest || []).concat([
+  {"revision": "a1", "url": "/index.html"},
+  {"revision": "b2", "url": "/static/js/main.2a385984.js"},
+  {"revision": "c3", "url": "static/css/main.5ecd60fb.css"},
+  {"revision": "d4", "url": "https://fonts.example.com/font.woff2"}
+]);`
+
+	files := func() fstest.MapFS {
+		return fstest.MapFS{
+			"index.html":                     {Data: []byte("<html></html>")},
+			"service-worker.js":              {Data: []byte(`importScripts("/precache-manifest.3f2a1b0c.js");`)},
+			"manifest.json":                  {Data: []byte(`{"name": "app"}`)},
+			"precache-manifest.3f2a1b0c.js":  {Data: []byte(manifest)},
+			"static/js/main.2a385984.js":     {Data: []byte("main()")},
+			"static/css/main.5ecd60fb.css":   {Data: []byte("body{}")},
+			"static/js/vendor.9b8c7d6e.js":   {Data: []byte("vendor()")},
+			"static/media/logo.0a1b2c3d.svg": {Data: []byte("<svg></svg>")},
+		}
+	}
+
+	It("should always revalidate service workers", func() {
+		handler, err := NewHandler(&ServerOptions{
+			FS:          files(),
+			CachePolicy: &CachePolicy{Rules: []CacheRule{{Pattern: "*.js", CacheControl: CacheImmutable}}},
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		get(handler, "/service-worker.js")
+		Expect(res.Code).Should(Equal(http.StatusOK))
+		Expect(res.Header().Get("Cache-Control")).Should(Equal(CacheNoCache))
+		Expect(res.Header().Get("Service-Worker-Allowed")).Should(BeEmpty())
+
+		get(handler, "/static/js/main.2a385984.js")
+		Expect(res.Header().Get("Cache-Control")).Should(Equal(CacheImmutable))
+	})
+
+	It("should set the Service-Worker-Allowed header of service workers", func() {
+		handler, err := NewHandler(&ServerOptions{
+			FS:                   files(),
+			ServiceWorkers:       []string{"/static/js/sw.js", "service-worker.js"},
+			ServiceWorkerAllowed: "/",
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		get(handler, "/service-worker.js")
+		Expect(res.Header().Get("Service-Worker-Allowed")).Should(Equal("/"))
+
+		get(handler, "/static/js/main.2a385984.js")
+		Expect(res.Header().Get("Service-Worker-Allowed")).Should(BeEmpty())
+	})
+
+	It("should serve web app manifests with their content type", func() {
+		handler, err := NewHandler(&ServerOptions{FS: files()})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		get(handler, "/manifest.json")
+		Expect(res.Header().Get("Content-Type")).Should(Equal("application/manifest+json"))
+	})
+
+	It("should validate precache manifests", func() {
+		_, err := NewHandler(&ServerOptions{FS: files(), ValidatePrecache: true})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	It("should report URLs missing from root", func() {
+		fsys := files()
+		delete(fsys, "static/css/main.5ecd60fb.css")
+		fsys["service-worker.js"] = &fstest.MapFile{Data: []byte(`precacheAndRoute([{url: "/offline.html", revision: null}]);`)}
+
+		_, err := NewHandler(&ServerOptions{FS: fsys, ValidatePrecache: true})
+		Expect(err).Should(HaveOccurred())
+		precacheErr, ok := err.(*PrecacheError)
+		Expect(ok).Should(BeTrue())
+		Expect(precacheErr.Missing).Should(Equal([]string{"/offline.html", "static/css/main.5ecd60fb.css"}))
+	})
+
+	It("should only check the precache lists of service workers", func() {
+		fsys := files()
+		fsys["service-worker.js"] = &fstest.MapFile{Data: []byte(`
+workbox.precaching.precacheAndRoute([{url: "/index.html", revision: "1"}, {url: "/offline.html", revision: "[2]"}]);
+workbox.routing.registerRoute(({url}) => url.pathname.startsWith("/api"), new workbox.strategies.NetworkFirst());
+self.addEventListener("message", () => fetch({url: "/api/sync"}));
+`)}
+
+		_, err := NewHandler(&ServerOptions{FS: fsys, ValidatePrecache: true})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.(*PrecacheError).Missing).Should(Equal([]string{"/offline.html"}))
+	})
+
+	It("should check URLs against the URL path prefix", func() {
+		fsys := files()
+		fsys["precache-manifest.3f2a1b0c.js"] = &fstest.MapFile{Data: []byte(`[{"url": "/app/static/js/main.2a385984.js"}, {"url": "/other/app.js"}]`)}
+
+		_, err := NewHandler(&ServerOptions{FS: fsys, URLPathPrefix: "/app", ValidatePrecache: true})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.(*PrecacheError).Missing).Should(Equal([]string{"/other/app.js"}))
+	})
+})
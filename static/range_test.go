@@ -0,0 +1,149 @@
+package static
+
+import (
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing/fstest"
+	"time"
+)
+
+var _ = Describe("Byte range requests", func() {
+	var res *httptest.ResponseRecorder
+
+	get := func(handler http.Handler, path string, header http.Header) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+	}
+
+	// parts returns the bodies of a multipart/byteranges response
+	parts := func() []string {
+		mediaType, params, err := mime.ParseMediaType(res.Header().Get("Content-Type"))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(mediaType).Should(Equal("multipart/byteranges"))
+
+		bodies := make([]string, 0)
+		mr := multipart.NewReader(res.Body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			bs, err := ioutil.ReadAll(part)
+			Expect(err).ShouldNot(HaveOccurred())
+			bodies = append(bodies, string(bs))
+		}
+		return bodies
+	}
+
+	modTime := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	text := strings.Repeat("0123456789", 200)
+	video := strings.Repeat("abcdefghij", 400)
+
+	handler, err := NewHandler(&ServerOptions{
+		FS: fstest.MapFS{
+			"doc.txt":   {Data: []byte(text), ModTime: modTime},
+			"video.mp4": {Data: []byte(video), ModTime: modTime},
+		},
+		MaxCacheFileSize: 3000,
+	})
+
+	It("should setup handler without an error", func() {
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	Context("Requesting cached files", func() {
+		It("should serve a single range", func() {
+			get(handler, "/doc.txt", http.Header{"Range": {"bytes=10-14"}})
+			Expect(res.Code).Should(Equal(http.StatusPartialContent))
+			Expect(res.Header().Get("Content-Range")).Should(Equal("bytes 10-14/2000"))
+			Expect(res.Header().Get("Content-Length")).Should(Equal("5"))
+			Expect(res.Body.String()).Should(Equal("01234"))
+		})
+
+		It("should serve several ranges", func() {
+			get(handler, "/doc.txt", http.Header{"Range": {"bytes=0-2,-3"}})
+			Expect(res.Code).Should(Equal(http.StatusPartialContent))
+			Expect(parts()).Should(Equal([]string{"012", "789"}))
+		})
+
+		It("should serve ranges of the identity representation", func() {
+			get(handler, "/doc.txt", http.Header{"Accept-Encoding": {"gzip"}})
+			Expect(res.Header().Get("Content-Encoding")).Should(Equal("gzip"))
+
+			get(handler, "/doc.txt", http.Header{"Accept-Encoding": {"gzip"}, "Range": {"bytes=5-9"}})
+			Expect(res.Code).Should(Equal(http.StatusPartialContent))
+			Expect(res.Header().Get("Content-Encoding")).Should(BeEmpty())
+			Expect(res.Body.String()).Should(Equal("56789"))
+		})
+
+		It("should validate If-Range against the entity tag", func() {
+			get(handler, "/doc.txt", nil)
+			etag := res.Header().Get("ETag")
+
+			get(handler, "/doc.txt", http.Header{"Range": {"bytes=0-3"}, "If-Range": {etag}})
+			Expect(res.Code).Should(Equal(http.StatusPartialContent))
+			Expect(res.Body.String()).Should(Equal("0123"))
+
+			get(handler, "/doc.txt", http.Header{"Range": {"bytes=0-3"}, "If-Range": {`"stale"`}})
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.Len()).Should(Equal(len(text)))
+		})
+
+		It("should validate If-Range against the modification time", func() {
+			get(handler, "/doc.txt", http.Header{"Range": {"bytes=0-3"}, "If-Range": {modTime.Format(http.TimeFormat)}})
+			Expect(res.Code).Should(Equal(http.StatusPartialContent))
+
+			stale := modTime.Add(-time.Hour).Format(http.TimeFormat)
+			get(handler, "/doc.txt", http.Header{"Range": {"bytes=0-3"}, "If-Range": {stale}})
+			Expect(res.Code).Should(Equal(http.StatusOK))
+		})
+
+		It("should reject unsatisfiable ranges", func() {
+			get(handler, "/doc.txt", http.Header{"Range": {"bytes=5000-6000"}})
+			Expect(res.Code).Should(Equal(http.StatusRequestedRangeNotSatisfiable))
+			Expect(res.Header().Get("Content-Range")).Should(Equal("bytes */2000"))
+		})
+	})
+
+	Context("Requesting streamed files", func() {
+		It("should serve single and several ranges", func() {
+			get(handler, "/video.mp4", http.Header{"Range": {"bytes=3990-"}})
+			Expect(res.Code).Should(Equal(http.StatusPartialContent))
+			Expect(res.Body.String()).Should(Equal("abcdefghij"))
+
+			get(handler, "/video.mp4", http.Header{"Range": {"bytes=0-1,10-11"}})
+			Expect(res.Code).Should(Equal(http.StatusPartialContent))
+			Expect(parts()).Should(Equal([]string{"ab", "ab"}))
+		})
+
+		It("should validate If-Range against the modification time", func() {
+			get(handler, "/video.mp4", http.Header{"Range": {"bytes=0-1"}, "If-Range": {modTime.Format(http.TimeFormat)}})
+			Expect(res.Code).Should(Equal(http.StatusPartialContent))
+
+			stale := modTime.Add(-time.Hour).Format(http.TimeFormat)
+			get(handler, "/video.mp4", http.Header{"Range": {"bytes=0-1"}, "If-Range": {stale}})
+			Expect(res.Code).Should(Equal(http.StatusOK))
+		})
+
+		It("should validate If-Range against the entity tag", func() {
+			get(handler, "/video.mp4", nil)
+			etag := res.Header().Get("ETag")
+			Expect(etag).ShouldNot(HavePrefix("W/"))
+
+			get(handler, "/video.mp4", http.Header{"Range": {"bytes=0-1"}, "If-Range": {etag}})
+			Expect(res.Code).Should(Equal(http.StatusPartialContent))
+			Expect(res.Body.String()).Should(Equal("ab"))
+
+			get(handler, "/video.mp4", http.Header{"Range": {"bytes=0-1"}, "If-Range": {`"stale"`}})
+			Expect(res.Code).Should(Equal(http.StatusOK))
+		})
+	})
+})
@@ -0,0 +1,117 @@
+package static
+
+import (
+	"github.com/pkg/errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkPolicy decides which symbolic links in root are followed
+type SymlinkPolicy int
+
+// Symlink policies of a static file server
+const (
+	SymlinkWithinRoot SymlinkPolicy = iota // Follows symbolic links that resolve to a path within root
+	SymlinkDeny                            // Refuses paths that go through a symbolic link
+	SymlinkAllow                           // Follows every symbolic link
+)
+
+// errDirNotAllowed is returned for files in directories that are not allowed access
+var errDirNotAllowed = errors.New("directory access not allowed")
+
+// notExist returns the error of a path that is hidden from clients, so that its existence is not revealed
+func notExist(name string) error {
+	return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// dirAllowed checks whether files of a directory may be served
+func (sfs *staticFileServer) dirAllowed(dir string) bool {
+	if sfs.allowAll || dir == "." {
+		return true
+	}
+
+	for _, allowedDir := range sfs.allowedDirs {
+		if dir == allowedDir || strings.HasPrefix(dir, allowedDir+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isHidden checks whether a file or directory name is hidden
+func (sfs *staticFileServer) isHidden(name string) bool {
+	return !sfs.showHidden && strings.HasPrefix(name, ".")
+}
+
+// resolve returns the name relative to root of the file a URL path or file path refers to.
+// Hidden and denied paths and paths that resolve outside root fail with a not exist error, existing files in directories
+// that are not allowed fail with errDirNotAllowed
+func (sfs *staticFileServer) resolve(fpath string) (string, error) {
+	if strings.ContainsRune(fpath, 0) {
+		return "", notExist(fpath)
+	}
+
+	// the cleaned name is rooted, so dot dot elements never leave root
+	name := fsName(fpath)
+	if !fs.ValidPath(name) {
+		return "", notExist(fpath)
+	}
+
+	if name != "." {
+		for _, elem := range strings.Split(name, "/") {
+			if sfs.isHidden(elem) {
+				return "", notExist(name)
+			}
+		}
+	}
+
+	for _, pattern := range sfs.denyPatterns {
+		if matchPattern(pattern, "/"+name) {
+			return "", notExist(name)
+		}
+	}
+
+	if !sfs.dirAllowed(path.Dir(name)) {
+		// paths that do not exist are not found like in allowed directories, so that fallbacks still apply
+		if _, err := fs.Stat(sfs.fsys, name); err != nil {
+			return "", notExist(name)
+		}
+		return "", errDirNotAllowed
+	}
+
+	// only the OS filesystem has symbolic links
+	if sfs.rootDir == "" || sfs.symlinks == SymlinkAllow {
+		return name, nil
+	}
+
+	resolved, err := filepath.EvalSymlinks(filepath.Join(sfs.absRoot, filepath.FromSlash(name)))
+	if err != nil {
+		return "", err
+	}
+
+	switch sfs.symlinks {
+	case SymlinkDeny:
+		// any link on the way changes the resolved path
+		if resolved != filepath.Join(sfs.realRoot, filepath.FromSlash(name)) {
+			return "", notExist(name)
+		}
+	default:
+		if !withinDir(resolved, sfs.realRoot) {
+			return "", notExist(name)
+		}
+	}
+
+	return name, nil
+}
+
+// withinDir checks whether a file path is dir or inside it
+func withinDir(fpath, dir string) bool {
+	rel, err := filepath.Rel(dir, fpath)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,78 @@
+package static
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// FuzzResolve checks that no request path resolves to, or serves, a file outside root or a hidden file
+func FuzzResolve(f *testing.F) {
+	dir, err := ioutil.TempDir("", "static")
+	if err != nil {
+		f.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root, err := newResolveRoot(dir)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	sfs, err := newStaticFileServer(&ServerOptions{RootDir: root, FallBackIndex: true})
+	if err != nil {
+		f.Fatal(err)
+	}
+	defer sfs.Close()
+
+	seeds := []string{
+		"/js/app.js",
+		"/app.js",
+		"/leak.txt",
+		"/outdir/secret.txt",
+		"/.env",
+		"/../outside/secret.txt",
+		"/js/../../outside/secret.txt",
+		"..\\outside\\secret.txt",
+		"/js/%2e%2e/%2e%2e/outside/secret.txt",
+		"//outside/secret.txt",
+		"/js/./app.js",
+		"/.\x00/.env",
+		"",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, upath string) {
+		name, err := sfs.resolve(upath)
+		if err == nil {
+			if strings.Contains("/"+name+"/", "/../") {
+				t.Fatalf("%q resolved to %q which leaves root", upath, name)
+			}
+			for _, elem := range strings.Split(name, "/") {
+				if strings.HasPrefix(elem, ".") && name != "." {
+					t.Fatalf("%q resolved to hidden %q", upath, name)
+				}
+			}
+			resolved, err := filepath.EvalSymlinks(filepath.Join(sfs.absRoot, filepath.FromSlash(name)))
+			if err == nil && !withinDir(resolved, sfs.realRoot) {
+				t.Fatalf("%q resolved to %q outside root", upath, resolved)
+			}
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = upath
+		res := httptest.NewRecorder()
+		sfs.ServeHTTP(res, req)
+
+		body := res.Body.String()
+		if strings.Contains(body, "outside secret") || strings.Contains(body, "TOKEN=secret") {
+			t.Fatalf("%q served a file that is not in root or hidden: %q", upath, body)
+		}
+	})
+}
@@ -0,0 +1,188 @@
+package static
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+)
+
+// newResolveRoot creates a root directory with hidden files and symbolic links within and out of root,
+// next to a directory with a secret file. It returns the root directory
+func newResolveRoot(dir string) (string, error) {
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+
+	files := map[string]string{
+		filepath.Join(root, "index.html"):       "<html>index</html>",
+		filepath.Join(root, ".env"):             "TOKEN=secret",
+		filepath.Join(root, "js", "app.js"):     "console.log('app')",
+		filepath.Join(root, "js", "app.js.map"): "{}",
+		filepath.Join(outside, "secret.txt"):    "outside secret",
+	}
+	for name, content := range files {
+		err := os.MkdirAll(filepath.Dir(name), 0755)
+		if err != nil {
+			return "", err
+		}
+		err = ioutil.WriteFile(name, []byte(content), 0644)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	links := map[string]string{
+		filepath.Join(root, "app.js"):   filepath.Join("js", "app.js"),
+		filepath.Join(root, "leak.txt"): filepath.Join("..", "outside", "secret.txt"),
+		filepath.Join(root, "outdir"):   outside,
+	}
+	for name, target := range links {
+		err := os.Symlink(target, name)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return root, nil
+}
+
+var _ = Describe("Resolving paths in root", func() {
+	var (
+		res  *httptest.ResponseRecorder
+		dir  string
+		root string
+	)
+
+	get := func(handler http.Handler, path string) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = path
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "static")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		root, err = newResolveRoot(dir)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Context("With the default policy", func() {
+		It("should follow symbolic links within root only", func() {
+			handler, err := NewHandler(&ServerOptions{RootDir: root})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			get(handler, "/app.js")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("console.log('app')"))
+
+			for _, path := range []string{"/leak.txt", "/outdir/secret.txt", "/../outside/secret.txt", "/js/../../outside/secret.txt"} {
+				get(handler, path)
+				Expect(res.Code).Should(Equal(http.StatusNotFound), path)
+				Expect(res.Body.String()).ShouldNot(ContainSubstring("outside secret"), path)
+			}
+		})
+
+		It("should hide dotfiles", func() {
+			handler, err := NewHandler(&ServerOptions{RootDir: root})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			get(handler, "/.env")
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+
+			handler, err = NewHandler(&ServerOptions{RootDir: root, ShowHiddenFiles: true})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			get(handler, "/.env")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+		})
+
+		It("should not serve denied paths", func() {
+			handler, err := NewHandler(&ServerOptions{RootDir: root, DenyPatterns: []string{"*.map"}})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			get(handler, "/js/app.js.map")
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+
+			get(handler, "/js/app.js")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+		})
+
+		It("should check directories created after the server started against allowed directories", func() {
+			handler, err := NewHandler(&ServerOptions{RootDir: root, AllowedDirs: []string{"js"}})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(os.MkdirAll(filepath.Join(root, "later"), 0755)).Should(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(root, "later", "file.txt"), []byte("later"), 0644)).Should(Succeed())
+
+			get(handler, "/later/file.txt")
+			Expect(res.Code).Should(Equal(http.StatusInternalServerError))
+			Expect(res.Body.String()).ShouldNot(ContainSubstring("later"))
+
+			get(handler, "/js/app.js")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+		})
+	})
+
+	Context("With allowed directories and a fallback", func() {
+		It("should fall back or reply with 404 for missing paths outside allowed directories", func() {
+			handler, err := NewHandler(&ServerOptions{
+				RootDir:       root,
+				AllowedDirs:   []string{"js", "css"},
+				FallBackIndex: true,
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			get(handler, "/users/42")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("<html>index</html>"))
+
+			get(handler, "/img/missing.png")
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+
+			get(handler, "/css/missing.css")
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+		})
+
+		It("should not reveal the allowed directories when refusing existing files", func() {
+			Expect(os.MkdirAll(filepath.Join(root, "private"), 0755)).Should(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(root, "private", "notes.txt"), []byte("notes"), 0644)).Should(Succeed())
+
+			handler, err := NewHandler(&ServerOptions{RootDir: root, AllowedDirs: []string{"js"}, FallBackIndex: true})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			get(handler, "/private/notes.txt")
+			Expect(res.Code).Should(Equal(http.StatusInternalServerError))
+			Expect(res.Body.String()).ShouldNot(ContainSubstring("director"))
+		})
+	})
+
+	Context("With other symbolic link policies", func() {
+		It("should refuse every symbolic link when denied", func() {
+			handler, err := NewHandler(&ServerOptions{RootDir: root, Symlinks: SymlinkDeny})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			get(handler, "/app.js")
+			Expect(res.Code).Should(Equal(http.StatusNotFound))
+
+			get(handler, "/js/app.js")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+		})
+
+		It("should follow every symbolic link when allowed", func() {
+			handler, err := NewHandler(&ServerOptions{RootDir: root, Symlinks: SymlinkAllow})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			get(handler, "/leak.txt")
+			Expect(res.Code).Should(Equal(http.StatusOK))
+			Expect(res.Body.String()).Should(Equal("outside secret"))
+		})
+	})
+})
@@ -0,0 +1,226 @@
+package static
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NoncePlaceholder is replaced in the Content-Security-Policy header with a nonce that is unique to each response
+const NoncePlaceholder = "{nonce}"
+
+// scriptTagPattern matches the start of script tags
+var scriptTagPattern = regexp.MustCompile(`(?i)<script\b`)
+
+// SecurityHeaders contains security related response headers. Headers with empty values are not set.
+// In overrides, the value "-" removes a header set by the defaults
+type SecurityHeaders struct {
+	// ContentSecurityPolicy may contain NoncePlaceholder, as in script-src 'nonce-{nonce}'. The nonce is then added to script tags of HTML pages
+	ContentSecurityPolicy     string
+	StrictTransportSecurity   string
+	ContentTypeOptions        string // X-Content-Type-Options
+	ReferrerPolicy            string
+	PermissionsPolicy         string
+	CrossOriginResourcePolicy string
+	CrossOriginEmbedderPolicy string
+	CrossOriginOpenerPolicy   string
+}
+
+// SecurityHeaderRule overrides security headers for URL paths matching a pattern
+type SecurityHeaderRule struct {
+	Pattern string
+	Headers SecurityHeaders
+}
+
+// DefaultSecurityHeaders returns a set of security headers suitable for most single page applications.
+// It has no Content-Security-Policy since the policy depends on the application
+func DefaultSecurityHeaders() *SecurityHeaders {
+	return &SecurityHeaders{
+		StrictTransportSecurity:   "max-age=63072000; includeSubDomains",
+		ContentTypeOptions:        "nosniff",
+		ReferrerPolicy:            "strict-origin-when-cross-origin",
+		CrossOriginResourcePolicy: "same-origin",
+	}
+}
+
+// fields returns the header names and values of the headers
+func (sh *SecurityHeaders) fields() [][2]string {
+	return [][2]string{
+		{"Content-Security-Policy", sh.ContentSecurityPolicy},
+		{"Strict-Transport-Security", sh.StrictTransportSecurity},
+		{"X-Content-Type-Options", sh.ContentTypeOptions},
+		{"Referrer-Policy", sh.ReferrerPolicy},
+		{"Permissions-Policy", sh.PermissionsPolicy},
+		{"Cross-Origin-Resource-Policy", sh.CrossOriginResourcePolicy},
+		{"Cross-Origin-Embedder-Policy", sh.CrossOriginEmbedderPolicy},
+		{"Cross-Origin-Opener-Policy", sh.CrossOriginOpenerPolicy},
+	}
+}
+
+// securityHeaders is a resolved set of headers
+type securityHeaders struct {
+	header [][2]string
+	nonce  bool // the policy has a nonce placeholder
+}
+
+// newSecurityHeaders resolves overrides on top of defaults
+func newSecurityHeaders(defaults, override *SecurityHeaders) *securityHeaders {
+	sh := &securityHeaders{
+		header: make([][2]string, 0),
+	}
+
+	var overrides [][2]string
+	if override != nil {
+		overrides = override.fields()
+	}
+
+	for i, field := range defaults.fields() {
+		value := field[1]
+		if overrides != nil && overrides[i][1] != "" {
+			value = overrides[i][1]
+		}
+		if value == "" || value == "-" {
+			continue
+		}
+		sh.header = append(sh.header, [2]string{field[0], value})
+		if strings.Contains(value, NoncePlaceholder) {
+			sh.nonce = true
+		}
+	}
+
+	return sh
+}
+
+// securityRule is a compiled SecurityHeaderRule
+type securityRule struct {
+	pattern string
+	headers *securityHeaders
+}
+
+// securityPolicy finds the security headers of URL paths
+type securityPolicy struct {
+	defaults *securityHeaders
+	rules    []*securityRule
+	nonce    bool // any of the headers has a nonce placeholder
+}
+
+func newSecurityPolicy(defaults *SecurityHeaders, rules []SecurityHeaderRule) *securityPolicy {
+	if defaults == nil {
+		defaults = &SecurityHeaders{}
+	}
+
+	sp := &securityPolicy{
+		defaults: newSecurityHeaders(defaults, nil),
+		rules:    make([]*securityRule, 0, len(rules)),
+	}
+	sp.nonce = sp.defaults.nonce
+
+	for _, rule := range rules {
+		pattern, _ := cleanPattern(rule.Pattern)
+		override := rule.Headers
+		headers := newSecurityHeaders(defaults, &override)
+		sp.rules = append(sp.rules, &securityRule{pattern: pattern, headers: headers})
+		sp.nonce = sp.nonce || headers.nonce
+	}
+
+	return sp
+}
+
+// headers returns the security headers of a URL path, the first matching rule wins
+func (sp *securityPolicy) headers(upath string) *securityHeaders {
+	for _, rule := range sp.rules {
+		if matchPattern(rule.pattern, upath) {
+			return rule.headers
+		}
+	}
+	return sp.defaults
+}
+
+type nonceKey struct{}
+
+// Nonce returns the Content-Security-Policy nonce of the response to a request, or an empty string when there is none.
+// Custom NotFound handlers can use it for script tags of the pages they write
+func Nonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(nonceKey{}).(string)
+	return nonce
+}
+
+// newNonce returns a random base64 encoded nonce
+func newNonce() (string, error) {
+	bs := make([]byte, 16)
+	_, err := rand.Read(bs)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(bs), nil
+}
+
+// setSecurityHeaders sets the security headers of a URL path. When the policy has a nonce,
+// the returned request carries it for use in the page
+func (sfs *staticFileServer) setSecurityHeaders(w http.ResponseWriter, r *http.Request, upath string) (*http.Request, error) {
+	sh := sfs.security.headers(upath)
+
+	var nonce string
+	if sh.nonce {
+		var err error
+		nonce, err = newNonce()
+		if err != nil {
+			return r, err
+		}
+		r = r.WithContext(context.WithValue(r.Context(), nonceKey{}, nonce))
+	}
+
+	for _, field := range sh.header {
+		value := field[1]
+		if nonce != "" {
+			value = strings.Replace(value, NoncePlaceholder, nonce, -1)
+		}
+		w.Header().Set(field[0], value)
+	}
+
+	return r, nil
+}
+
+// scriptTagOffsets returns the offsets in an HTML page just after the name of its script tags
+func scriptTagOffsets(data []byte) []int {
+	matches := scriptTagPattern.FindAllIndex(data, -1)
+	offsets := make([]int, 0, len(matches))
+	for _, match := range matches {
+		offsets = append(offsets, match[1])
+	}
+	return offsets
+}
+
+// writeNonced writes a cached HTML page with the nonce added to its script tags.
+// The page differs for every response, so it is neither validated nor stored by caches
+func (sfs *staticFileServer) writeNonced(w http.ResponseWriter, r *http.Request, sfile *staticFile, nonce string) {
+	attr := []byte(` nonce="` + nonce + `"`)
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(sfile.data)+len(sfile.scripts)*len(attr)))
+	start := 0
+	for _, offset := range sfile.scripts {
+		buf.Write(sfile.data[start:offset])
+		buf.Write(attr)
+		start = offset
+	}
+	buf.Write(sfile.data[start:])
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", sfile.ctype)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	_, err := w.Write(buf.Bytes())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+}
@@ -0,0 +1,125 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing/fstest"
+)
+
+var _ = Describe("Security headers", func() {
+	var res *httptest.ResponseRecorder
+
+	get := func(handler http.Handler, method, path string) {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Accept", "text/html")
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+	}
+
+	nonceAttr := regexp.MustCompile(`nonce="([^"]+)"`)
+
+	files := fstest.MapFS{
+		"index.html":   {Data: []byte(`<html><head><script src="/app.js"></script><SCRIPT>boot()</SCRIPT></head></html>`)},
+		"app.js":       {Data: []byte("console.log('app')")},
+		"embed/widget": {Data: []byte("<html><script>widget()</script></html>")},
+	}
+
+	handler, err := NewHandler(&ServerOptions{
+		FS:            files,
+		FallBackIndex: true,
+		SecurityHeaders: &SecurityHeaders{
+			ContentSecurityPolicy:     "script-src 'self' 'nonce-{nonce}'",
+			StrictTransportSecurity:   "max-age=63072000",
+			ContentTypeOptions:        "nosniff",
+			ReferrerPolicy:            "no-referrer",
+			PermissionsPolicy:         "camera=()",
+			CrossOriginResourcePolicy: "same-origin",
+			CrossOriginEmbedderPolicy: "require-corp",
+		},
+		SecurityHeaderRules: []SecurityHeaderRule{
+			{Pattern: "/embed/*", Headers: SecurityHeaders{
+				ContentSecurityPolicy:     "frame-ancestors *",
+				CrossOriginResourcePolicy: "cross-origin",
+				CrossOriginEmbedderPolicy: "-",
+			}},
+		},
+	})
+
+	It("should setup handler without an error", func() {
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	It("should set the configured headers on every response", func() {
+		for _, path := range []string{"/app.js", "/missing.png"} {
+			get(handler, http.MethodGet, path)
+			Expect(res.Header().Get("Strict-Transport-Security")).Should(Equal("max-age=63072000"), path)
+			Expect(res.Header().Get("X-Content-Type-Options")).Should(Equal("nosniff"), path)
+			Expect(res.Header().Get("Referrer-Policy")).Should(Equal("no-referrer"), path)
+			Expect(res.Header().Get("Permissions-Policy")).Should(Equal("camera=()"), path)
+			Expect(res.Header().Get("Cross-Origin-Resource-Policy")).Should(Equal("same-origin"), path)
+			Expect(res.Header().Get("Cross-Origin-Embedder-Policy")).Should(Equal("require-corp"), path)
+		}
+	})
+
+	It("should add the nonce of the policy to script tags of the index page", func() {
+		get(handler, http.MethodGet, "/")
+		Expect(res.Code).Should(Equal(http.StatusOK))
+
+		matches := nonceAttr.FindAllStringSubmatch(res.Body.String(), -1)
+		Expect(matches).Should(HaveLen(2))
+		nonce := matches[0][1]
+		Expect(matches[1][1]).Should(Equal(nonce))
+		Expect(res.Header().Get("Content-Security-Policy")).Should(Equal("script-src 'self' 'nonce-" + nonce + "'"))
+		Expect(res.Body.String()).Should(ContainSubstring(`<script nonce="` + nonce + `" src="/app.js">`))
+		Expect(res.Body.String()).Should(ContainSubstring(`<SCRIPT nonce="` + nonce + `">`))
+
+		// pages with a nonce are not cached or validated
+		Expect(res.Header().Get("Cache-Control")).Should(Equal("no-store"))
+		Expect(res.Header().Get("ETag")).Should(BeEmpty())
+	})
+
+	It("should use a new nonce for every response", func() {
+		get(handler, http.MethodGet, "/")
+		first := nonceAttr.FindStringSubmatch(res.Body.String())[1]
+
+		get(handler, http.MethodGet, "/users/1")
+		Expect(res.Code).Should(Equal(http.StatusOK))
+		second := nonceAttr.FindStringSubmatch(res.Body.String())[1]
+		Expect(second).ShouldNot(Equal(first))
+		Expect(res.Header().Get("Content-Security-Policy")).Should(ContainSubstring(second))
+	})
+
+	It("should leave the cached index page unchanged", func() {
+		get(handler, http.MethodGet, "/")
+		get(handler, http.MethodGet, "/")
+		Expect(nonceAttr.FindAllString(res.Body.String(), -1)).Should(HaveLen(2))
+	})
+
+	It("should reply to HEAD requests without the page", func() {
+		get(handler, http.MethodHead, "/")
+		Expect(res.Code).Should(Equal(http.StatusOK))
+		Expect(res.Header().Get("Content-Length")).ShouldNot(BeEmpty())
+		Expect(res.Body.Len()).Should(BeZero())
+	})
+
+	It("should override headers for matching paths", func() {
+		get(handler, http.MethodGet, "/embed/widget")
+		Expect(res.Header().Get("Content-Security-Policy")).Should(Equal("frame-ancestors *"))
+		Expect(res.Header().Get("Cross-Origin-Resource-Policy")).Should(Equal("cross-origin"))
+		Expect(res.Header().Get("Cross-Origin-Embedder-Policy")).Should(BeEmpty())
+		Expect(res.Header().Get("X-Content-Type-Options")).Should(Equal("nosniff"))
+		Expect(res.Body.String()).ShouldNot(ContainSubstring("nonce"))
+	})
+
+	It("should set no headers by default", func() {
+		handler, err := NewHandler(&ServerOptions{FS: files})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		get(handler, http.MethodGet, "/")
+		Expect(res.Header().Get("Content-Security-Policy")).Should(BeEmpty())
+		Expect(res.Header().Get("X-Content-Type-Options")).Should(BeEmpty())
+		Expect(res.Header().Get("ETag")).ShouldNot(BeEmpty())
+		Expect(res.Body.String()).ShouldNot(ContainSubstring("nonce"))
+	})
+})
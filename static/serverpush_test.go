@@ -59,7 +59,7 @@ var _ = Describe("Server push with custom notFoundhandler", func() {
 
 	Context("Sending Request", func() {
 		It("should push resources to the user", func() {
-			url := server.URL() + "/"
+			url := server.URL() + "/app/"
 			req := httptest.NewRequest(http.MethodGet, url, nil)
 			Expect(req).ShouldNot(BeNil())
 
@@ -1,69 +1,177 @@
-// Package static is a secure and fast static file server with support for http2 server push.
+// Package static is a secure and fast static file server with support for http2 server push and preload hints.
 // It caches static files in memory so that subsequent requests for the static file will retrieve the file from memory making it very fast than calling os primitives to open and read the files data.
 // It can serve single page applications (SPAs) with an improved performance because of path caching on paths resulting to 404.
 // The API also allows customization of NotFound handler.
 package static
 
 import (
+	"bytes"
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/fsnotify/fsnotify"
 	"github.com/pkg/errors"
+	"io"
+	"io/fs"
 	"io/ioutil"
-	"mime"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
+// allowedMethods is the Allow header of responses to methods other than GET and HEAD
+const allowedMethods = "GET, HEAD, OPTIONS"
+
 // staticFile contains cached data for a static file to be used for writing to http response
 type staticFile struct {
-	data  []byte      // file data
-	finfo os.FileInfo // file info
-	ctype string      // file content type
-}
-
-// pushOptions contains server push information used for http2 server push
-type pushOptions struct {
-	path      string
-	strict    bool
-	pushFiles []string
+	data    []byte            // file data
+	finfo   os.FileInfo       // file info
+	ctype   string            // file content type
+	encoded map[string][]byte // file data in content encodings, keyed by encoding
+	etag    string            // strong entity tag of file data
+	path    string            // path of the file on disk when its data is streamed instead of cached
+	scripts []int             // offsets of the script tags of HTML pages that are given a nonce
 }
 
-func (po *pushOptions) Key() string {
-	return po.path
+// size returns the number of bytes of memory held by the file data
+func (sf *staticFile) size() int64 {
+	size := int64(len(sf.data))
+	for _, bs := range sf.encoded {
+		size += int64(len(bs))
+	}
+	return size
 }
 
 // staticFileServer contains cached data and options to customize the static file server
 type staticFileServer struct {
-	rootDir         string
-	indexPage       string
+	fsys            fs.FS  // files served, names are slash separated and relative to root
+	rootDir         string // root directory on the OS filesystem, empty when serving from ServerOptions.FS
+	indexPage       string // URL path of the index page, which is also the key it is cached under
+	urlPrefix       string // URL path the server is mounted at, "/" when mounted at the root
+	redirectOut     bool
 	allowedDirs     []string
-	staticDirs      map[string]struct{}
+	absRoot         string // absolute path of rootDir
+	realRoot        string // absolute path of rootDir with symbolic links resolved
+	symlinks        SymlinkPolicy
+	denyPatterns    []string
 	allowAll        bool
+	compression     bool
+	cachePolicy     *CachePolicy
 	pushSupport     bool
+	earlyHints      bool
 	pushOptions     *http.PushOptions
-	mu              *sync.RWMutex // guards files
-	files           map[string]*staticFile
-	pushContent     map[string]*pushOptions
-	notFoundPaths   map[string]int8
+	mu              *sync.RWMutex // guards files, notFoundPaths and generation
+	files           *fileCache
+	generation      uint64 // bumped whenever cached files are invalidated
+	maxFileSize     int64
+	pushRules       *pushTable
+	notFoundPaths   *notFoundCache
 	notFoundHandler http.Handler
+	fallbackIndex   bool
+	fallbackPaths   []string
+	fallbackDocs    []*fallbackRoute
+	listing         bool
+	listingPageSize int
+	showHidden      bool
+	security        *securityPolicy
+	serviceWorkers  []string
+	swAllowed       string
+	runtimeConfig   *runtimeConfig
+	watcher         *fsnotify.Watcher
+	done            chan struct{}
+	closeOnce       *sync.Once
 }
 
 // ServerOptions contains options for configuring static file server
 type ServerOptions struct {
-	RootDir         string       // Root directory
-	Index           string       // Index file relative to root
-	AllowedDirs     []string     // List of directories in root that is allowed access, by default all directories are allowed access
-	NotFoundHandler http.Handler // NotFound custom handler
-	URLPathPrefix   string
+	FS              fs.FS               // Filesystem to serve files from such as embed.FS or zip.Reader, RootDir is then a directory in FS
+	RootDir         string              // Root directory
+	Index           string              // Index file relative to root
+	AllowedDirs     []string            // List of directories in root that is allowed access, by default all directories are allowed access
+	NotFoundHandler http.Handler        // NotFound custom handler
+	URLPathPrefix   string              // URL path the server is mounted at, the prefix is stripped from request paths
 	PushContent     map[string][]string // Map of url path to push files
-	FallBackIndex   bool                // Replies with index page for 404 pages
+	PushRules       []PushRule          // Push rules with patterns, exclusions and request conditions, checked after PushContent
+	FallBackIndex   bool                // Replies with index page for 404 navigation requests
+	// EarlyHints sends the preload Link headers of push files in a 103 Early Hints response before the final response
+	EarlyHints bool
+	// PreloadIndex adds the local scripts and stylesheets referenced by the index page to its push files
+	PreloadIndex bool
+	// FallBackRoutes are patterns of missing paths that fall back whatever their extension or Accept header
+	FallBackRoutes []string
+	// FallBackDocuments maps patterns of missing paths to the document that is served for them instead of the index page
+	FallBackDocuments map[string]string
+	// DirectoryListing replies to requests for allowed directories with a listing of their entries in HTML or JSON
+	DirectoryListing bool
+	// ListingPageSize is the default number of entries in a page of a directory listing. Defaults to 100
+	ListingPageSize int
+	// ShowHiddenFiles serves and lists files and directories whose name starts with a dot, which are hidden by default
+	ShowHiddenFiles bool
+	// DenyPatterns are patterns of URL paths relative to URLPathPrefix that are never served, such as *.map or /private/*
+	DenyPatterns []string
+	// Symlinks is the policy of following symbolic links in RootDir. Defaults to following links that resolve within root
+	Symlinks SymlinkPolicy
+	// RedirectToPrefix redirects requests outside URLPathPrefix to the same path within it instead of replying with 404
+	RedirectToPrefix bool
+	// SecurityHeaders are security headers set on every response, DefaultSecurityHeaders returns a recommended set
+	SecurityHeaders *SecurityHeaders
+	// SecurityHeaderRules override security headers for URL paths relative to URLPathPrefix, the first matching rule applies
+	SecurityHeaderRules []SecurityHeaderRule
+	// RuntimeConfig is injected into the index page as a window.__ENV__ script and replaces %KEY% placeholders in it
+	RuntimeConfig map[string]string
+	// RuntimeConfigPrefix adds environment variables whose name starts with the prefix to RuntimeConfig.
+	// The environment is read whenever the index page is cached, such as after Reload
+	RuntimeConfigPrefix string
+	// RuntimeConfigVar is the name of the global variable of the runtime config. Defaults to __ENV__
+	RuntimeConfigVar string
+	// ServiceWorkers are patterns of service worker scripts, which are always revalidated. Defaults to service-worker.js and sw.js
+	ServiceWorkers []string
+	// ServiceWorkerAllowed sets the Service-Worker-Allowed header of service workers to widen their maximum scope
+	ServiceWorkerAllowed string
+	// ValidatePrecache fails creation of the server with a PrecacheError when URLs listed in precache manifests
+	// or service workers have no file in root
+	ValidatePrecache bool
+	// PrecacheManifests are patterns of precache manifests in root. Defaults to precache-manifest.*.js
+	PrecacheManifests []string
+	// Preload are patterns of URL paths relative to URLPathPrefix of files that are cached when the server is created,
+	// /* preloads the whole tree. Files beyond MaxCacheSize evict the least recently preloaded files
+	Preload []string
+	// PreloadWorkers is the number of files read in parallel when preloading. Defaults to the number of CPUs
+	PreloadWorkers int
+	// DisableCompression disables serving of precompressed .br and .gz sibling files and on the fly compression
+	DisableCompression bool
+	// CachePolicy sets Cache-Control headers of files. Unset fields of the policy use defaults
+	CachePolicy *CachePolicy
+	// Watch invalidates cached files and 404 paths when files in root change
+	Watch bool
+	// RevalidateInterval periodically checks cached files against their modification time. It is used when watching is disabled or not available
+	RevalidateInterval time.Duration
+	// MaxCacheSize is the memory budget in bytes of cached files. Least recently used files are evicted to stay within it. Defaults to 64mb
+	MaxCacheSize int64
+	// MaxCacheFileSize is the size in bytes above which files are streamed from disk instead of cached. Defaults to 4mb
+	MaxCacheFileSize int64
+	// MaxNotFoundPaths is the number of paths resulting to 404 that are remembered. Defaults to 1024
+	MaxNotFoundPaths int
+	// NotFoundTTL is how long a path resulting to 404 is remembered. Defaults to 5 minutes
+	NotFoundTTL time.Duration
 }
 
 // NewHandler creates a static file server for the given rootDir directory.
 // It caches the file in memory so that subsequent calls only write the files data to response
 func NewHandler(opt *ServerOptions) (http.Handler, error) {
+	sfs, err := newStaticFileServer(opt)
+	if err != nil {
+		return nil, err
+	}
+	return sfs, nil
+}
+
+func newStaticFileServer(opt *ServerOptions) (*staticFileServer, error) {
 	if opt.RootDir == "" {
 		// set rootDir to current directory
 		opt.RootDir = "."
@@ -73,7 +181,7 @@ func NewHandler(opt *ServerOptions) (http.Handler, error) {
 	opt.RootDir = filepath.Clean(opt.RootDir)
 
 	// clean and update URLPathPrefix
-	opt.URLPathPrefix = "/" + strings.TrimPrefix(filepath.Clean(opt.URLPathPrefix), "/")
+	opt.URLPathPrefix = path.Clean("/" + opt.URLPathPrefix)
 
 	if opt.Index == "" {
 		opt.Index = "./index.html"
@@ -87,46 +195,77 @@ func NewHandler(opt *ServerOptions) (http.Handler, error) {
 		opt.NotFoundHandler = http.NotFoundHandler()
 	}
 
-	if opt.FallBackIndex {
-		path := filepath.Join(opt.RootDir, opt.Index)
-		opt.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			http.ServeFile(w, r, path)
-		})
+	if opt.MaxCacheSize <= 0 {
+		opt.MaxCacheSize = defaultMaxCacheSize
+	}
+
+	if opt.MaxCacheFileSize <= 0 {
+		opt.MaxCacheFileSize = defaultMaxCacheFileSize
+	}
+
+	if opt.MaxNotFoundPaths <= 0 {
+		opt.MaxNotFoundPaths = defaultMaxNotFoundPaths
+	}
+
+	if opt.NotFoundTTL <= 0 {
+		opt.NotFoundTTL = defaultNotFoundTTL
+	}
+
+	if opt.ListingPageSize <= 0 {
+		opt.ListingPageSize = defaultListingPageSize
+	}
+
+	if opt.ServiceWorkers == nil {
+		opt.ServiceWorkers = defaultServiceWorkers
+	}
+
+	// files are read through a filesystem rooted at root directory
+	var (
+		fsys    fs.FS
+		rootDir string
+	)
+	if opt.FS != nil {
+		sub, err := fs.Sub(opt.FS, fsName(opt.RootDir))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open root directory")
+		}
+		fsys = sub
+	} else {
+		rootDir = opt.RootDir
+		fsys = os.DirFS(rootDir)
 	}
 
 	// allowed direcories
 	allowedDirs := make([]string, 0, len(opt.AllowedDirs))
 	for _, dir := range opt.AllowedDirs {
-		dir := filepath.Join(opt.RootDir, dir)
-		if dir == opt.Index {
+		dir := fsName(dir)
+		if dir == fsName(opt.Index) {
 			continue
 		}
 		allowedDirs = append(allowedDirs, dir)
 	}
 
-	staticDirs := make(map[string]struct{}, 0)
 	allowAll := len(allowedDirs) == 0
 
-	if !allowAll {
-		var readDir func(string) error
-		readDir = func(dir string) error {
-			fileInfos, err := ioutil.ReadDir(filepath.Clean(dir))
-			if err != nil {
-				return errors.Wrap(err, "failed to read directory")
-			}
-			for _, fileInfo := range fileInfos {
-				name := filepath.Join(dir, fileInfo.Name())
-				if fileInfo.IsDir() {
-					staticDirs[name] = struct{}{}
-					err = readDir(name)
-					if err != nil {
-						return err
-					}
-				}
-			}
-			return nil
+	// symbolic links are resolved against the real path of root
+	var absRoot, realRoot string
+	if rootDir != "" {
+		var err error
+		absRoot, err = filepath.Abs(rootDir)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to resolve root directory")
 		}
-		err := readDir(opt.RootDir)
+		realRoot, err = filepath.EvalSymlinks(absRoot)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to resolve root directory")
+		}
+	}
+
+	// the index page is given the runtime config when either source is set
+	var runtimeCfg *runtimeConfig
+	if len(opt.RuntimeConfig) > 0 || opt.RuntimeConfigPrefix != "" {
+		var err error
+		runtimeCfg, err = newRuntimeConfig(opt.RuntimeConfig, opt.RuntimeConfigPrefix, opt.RuntimeConfigVar)
 		if err != nil {
 			return nil, err
 		}
@@ -134,56 +273,143 @@ func NewHandler(opt *ServerOptions) (http.Handler, error) {
 
 	// create the server
 	sfs := &staticFileServer{
-		rootDir:       opt.RootDir,
-		indexPage:     opt.Index,
+		fsys:          fsys,
+		rootDir:       rootDir,
+		indexPage:     "/" + fsName(opt.Index),
+		urlPrefix:     opt.URLPathPrefix,
+		redirectOut:   opt.RedirectToPrefix,
 		allowedDirs:   allowedDirs,
-		staticDirs:    staticDirs,
+		absRoot:       absRoot,
+		realRoot:      realRoot,
+		symlinks:      opt.Symlinks,
+		denyPatterns:  opt.DenyPatterns,
 		allowAll:      allowAll,
+		compression:   !opt.DisableCompression,
+		cachePolicy:   opt.CachePolicy.withDefaults(),
+		security:      newSecurityPolicy(opt.SecurityHeaders, opt.SecurityHeaderRules),
+		runtimeConfig: runtimeCfg,
+		swAllowed:     opt.ServiceWorkerAllowed,
 		mu:            &sync.RWMutex{},
-		files:         make(map[string]*staticFile, 0),
-		pushContent:   make(map[string]*pushOptions, len(opt.PushContent)),
-		notFoundPaths: make(map[string]int8, 0),
+		files:         newFileCache(opt.MaxCacheSize),
+		maxFileSize:   opt.MaxCacheFileSize,
+		pushRules:     newPushTable(),
+		notFoundPaths: newNotFoundCache(opt.MaxNotFoundPaths, opt.NotFoundTTL),
 		pushOptions: &http.PushOptions{
 			Method: http.MethodGet,
 			Header: http.Header{
 				"pushed-from": []string{"api"},
 			},
 		},
-		pushSupport:     opt.PushContent != nil && len(opt.PushContent) > 0,
+		pushSupport:     len(opt.PushContent) > 0 || len(opt.PushRules) > 0 || opt.PreloadIndex,
+		earlyHints:      opt.EarlyHints,
 		notFoundHandler: opt.NotFoundHandler,
+		done:            make(chan struct{}),
+		closeOnce:       &sync.Once{},
 	}
 
-	if sfs.pushSupport {
-		for ppath, files := range opt.PushContent {
-			pushVal := &pushOptions{
-				strict:    !strings.HasSuffix(ppath, "*"),
-				path:      filepath.Clean(ppath), // removes any trailing /
-				pushFiles: make([]string, 0),
-			}
+	// push content entries are rules without conditions, added in a stable order
+	ppaths := make([]string, 0, len(opt.PushContent))
+	for ppath := range opt.PushContent {
+		ppaths = append(ppaths, ppath)
+	}
+	sort.Strings(ppaths)
+
+	pushRules := make([]PushRule, 0, len(ppaths)+len(opt.PushRules))
+	for _, ppath := range ppaths {
+		pushRules = append(pushRules, PushRule{Path: ppath, Files: opt.PushContent[ppath]})
+	}
+	pushRules = append(pushRules, opt.PushRules...)
 
-			for _, file := range files {
-				filePath := filepath.Clean(file)
-				pushVal.pushFiles = append(pushVal.pushFiles, filepath.Join(opt.URLPathPrefix, filePath))
+	for _, pushRule := range pushRules {
+		pushFiles := make([]string, 0, len(pushRule.Files))
+		for _, file := range pushRule.Files {
+			filePath := path.Clean("/" + file)
+			pushFiles = append(pushFiles, path.Join(opt.URLPathPrefix, filePath))
 
-				// add the file to static files
-				err := sfs.addStaticFile(filepath.Clean(filePath))
-				if err != nil {
-					return nil, err
-				}
+			// add the file to static files
+			_, err := sfs.addStaticFile(filePath)
+			if err != nil {
+				return nil, err
 			}
+		}
 
-			// update static file server pushContent map entry
-			sfs.pushContent[pushVal.Key()] = pushVal
+		rule := newPushRule(pushRule.Path, pushFiles)
+		rule.exclude = pushRule.Exclude
+		rule.headers = pushRule.Headers
+		if len(pushRule.Methods) > 0 {
+			rule.methods = make(map[string]struct{}, len(pushRule.Methods))
+			for _, method := range pushRule.Methods {
+				rule.methods[strings.ToUpper(method)] = struct{}{}
+			}
 		}
+
+		sfs.pushRules.add(rule)
+	}
+
+	if opt.PreloadIndex {
+		bs, err := fs.ReadFile(fsys, fsName(opt.Index))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read index page")
+		}
+
+		targets := indexPreloads(bs, opt.URLPathPrefix)
+		sfs.pushRules.merge("/", targets)
+		sfs.pushRules.merge("/"+fsName(opt.Index), targets)
+	}
+
+	// missing pages fall back to the index page or the document of their route
+	sfs.fallbackIndex = opt.FallBackIndex
+	sfs.fallbackPaths = opt.FallBackRoutes
+	sfs.fallbackDocs = newFallbackRoutes(opt.FallBackDocuments)
+
+	sfs.listing = opt.DirectoryListing
+	sfs.listingPageSize = opt.ListingPageSize
+	sfs.showHidden = opt.ShowHiddenFiles
+	sfs.serviceWorkers = opt.ServiceWorkers
+
+	if opt.ValidatePrecache {
+		err := sfs.validatePrecache(opt.PrecacheManifests)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(opt.Preload) > 0 {
+		err := sfs.preload(opt.Preload, opt.PreloadWorkers)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	watching := false
+	if opt.Watch {
+		err := sfs.watch()
+		if err != nil && opt.RevalidateInterval <= 0 {
+			return nil, errors.Wrap(err, "failed to watch root directory")
+		}
+		if err != nil {
+			logrus.Warnln("falling back to revalidation of static files: " + err.Error())
+		}
+		watching = err == nil
+	}
+
+	if !watching && opt.RevalidateInterval > 0 {
+		go sfs.revalidate(opt.RevalidateInterval)
 	}
 
 	return sfs, nil
 }
 
 func (sfs *staticFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Method must be get
-	if r.Method != http.MethodGet {
-		http.Error(w, "METHOD_NOT_ALLOWED", http.StatusBadRequest)
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodOptions:
+		w.Header().Set("Allow", allowedMethods)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", allowedMethods)
+		http.Error(w, "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -194,30 +420,58 @@ func (sfs *staticFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		r.URL.Path = fpath
 	}
 
+	// paths are served relative to the URL path prefix
+	fpath, ok := sfs.stripPrefix(w, r, fpath)
+	if !ok {
+		return
+	}
+	upath := fpath
+
+	// security headers apply to every response of the path, including 404 and listings
+	r, err := sfs.setSecurityHeaders(w, r, upath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// update to render index page
 	if fpath == "/" || fpath == "" || fpath == "/." {
 		fpath = sfs.indexPage
 	}
 
 	// Check if file name exist in map
-	_, ok := sfs.getStaticFile(fpath)
+	sfile, ok := sfs.getStaticFile(fpath)
 	if !ok {
-		// pushes content to the client and serve index page
-		pushAndServe := func() {
-			sfs.serverPush(w, sfs.indexPage)
-			sfs.notFoundHandler.ServeHTTP(w, r)
-		}
-
-		// check if the path is in notFoundPaths so that we serve index page
-		if _, ok := sfs.notFoundPaths[fpath]; ok {
-			pushAndServe()
+		// check if the path is in notFoundPaths so that we skip reading it
+		if sfs.isNotFoundPath(fpath) {
+			sfs.serveNotFound(w, r, upath)
 			return
 		}
 
-		err := sfs.addStaticFile(fpath)
+		sfile, err = sfs.addStaticFile(fpath)
 		if os.IsNotExist(err) {
+			// the root directory is listed when it has no index page
+			if sfs.listing && upath == "/" {
+				sfs.serveListing(w, r, upath, ".")
+				return
+			}
 			sfs.addNotFoundPath(fpath)
-			pushAndServe()
+			sfs.serveNotFound(w, r, upath)
+			return
+		}
+
+		if err == errIsDirectory {
+			if sfs.listing {
+				sfs.serveListing(w, r, upath, fsName(fpath))
+				return
+			}
+			sfs.serveNotFound(w, r, upath)
+			return
+		}
+
+		if err == errDirNotAllowed {
+			// the reply does not reveal which directories are allowed
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
 
@@ -228,119 +482,240 @@ func (sfs *staticFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// push content to client
-	sfs.serverPush(w, fpath)
+	sfs.serverPush(w, r, upath)
 
 	// write file data to response
-	sfs.writeResponse(w, r, fpath)
+	sfs.writeResponse(w, r, fpath, sfile)
 }
 
-// serverPush pushes content to the client
-func (sfs *staticFileServer) serverPush(w http.ResponseWriter, fpath string) {
-	// return early when push support is not enabled
-	if !sfs.pushSupport {
+func (sfs *staticFileServer) writeResponse(w http.ResponseWriter, r *http.Request, name string, sfile *staticFile) {
+	// large files are not held in memory
+	if sfile.path != "" {
+		sfs.streamResponse(w, r, name, sfile)
 		return
 	}
 
-	pusher, ok := w.(http.Pusher)
-	if !ok {
+	// pages with a nonce differ for every response
+	if nonce := Nonce(r); nonce != "" && len(sfile.scripts) > 0 {
+		sfs.sendEarlyHints(w, r, "", time.Time{})
+		sfs.writeNonced(w, r, sfile, nonce)
 		return
 	}
 
-	// push content to the client
-	for key, pushInfo := range sfs.pushContent {
-		if key == fpath {
-			for _, target := range pushInfo.pushFiles {
-				pusher.Push(target, sfs.pushOptions)
-			}
-			break
+	var (
+		data     = sfile.data
+		encoding string
+	)
+
+	// the response differs by encoding when the file has encoded variants.
+	// Ranges are served from the identity representation so that byte offsets refer to the file
+	if len(sfile.encoded) > 0 {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Header.Get("Range") == "" {
+			encoding = negotiateEncoding(r.Header.Get("Accept-Encoding"), sfile.encoded)
+		}
+		if encoding != "" {
+			data = sfile.encoded[encoding]
 		}
 	}
-}
 
-func (sfs *staticFileServer) writeResponse(w http.ResponseWriter, r *http.Request, name string) {
-	// get the static file
-	sfile, ok := sfs.getStaticFile(name)
-	if !ok {
-		http.Error(w, "file data does not exist", http.StatusInternalServerError)
+	// set validators and caching headers
+	etag := encodedETag(sfile.etag, encoding)
+	sfs.sendEarlyHints(w, r, etag, sfile.finfo.ModTime())
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", sfile.finfo.ModTime().UTC().Format(http.TimeFormat))
+	sfs.setFileHeaders(w, name)
+
+	if notModified(r, etag, sfile.finfo.ModTime()) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	// set headers
 	w.Header().Set("Content-Type", sfile.ctype)
+
+	// single and multi range requests, validated by If-Range against the entity tag or modification time
+	if encoding == "" {
+		http.ServeContent(w, r, name, sfile.finfo.ModTime(), bytes.NewReader(data))
+		return
+	}
+
+	// set headers
+	w.Header().Set("Content-Encoding", encoding)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
 	w.Header().Set("Accept-Ranges", "bytes")
-	w.Header().Set("Last-Modified", sfile.finfo.ModTime().UTC().Format(http.TimeFormat))
 
-	_, err := w.Write(sfile.data)
+	// HEAD requests get the headers of GET without the body
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	_, err := w.Write(data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 }
 
+// streamResponse writes a file that is too large to cache from disk
+func (sfs *staticFileServer) streamResponse(w http.ResponseWriter, r *http.Request, name string, sfile *staticFile) {
+	f, err := sfs.fsys.Open(sfile.path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	// the file changes on disk, so its validators are taken from the file being sent
+	finfo, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the tag is strong like those of cached files so that If-Range can match it
+	etag := fmt.Sprintf(`"%x-%x"`, finfo.Size(), finfo.ModTime().UnixNano())
+	sfs.sendEarlyHints(w, r, etag, finfo.ModTime())
+
+	w.Header().Set("ETag", etag)
+	sfs.setFileHeaders(w, name)
+	if sfile.ctype != "" {
+		w.Header().Set("Content-Type", sfile.ctype)
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		// files of some filesystems such as compressed zip entries cannot seek
+		bs, err := ioutil.ReadAll(f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(bs)
+	}
+
+	http.ServeContent(w, r, finfo.Name(), finfo.ModTime(), content)
+}
+
 // getStaticFile retrieves the static file
 func (sfs *staticFileServer) getStaticFile(fpath string) (*staticFile, bool) {
+	// a lookup marks the file as recently used
+	sfs.mu.Lock()
+	sf, ok := sfs.files.get(fpath)
+	sfs.mu.Unlock()
+
+	return sf, ok
+}
+
+// isNotFoundPath checks whether the path is in the list of notFoundPaths
+func (sfs *staticFileServer) isNotFoundPath(fpath string) bool {
 	sfs.mu.RLock()
-	sf, ok := sfs.files[fpath]
+	ok := sfs.notFoundPaths.has(fpath)
 	sfs.mu.RUnlock()
 
-	return sf, ok
+	return ok
 }
 
 // addNotFoundPath adds the path to list of notFoundPaths
 func (sfs *staticFileServer) addNotFoundPath(fpath string) {
 	sfs.mu.Lock()
-	sfs.notFoundPaths[fpath] = 2
+	sfs.notFoundPaths.add(fpath)
 	sfs.mu.Unlock()
 }
 
-// addStaticFile adds the static file to the map for faster subsequent retrievals on similar path
-func (sfs *staticFileServer) addStaticFile(path string) error {
-	filePath := filepath.Join(sfs.rootDir, path)
-	if !sfs.allowAll {
-		allowed := false
-
-		// check if path is trying to access a static directory in root
-		if _, ok := sfs.staticDirs[filepath.Dir(filePath)]; ok {
-			// check that filepath is in list of allowed directories
-			for _, allowedDir := range sfs.allowedDirs {
-				if strings.HasPrefix(filePath, allowedDir) {
-					allowed = true
-					break
-				}
-			}
+// addStaticFile adds the static file to the cache for faster subsequent retrievals on similar path.
+// Files larger than the maximum cacheable size are returned without data to be streamed from disk
+func (sfs *staticFileServer) addStaticFile(fpath string) (*staticFile, error) {
+	// a file invalidated while it is read may have been read before it changed, so it is served but not cached
+	sfs.mu.RLock()
+	generation := sfs.generation
+	sfs.mu.RUnlock()
 
-			if !allowed {
-				return errors.New("directory access not allowed")
-			}
-		}
+	// the name is checked against allowed directories, hidden and denied paths and symbolic links
+	name, err := sfs.resolve(fpath)
+	if err != nil {
+		return nil, err
 	}
 
-	// read file content
-	bs, err := ioutil.ReadFile(filePath)
+	// get file stats
+	finfo, err := fs.Stat(sfs.fsys, name)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// get file stats
-	finfo, err := os.Stat(filePath)
+	if finfo.IsDir() {
+		return nil, errIsDirectory
+	}
+
+	if finfo.Size() > sfs.maxFileSize {
+		return &staticFile{
+			finfo: finfo,
+			ctype: contentType(name),
+			path:  name,
+		}, nil
+	}
+
+	// read file content
+	bs, err := fs.ReadFile(sfs.fsys, name)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// find mime of file
-	ctype := mime.TypeByExtension(filepath.Ext(filePath))
+	ctype := contentType(name)
 	if ctype == "" {
 		ctype = http.DetectContentType(bs)
 	}
 
+	// the index page is cached with the runtime config, so precompressed siblings of it are stale
+	injected := sfs.runtimeConfig != nil && name == fsName(sfs.indexPage)
+	if injected {
+		bs, err = sfs.runtimeConfig.inject(bs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// encode the file once so that requests only pick a variant
+	var encoded map[string][]byte
+	if sfs.compression && injected {
+		encoded, err = compressData(ctype, bs)
+	} else if sfs.compression {
+		encoded, err = readEncoded(sfs.fsys, name, ctype, bs)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sfile := &staticFile{
+		data:    bs,
+		finfo:   finfo,
+		ctype:   ctype,
+		encoded: encoded,
+		etag:    computeETag(bs),
+	}
+
+	// script tags are found once so that responses only insert the nonce
+	if sfs.security.nonce && strings.HasPrefix(ctype, "text/html") {
+		sfile.scripts = scriptTagOffsets(bs)
+	}
+
 	sfs.mu.Lock()
-	// add the static files map entry without any data races
-	sfs.files[path] = &staticFile{
-		data:  bs,
-		finfo: finfo,
-		ctype: ctype,
+	// add the static files cache entry without any data races
+	if sfs.generation == generation {
+		sfs.files.add(fpath, sfile)
 	}
 	sfs.mu.Unlock()
 
-	return nil
+	return sfile, nil
+}
+
+// fsName returns the slash separated name relative to root of a URL path or file path.
+// The name never leaves root, so it is valid for use with fs.FS
+func fsName(upath string) string {
+	name := strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(upath)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
 }
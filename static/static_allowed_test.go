@@ -40,7 +40,7 @@ var _ = Describe("Testing server with allowed all directory #allowed", func() {
 
 	Context("Sending Request", func() {
 		It("should return file resource when requested file is present in the server", func() {
-			url := Server.URL() + "/js/about.b5d251bd.js"
+			url := Server.URL() + "/app/js/about.b5d251bd.js"
 			req := httptest.NewRequest(http.MethodGet, url, nil)
 			Expect(req).ShouldNot(BeNil())
 
@@ -15,17 +15,17 @@ var _ = Describe("Static File Server with http.NotFound as notFound handler", fu
 	})
 
 	Context("Sending Request", func() {
-		It("should return StatusBadRequest when method is not GET", func() {
-			req := httptest.NewRequest(http.MethodPost, Server.URL()+"/", nil)
+		It("should return StatusMethodNotAllowed when method is not GET or HEAD", func() {
+			req := httptest.NewRequest(http.MethodPost, Server.URL()+"/app/", nil)
 			Expect(req).ShouldNot(BeNil())
 
 			Handler.ServeHTTP(res, req)
 
-			Expect(res.Code).Should(BeEquivalentTo(http.StatusBadRequest))
+			Expect(res.Code).Should(BeEquivalentTo(http.StatusMethodNotAllowed))
 		})
 
 		It("should return file resource when requested file is present in the server", func() {
-			url := Server.URL() + "/js/about.b5d251bd.js"
+			url := Server.URL() + "/app/js/about.b5d251bd.js"
 			req := httptest.NewRequest(http.MethodGet, url, nil)
 			Expect(req).ShouldNot(BeNil())
 
@@ -39,7 +39,7 @@ var _ = Describe("Static File Server with http.NotFound as notFound handler", fu
 		})
 
 		It("should return index page when requested path is /index.html", func() {
-			url := Server.URL() + "/index.html"
+			url := Server.URL() + "/app/index.html"
 			req := httptest.NewRequest(http.MethodGet, url, nil)
 			Expect(req).ShouldNot(BeNil())
 
@@ -53,7 +53,7 @@ var _ = Describe("Static File Server with http.NotFound as notFound handler", fu
 		})
 
 		It("should return index page when requested path is /", func() {
-			url := Server.URL() + "/"
+			url := Server.URL() + "/app/"
 			req := httptest.NewRequest(http.MethodGet, url, nil)
 			Expect(req).ShouldNot(BeNil())
 
@@ -68,17 +68,17 @@ var _ = Describe("Static File Server with http.NotFound as notFound handler", fu
 	})
 
 	Context("Receiving Response", func() {
-		It("should return StatusBadRequest when method is not GET", func() {
-			req := httptest.NewRequest(http.MethodPost, Server.URL()+"/", nil)
+		It("should return StatusMethodNotAllowed when method is not GET or HEAD", func() {
+			req := httptest.NewRequest(http.MethodPost, Server.URL()+"/app/", nil)
 			Expect(req).ShouldNot(BeNil())
 
 			Handler.ServeHTTP(res, req)
 
-			Expect(res.Code).Should(BeEquivalentTo(http.StatusBadRequest))
+			Expect(res.Code).Should(BeEquivalentTo(http.StatusMethodNotAllowed))
 		})
 
 		It("should return StatusNotFound when the requested file resource is not in the server", func() {
-			url := Server.URL() + "/notfound"
+			url := Server.URL() + "/app/notfound"
 			req := httptest.NewRequest(http.MethodGet, url, nil)
 			Expect(req).ShouldNot(BeNil())
 
@@ -91,7 +91,7 @@ var _ = Describe("Static File Server with http.NotFound as notFound handler", fu
 		})
 
 		It("should return StatusOK when requested file is present in the server", func() {
-			url := Server.URL() + "/js/about.b5d251bd.js"
+			url := Server.URL() + "/app/js/about.b5d251bd.js"
 			req := httptest.NewRequest(http.MethodGet, url, nil)
 			Expect(req).ShouldNot(BeNil())
 
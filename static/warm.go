@@ -0,0 +1,141 @@
+package static
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"io/fs"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Asset describes a file in the cache of a static file server
+type Asset struct {
+	Path        string    `json:"path"`                // URL path of the file including any URL path prefix
+	Size        int64     `json:"size"`                // size of the data served
+	Hash        string    `json:"hash"`                // hex encoded sha256 of the data served
+	ContentType string    `json:"contentType"`         // content type of the file
+	ModTime     time.Time `json:"modTime"`             // modification time of the file
+	Encodings   []string  `json:"encodings,omitempty"` // content encodings the file is available in
+}
+
+// AssetManifest is implemented by the handlers returned by NewHandler and NewMountHandler to list their cached files
+type AssetManifest interface {
+	// Assets returns the cached files sorted by URL path
+	Assets() []Asset
+}
+
+// Assets returns the cached files sorted by URL path
+func (sfs *staticFileServer) Assets() []Asset {
+	list := make([]Asset, 0)
+
+	sfs.mu.RLock()
+	sfs.files.each(func(key string, sfile *staticFile) {
+		upath := path.Join(sfs.urlPrefix, key)
+
+		sum := sha256.Sum256(sfile.data)
+		asset := Asset{
+			Path:        upath,
+			Size:        int64(len(sfile.data)),
+			Hash:        hex.EncodeToString(sum[:]),
+			ContentType: sfile.ctype,
+			ModTime:     sfile.finfo.ModTime(),
+		}
+		for encoding := range sfile.encoded {
+			asset.Encodings = append(asset.Encodings, encoding)
+		}
+		sort.Strings(asset.Encodings)
+
+		list = append(list, asset)
+	})
+	sfs.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+
+	return list
+}
+
+// preload caches the files in root whose URL path matches one of the patterns, reading them with workers in parallel.
+// Hidden, denied and files that are not allowed access are skipped, precompressed siblings are cached with the file they encode
+func (sfs *staticFileServer) preload(patterns []string, workers int) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	names := make([]string, 0)
+	err := fs.WalkDir(sfs.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name != "." && sfs.isHidden(d.Name()) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		for _, ee := range encodingExts {
+			if strings.HasSuffix(name, ee.ext) {
+				return nil
+			}
+		}
+
+		for _, pattern := range patterns {
+			if matchPattern(pattern, "/"+name) {
+				names = append(names, name)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to walk root directory")
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		queue    = make(chan string)
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range queue {
+				err := sfs.preloadFile(name)
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = errors.Wrapf(err, "failed to preload %s", name)
+					})
+				}
+			}
+		}()
+	}
+
+	for _, name := range names {
+		queue <- name
+	}
+	close(queue)
+	wg.Wait()
+
+	return firstErr
+}
+
+// preloadFile caches a file under the keys requests look it up with
+func (sfs *staticFileServer) preloadFile(name string) error {
+	if _, err := sfs.resolve(name); err != nil {
+		return nil
+	}
+
+	// requests for the root look the index page up by its URL path too
+	_, err := sfs.addStaticFile("/" + name)
+	return err
+}
@@ -0,0 +1,124 @@
+package static
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+)
+
+var _ = Describe("Preloading files and listing assets", func() {
+	var res *httptest.ResponseRecorder
+
+	get := func(handler http.Handler, path string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+	}
+
+	files := func() fstest.MapFS {
+		return fstest.MapFS{
+			"index.html":     {Data: []byte("<html></html>")},
+			"js/app.js":      {Data: []byte("app()")},
+			"js/app.js.gz":   {Data: []byte("gzipped app")},
+			"js/vendor.js":   {Data: []byte("vendor()")},
+			"css/style.css":  {Data: []byte("body{}")},
+			".git/config":    {Data: []byte("[core]")},
+			"private/key.js": {Data: []byte("secret")},
+		}
+	}
+
+	paths := func(assets []Asset) []string {
+		list := make([]string, 0, len(assets))
+		for _, asset := range assets {
+			list = append(list, asset.Path)
+		}
+		return list
+	}
+
+	It("should preload matching files when the server is created", func() {
+		fsys := files()
+		handler, err := NewHandler(&ServerOptions{FS: fsys, Preload: []string{"/js/*"}, PreloadWorkers: 2})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Expect(paths(handler.(AssetManifest).Assets())).Should(Equal([]string{"/js/app.js", "/js/vendor.js"}))
+
+		// preloaded files are served from the cache
+		delete(fsys, "js/vendor.js")
+		get(handler, "/js/vendor.js")
+		Expect(res.Code).Should(Equal(http.StatusOK))
+		Expect(res.Body.String()).Should(Equal("vendor()"))
+	})
+
+	It("should preload the whole tree without hidden and denied files", func() {
+		handler, err := NewHandler(&ServerOptions{FS: files(), Preload: []string{"/*"}, DenyPatterns: []string{"/private/*"}})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Expect(paths(handler.(AssetManifest).Assets())).Should(Equal([]string{
+			"/css/style.css", "/index.html", "/js/app.js", "/js/vendor.js",
+		}))
+
+		fsys := files()
+		delete(fsys, "index.html")
+		handler, err = NewHandler(&ServerOptions{FS: fsys, Preload: []string{"/*"}})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(paths(handler.(AssetManifest).Assets())).Should(ContainElement("/private/key.js"))
+	})
+
+	It("should serve the preloaded index page for the root", func() {
+		fsys := files()
+		handler, err := NewHandler(&ServerOptions{FS: fsys, Preload: []string{"*.html"}})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		delete(fsys, "index.html")
+		get(handler, "/")
+		Expect(res.Code).Should(Equal(http.StatusOK))
+		Expect(res.Body.String()).Should(Equal("<html></html>"))
+	})
+
+	It("should cache the index page once for the root and its path", func() {
+		handler, err := NewHandler(&ServerOptions{FS: files(), Preload: []string{"*.html"}})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		get(handler, "/")
+		Expect(res.Code).Should(Equal(http.StatusOK))
+		get(handler, "/index.html")
+		Expect(res.Code).Should(Equal(http.StatusOK))
+
+		keys := make([]string, 0)
+		handler.(*staticFileServer).files.each(func(key string, sfile *staticFile) {
+			keys = append(keys, key)
+		})
+		Expect(keys).Should(Equal([]string{"/index.html"}))
+	})
+
+	It("should describe cached files", func() {
+		handler, err := NewHandler(&ServerOptions{FS: files(), URLPathPrefix: "/app"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(handler.(AssetManifest).Assets()).Should(BeEmpty())
+
+		get(handler, "/app/js/app.js")
+		Expect(res.Code).Should(Equal(http.StatusOK))
+
+		assets := handler.(AssetManifest).Assets()
+		Expect(assets).Should(HaveLen(1))
+
+		sum := sha256.Sum256([]byte("app()"))
+		Expect(assets[0].Path).Should(Equal("/app/js/app.js"))
+		Expect(assets[0].Size).Should(Equal(int64(5)))
+		Expect(assets[0].Hash).Should(Equal(hex.EncodeToString(sum[:])))
+		Expect(assets[0].ContentType).Should(ContainSubstring("javascript"))
+		Expect(assets[0].Encodings).Should(Equal([]string{"gzip"}))
+	})
+
+	It("should list the assets of every mounted server", func() {
+		handler, err := NewMountHandler(
+			&ServerOptions{FS: files(), URLPathPrefix: "/a", Preload: []string{"/css/*"}},
+			&ServerOptions{FS: files(), URLPathPrefix: "/b", Preload: []string{"/js/vendor.js"}},
+		)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Expect(paths(handler.(AssetManifest).Assets())).Should(Equal([]string{"/a/css/style.css", "/b/js/vendor.js"}))
+	})
+})
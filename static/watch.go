@@ -0,0 +1,251 @@
+package static
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Cache is implemented by the handler returned by NewHandler to control its cache of files
+type Cache interface {
+	// Reload drops every cached file and remembered 404 path so that they are read again from disk
+	Reload() error
+	// Invalidate drops the cached file and remembered 404 of a request URL path, including any URL path prefix
+	Invalidate(upath string)
+	// Close stops watching and revalidation of files
+	Close() error
+}
+
+// Reload drops every cached file and remembered 404 path
+func (sfs *staticFileServer) Reload() error {
+	sfs.mu.Lock()
+	sfs.files.clear()
+	sfs.notFoundPaths.clear()
+	sfs.generation++
+	sfs.mu.Unlock()
+
+	return nil
+}
+
+// Invalidate drops the cached file and remembered 404 of a request URL path
+func (sfs *staticFileServer) Invalidate(upath string) {
+	upath = path.Clean("/" + upath)
+	if !withinPrefix(upath, sfs.urlPrefix) {
+		return
+	}
+	fpath := strings.TrimPrefix(upath, sfs.urlPrefix)
+
+	// the root path serves the index page, which is cached under its own path
+	if fpath == "/" || fpath == "" {
+		fpath = sfs.indexPage
+	}
+	keys := append(cacheKeys(fsName(fpath)), fpath)
+
+	sfs.mu.Lock()
+	for _, key := range keys {
+		sfs.files.remove(key)
+		sfs.notFoundPaths.remove(key)
+	}
+	sfs.generation++
+	sfs.mu.Unlock()
+}
+
+// Close stops watching and revalidation of files
+func (sfs *staticFileServer) Close() error {
+	var err error
+	sfs.closeOnce.Do(func() {
+		close(sfs.done)
+		if sfs.watcher != nil {
+			err = sfs.watcher.Close()
+		}
+	})
+	return err
+}
+
+// cacheKeys returns the keys under which the file name may be cached. Precompressed siblings map to the file they encode
+func cacheKeys(name string) []string {
+	for _, ee := range encodingExts {
+		name = strings.TrimSuffix(name, ee.ext)
+	}
+
+	return []string{"/" + name}
+}
+
+// watch starts watching the root directory and its sub directories for changes
+func (sfs *staticFileServer) watch() error {
+	if sfs.rootDir == "" {
+		return errors.New("watching requires a root directory on the OS filesystem")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	err = addWatches(watcher, sfs.rootDir)
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+
+	sfs.watcher = watcher
+
+	go func() {
+		for {
+			select {
+			case <-sfs.done:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				sfs.handleEvent(event)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logrus.Errorln(err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// handleEvent invalidates the cache entries of a changed file
+func (sfs *staticFileServer) handleEvent(event fsnotify.Event) {
+	if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) == 0 {
+		return
+	}
+
+	if event.Op&fsnotify.Create != 0 {
+		finfo, err := os.Stat(event.Name)
+		if err == nil && finfo.IsDir() {
+			// files of a new directory were never seen, so any remembered 404 may now exist
+			err = addWatches(sfs.watcher, event.Name)
+			if err != nil {
+				logrus.Errorln(err)
+			}
+			sfs.mu.Lock()
+			sfs.notFoundPaths.clear()
+			sfs.mu.Unlock()
+			return
+		}
+	}
+
+	rel, err := filepath.Rel(sfs.rootDir, event.Name)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return
+	}
+
+	name := fsName(rel)
+	keys := cacheKeys(name)
+
+	sfs.mu.Lock()
+	for _, key := range keys {
+		sfs.files.remove(key)
+		sfs.notFoundPaths.remove(key)
+	}
+	// a removed or renamed directory takes every file under it along
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		sfs.removeTree(name)
+	}
+	sfs.generation++
+	sfs.mu.Unlock()
+}
+
+// removeTree drops every cached file under the directory name. It must be called with the lock held
+func (sfs *staticFileServer) removeTree(name string) {
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+
+	keys := make([]string, 0)
+	sfs.files.each(func(key string, sfile *staticFile) {
+		if strings.HasPrefix(fsName(key), prefix) {
+			keys = append(keys, key)
+		}
+	})
+	for _, key := range keys {
+		sfs.files.remove(key)
+	}
+}
+
+// addWatches watches dir and its sub directories
+func addWatches(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(name string, finfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if finfo.IsDir() {
+			return watcher.Add(name)
+		}
+		return nil
+	})
+}
+
+// revalidate periodically drops cached files whose modification time or size changed on disk
+// and remembered 404 paths that now exist
+func (sfs *staticFileServer) revalidate(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sfs.done:
+			return
+		case <-ticker.C:
+			sfs.revalidateOnce()
+		}
+	}
+}
+
+func (sfs *staticFileServer) revalidateOnce() {
+	// the cache is only locked to take a snapshot, so that requests are not blocked while files are stat'ed
+	sfs.mu.RLock()
+	cached := make(map[string]os.FileInfo, 0)
+	sfs.files.each(func(key string, sfile *staticFile) {
+		cached[key] = sfile.finfo
+	})
+	notFound := sfs.notFoundPaths.paths()
+	sfs.mu.RUnlock()
+
+	stale := make([]string, 0)
+	for key, cachedInfo := range cached {
+		finfo, err := fs.Stat(sfs.fsys, fsName(key))
+		if err != nil || !finfo.ModTime().Equal(cachedInfo.ModTime()) || finfo.Size() != cachedInfo.Size() {
+			stale = append(stale, key)
+		}
+	}
+	found := make([]string, 0)
+	for _, key := range notFound {
+		_, err := fs.Stat(sfs.fsys, fsName(key))
+		if err == nil {
+			found = append(found, key)
+		}
+	}
+
+	if len(stale) == 0 && len(found) == 0 {
+		return
+	}
+
+	sfs.mu.Lock()
+	for _, key := range stale {
+		sfs.files.remove(key)
+	}
+	// files read since the snapshot may be as stale as the ones dropped
+	if len(stale) > 0 {
+		sfs.generation++
+	}
+	for _, key := range found {
+		sfs.notFoundPaths.remove(key)
+	}
+	sfs.mu.Unlock()
+}
@@ -0,0 +1,212 @@
+package static
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing/fstest"
+	"time"
+)
+
+var _ = Describe("Reloading cached static files", func() {
+	var (
+		handler http.Handler
+		rootDir string
+	)
+
+	writeFile := func(name, content string) {
+		name = filepath.Join(rootDir, name)
+		Expect(os.MkdirAll(filepath.Dir(name), 0755)).ShouldNot(HaveOccurred())
+		Expect(ioutil.WriteFile(name, []byte(content), 0644)).ShouldNot(HaveOccurred())
+	}
+
+	// get returns the status and body of a request to path
+	get := func(path string) (int, string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Code, res.Body.String()
+	}
+
+	body := func(path string) func() string {
+		return func() string {
+			_, body := get(path)
+			return body
+		}
+	}
+
+	status := func(path string) func() int {
+		return func() int {
+			code, _ := get(path)
+			return code
+		}
+	}
+
+	newHandler := func(opt *ServerOptions) {
+		var err error
+		opt.RootDir = rootDir
+		opt.Index = "index.html"
+		handler, err = NewHandler(opt)
+		Expect(err).ShouldNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var err error
+		rootDir, err = ioutil.TempDir("", "static")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		writeFile("index.html", "index v1")
+		writeFile("js/app.js", "app v1")
+	})
+
+	AfterEach(func() {
+		if cache, ok := handler.(Cache); ok {
+			Expect(cache.Close()).ShouldNot(HaveOccurred())
+		}
+		os.RemoveAll(rootDir)
+	})
+
+	Context("Without watching", func() {
+		BeforeEach(func() {
+			newHandler(&ServerOptions{})
+		})
+
+		It("should serve cached content until reloaded", func() {
+			Expect(body("/js/app.js")()).Should(Equal("app v1"))
+			Expect(status("/js/vendor.js")()).Should(Equal(http.StatusNotFound))
+
+			writeFile("js/app.js", "app v2")
+			writeFile("js/vendor.js", "vendor v1")
+			Expect(body("/js/app.js")()).Should(Equal("app v1"))
+			Expect(status("/js/vendor.js")()).Should(Equal(http.StatusNotFound))
+
+			Expect(handler.(Cache).Reload()).ShouldNot(HaveOccurred())
+			Expect(body("/js/app.js")()).Should(Equal("app v2"))
+			Expect(body("/js/vendor.js")()).Should(Equal("vendor v1"))
+		})
+
+		It("should read a file again once invalidated", func() {
+			Expect(body("/")()).Should(Equal("index v1"))
+			Expect(body("/js/app.js")()).Should(Equal("app v1"))
+
+			writeFile("index.html", "index v2")
+			writeFile("js/app.js", "app v2")
+
+			handler.(Cache).Invalidate("/index.html")
+			Expect(body("/")()).Should(Equal("index v2"))
+			Expect(body("/js/app.js")()).Should(Equal("app v1"))
+		})
+
+		It("should read the index page again when the root is invalidated", func() {
+			Expect(body("/")()).Should(Equal("index v1"))
+
+			writeFile("index.html", "index v2")
+
+			handler.(Cache).Invalidate("/")
+			Expect(body("/")()).Should(Equal("index v2"))
+		})
+	})
+
+	Context("While reading", func() {
+		It("should not cache a file that is invalidated while it is read", func() {
+			files := fstest.MapFS{"js/app.js": {Data: []byte("app v1")}}
+			opens := 0
+			fsys := &hookFS{fsys: files, hook: func(name string) {
+				if name != "js/app.js" {
+					return
+				}
+				// the content is being read when the file changes for the second open
+				if opens++; opens == 2 {
+					files["js/app.js"] = &fstest.MapFile{Data: []byte("app v2")}
+					handler.(Cache).Invalidate("/js/app.js")
+				}
+			}}
+
+			var err error
+			handler, err = NewHandler(&ServerOptions{FS: fsys})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(body("/js/app.js")()).Should(Equal("app v1"))
+			Expect(body("/js/app.js")()).Should(Equal("app v2"))
+		})
+	})
+
+	Context("With watching", func() {
+		BeforeEach(func() {
+			newHandler(&ServerOptions{Watch: true})
+		})
+
+		It("should refresh a file that is written", func() {
+			Expect(body("/js/app.js")()).Should(Equal("app v1"))
+
+			writeFile("js/app.js", "app v2")
+			Eventually(body("/js/app.js")).Should(Equal("app v2"))
+		})
+
+		It("should forget a file that is removed", func() {
+			Expect(status("/js/app.js")()).Should(Equal(http.StatusOK))
+
+			Expect(os.Remove(filepath.Join(rootDir, "js/app.js"))).ShouldNot(HaveOccurred())
+			Eventually(status("/js/app.js")).Should(Equal(http.StatusNotFound))
+		})
+
+		It("should serve a created file that was not found before", func() {
+			Expect(status("/js/vendor.js")()).Should(Equal(http.StatusNotFound))
+
+			writeFile("js/vendor.js", "vendor v1")
+			Eventually(body("/js/vendor.js")).Should(Equal("vendor v1"))
+		})
+
+		It("should forget the files of a directory that is renamed away", func() {
+			Expect(status("/js/app.js")()).Should(Equal(http.StatusOK))
+
+			Expect(os.Rename(filepath.Join(rootDir, "js"), filepath.Join(rootDir, "lib"))).ShouldNot(HaveOccurred())
+			Eventually(status("/js/app.js")).Should(Equal(http.StatusNotFound))
+			Expect(body("/lib/app.js")()).Should(Equal("app v1"))
+		})
+
+		It("should serve files of a renamed directory", func() {
+			Expect(status("/css/app.css")()).Should(Equal(http.StatusNotFound))
+
+			writeFile("tmp/app.css", "css v1")
+			Expect(os.Rename(filepath.Join(rootDir, "tmp"), filepath.Join(rootDir, "css"))).ShouldNot(HaveOccurred())
+			Eventually(body("/css/app.css")).Should(Equal("css v1"))
+		})
+	})
+
+	Context("With revalidation", func() {
+		BeforeEach(func() {
+			newHandler(&ServerOptions{RevalidateInterval: 20 * time.Millisecond})
+		})
+
+		It("should refresh a file whose modification time changed", func() {
+			Expect(body("/js/app.js")()).Should(Equal("app v1"))
+
+			writeFile("js/app.js", "app v2")
+			Expect(os.Chtimes(filepath.Join(rootDir, "js/app.js"), time.Now(), time.Now().Add(time.Second))).ShouldNot(HaveOccurred())
+			Eventually(body("/js/app.js")).Should(Equal("app v2"))
+		})
+
+		It("should serve a created file that was not found before", func() {
+			Expect(status("/js/vendor.js")()).Should(Equal(http.StatusNotFound))
+
+			writeFile("js/vendor.js", "vendor v1")
+			Eventually(body("/js/vendor.js")).Should(Equal("vendor v1"))
+		})
+	})
+})
+
+// hookFS calls hook with the name of every file it opens, after opening it
+type hookFS struct {
+	fsys fs.FS
+	hook func(name string)
+}
+
+func (h *hookFS) Open(name string) (fs.File, error) {
+	f, err := h.fsys.Open(name)
+	h.hook(name)
+	return f, err
+}
@@ -0,0 +1,122 @@
+package fs
+
+import (
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+)
+
+// Upload is a file received in a request to be stored
+type Upload struct {
+	Key      string
+	Path     string
+	Name     string
+	Mime     string
+	OwnerID  string
+	OwnerTag string
+	Size     int64
+	Data     []byte
+}
+
+// Result returns the result of storing the upload in a batch
+func (up *Upload) Result() *UploadResult {
+	return &UploadResult{
+		Key:  up.Key,
+		Path: up.Path,
+		Name: up.Name,
+		Size: up.Size,
+	}
+}
+
+// ReadUpload reads the content of a file part and detects its content type.
+// A file part without a name is given a random name with an extension of its content type
+func ReadUpload(header *multipart.FileHeader, ownerID, ownerTag string) (*Upload, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// read content
+	bs, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// detect content-type
+	ctype := http.DetectContentType(bs)
+
+	fileName, err := func() (string, error) {
+		if header.Filename != "" {
+			return header.Filename, nil
+		}
+		fileEndings, err := mime.ExtensionsByType(ctype)
+		if err != nil || len(fileEndings) == 0 {
+			return "", errors.New("CANT_READ_FILE_EXT_TYPE")
+		}
+		return uuid.New().String() + fileEndings[0], nil
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Upload{
+		Name:     fileName,
+		Mime:     ctype,
+		OwnerID:  ownerID,
+		OwnerTag: ownerTag,
+		Size:     header.Size,
+		Data:     bs,
+	}, nil
+}
+
+// ExtractUploads extracts the files of an uploaded archive as uploads under upath that belong to the owner of the archive.
+// It returns the status and message reported to client when the archive cannot be extracted or has no files
+func ExtractUploads(archive *Upload, upath, format string, limits ArchiveLimits) ([]*Upload, *StatusError) {
+	entries, err := ExtractArchive(archive.Data, format, limits)
+	if err != nil {
+		return nil, archiveError(err)
+	}
+
+	if len(entries) == 0 {
+		return nil, &StatusError{Status: http.StatusBadRequest, Msg: "EMPTY_ARCHIVE"}
+	}
+
+	uploads := make([]*Upload, 0, len(entries))
+	for _, entry := range entries {
+		up := &Upload{
+			Name:     path.Base(entry.Name),
+			Path:     path.Join(upath, entry.Name),
+			Mime:     http.DetectContentType(entry.Data),
+			OwnerID:  archive.OwnerID,
+			OwnerTag: archive.OwnerTag,
+			Size:     int64(len(entry.Data)),
+			Data:     entry.Data,
+		}
+		up.Key = FileKey(up.Path)
+		uploads = append(uploads, up)
+	}
+
+	return uploads, nil
+}
+
+// archiveError returns the status and message reported to client for a failure to extract an archive
+func archiveError(err error) *StatusError {
+	switch errors.Cause(err) {
+	case ErrArchiveFormat:
+		return &StatusError{Status: http.StatusBadRequest, Msg: "UNKNOWN_ARCHIVE_FORMAT"}
+	case ErrArchiveUnsafePath:
+		return &StatusError{Status: http.StatusBadRequest, Msg: "UNSAFE_ARCHIVE_ENTRY_PATH"}
+	case ErrArchiveEntryType:
+		return &StatusError{Status: http.StatusBadRequest, Msg: "UNSUPPORTED_ARCHIVE_ENTRY"}
+	case ErrArchiveTooManyEntries:
+		return &StatusError{Status: http.StatusRequestEntityTooLarge, Msg: "TOO_MANY_ARCHIVE_ENTRIES"}
+	case ErrArchiveTooLarge:
+		return &StatusError{Status: http.StatusRequestEntityTooLarge, Msg: "ARCHIVE_TOO_LARGE"}
+	}
+	return &StatusError{Status: http.StatusBadRequest, Msg: "INVALID_ARCHIVE"}
+}